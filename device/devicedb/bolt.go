@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/com-gft-tsbo-source/go-common/device/implementation/devicemeasure"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/secret"
 
 	"github.com/boltdb/bolt"
 )
@@ -143,7 +144,7 @@ func (con *BoltConnection) Update(node devicemeasure.IDeviceMeasure) error {
 
 // GetConnectString ...
 func (con *BoltConnection) GetConnectString() string {
-	return con.connectString
+	return secret.Scrub(con.connectString)
 }
 
 // ---------------------------------------------------------------------------
@@ -11,6 +11,7 @@ import (
 	"sync"
 
 	"github.com/com-gft-tsbo-source/go-common/device/implementation/devicemeasure"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/secret"
 
 	"github.com/gocql/gocql"
 )
@@ -53,7 +54,6 @@ func (con *CassandraConnection) Open() error {
 	con.cluster = nil
 	con.session = nil
 	con.isOpen = false
-	fmt.Println(con.connectString)
 	cluster := gocql.NewCluster(con.connectString)
 	cluster.Consistency = gocql.Quorum
 
@@ -161,7 +161,7 @@ func (con *CassandraConnection) Update(node devicemeasure.IDeviceMeasure) error
 
 // GetConnectString ...
 func (con *CassandraConnection) GetConnectString() string {
-	return con.connectString
+	return secret.Scrub(con.connectString)
 }
 
 // ---------------------------------------------------------------------------
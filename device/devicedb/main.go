@@ -7,10 +7,12 @@ package devicedb
 // ###########################################################################
 
 import (
+	"log"
 	"strings"
 	"sync"
 
 	"github.com/com-gft-tsbo-source/go-common/device/implementation/devicemeasure"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/secret"
 
 	_ "github.com/boltdb/bolt"
 	_ "github.com/lib/pq"
@@ -41,10 +43,20 @@ type IConnection interface {
 // ###########################################################################
 
 // NewDatabase ...
+// connectString may be a secret reference like 'file:/run/secrets/db', its
+// password is scrubbed from logs and from GetConnectString.
 func NewDatabase(connectString string, tableName string, clientName string) IConnection {
 
 	var retVal IConnection
 	var isOk bool
+
+	connectString, err := secret.Resolve(connectString)
+	if err != nil {
+		log.Printf("Could not resolve database connection, error was '%s'!", err.Error())
+		return NewDatabaseNil("", tableName, clientName)
+	}
+	secret.RegisterPassword(connectString)
+
 	if strings.HasPrefix(connectString, "sql://") {
 		retVal, isOk = NewDatabaseSqlite(connectString, tableName, clientName)
 	} else if strings.HasPrefix(connectString, "pg://") {
@@ -12,6 +12,7 @@ import (
 	"regexp"
 
 	"github.com/com-gft-tsbo-source/go-common/device/implementation/devicemeasure"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/secret"
 
 	_ "github.com/boltdb/bolt"
 	_ "github.com/lib/pq"
@@ -122,7 +123,7 @@ func (con *SQLConnection) Update(node devicemeasure.IDeviceMeasure) error {
 
 // GetConnectString ...
 func (con *SQLConnection) GetConnectString() string {
-	return con.connectString
+	return secret.Scrub(con.connectString)
 }
 
 // ---------------------------------------------------------------------------
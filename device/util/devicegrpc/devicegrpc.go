@@ -0,0 +1,181 @@
+package devicegrpc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/com-gft-tsbo-source/go-common/device"
+	"github.com/com-gft-tsbo-source/go-common/device/implementation/devicedescriptor"
+	"github.com/com-gft-tsbo-source/go-common/device/implementation/devicevalue"
+	"github.com/com-gft-tsbo-source/go-common/device/util/devicestream"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ###########################################################################
+// ###########################################################################
+// ###########################################################################
+// ###########################################################################
+// ###########################################################################
+
+// DeviceService serves the devices of a service over gRPC. Measure simulates
+// a new value of a device, WatchMeasurements streams the values published
+// to a stream.
+//
+//	var service devicegrpc.DeviceService
+//	devicegrpc.InitDeviceService(&service, &stream)
+//	service.Add(&thermometer)
+//	devicegrpc.RegisterDeviceServiceServer(&ms, &service)
+type DeviceService struct {
+	UnimplementedDeviceServiceServer
+
+	mutex   sync.Mutex
+	devices map[string]device.IDevice
+	order   []string
+	stream  devicestream.IDeviceStream
+}
+
+// ---------------------------------------------------------------------------
+
+// IDeviceService ...
+type IDeviceService interface {
+	DeviceServiceServer
+	Add(dev device.IDevice)
+}
+
+// ###########################################################################
+
+// InitDeviceService creates a service watching stream, which may be nil
+func InitDeviceService(s *DeviceService, stream devicestream.IDeviceStream) {
+	s.devices = map[string]device.IDevice{}
+	s.order = nil
+	s.stream = stream
+}
+
+// ###########################################################################
+
+// Add adds a device, replacing one with the same address
+func (s *DeviceService) Add(dev device.IDevice) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.devices[dev.GetDeviceAddress()]; !found {
+		s.order = append(s.order, dev.GetDeviceAddress())
+	}
+	s.devices[dev.GetDeviceAddress()] = dev
+}
+
+// ---------------------------------------------------------------------------
+
+// ListDevices returns the descriptors of the devices in the order they were
+// added
+func (s *DeviceService) ListDevices(ctx context.Context, req *ListDevicesRequest) (*ListDevicesResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	response := &ListDevicesResponse{}
+	for _, address := range s.order {
+		response.Devices = append(response.Devices, descriptorOf(s.devices[address]))
+	}
+	return response, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// GetDevice returns the descriptor of a device
+func (s *DeviceService) GetDevice(ctx context.Context, req *GetDeviceRequest) (*Descriptor, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dev, found := s.devices[req.GetAddress()]
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "Device '%s' not found.", req.GetAddress())
+	}
+	return descriptorOf(dev), nil
+}
+
+// ---------------------------------------------------------------------------
+
+// Measure simulates the next value of a device
+func (s *DeviceService) Measure(ctx context.Context, req *MeasureRequest) (*Measurement, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dev, found := s.devices[req.GetAddress()]
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "Device '%s' not found.", req.GetAddress())
+	}
+
+	var value devicevalue.DeviceValue
+	dev.Simulate()
+	dev.FillDeviceValue(&value)
+
+	return &Measurement{
+		Address: dev.GetDeviceAddress(),
+		Device:  descriptorOf(dev),
+		Value:   valueOf(value),
+	}, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// WatchMeasurements streams the values published to the stream. Devices of
+// the service are sent with their descriptor. If the client lags behind, the
+// call ends with Aborted, so it resumes with the id of its last value as
+// last_id.
+func (s *DeviceService) WatchMeasurements(req *WatchMeasurementsRequest, server DeviceService_WatchMeasurementsServer) error {
+	if s.stream == nil {
+		return status.Error(codes.Unimplemented, "The service publishes no measurements.")
+	}
+
+	err := s.stream.Watch(server.Context(), req.GetAddresses(), req.GetLastId(), func(e *dispatcher.Event) error {
+		data, ok := e.Data.(devicestream.DeviceEvent)
+		if !ok {
+			return nil
+		}
+
+		measurement := &Measurement{
+			Id:      e.ID,
+			Address: data.DeviceAddress,
+			Value:   valueOf(data.DeviceValue),
+		}
+
+		s.mutex.Lock()
+		if dev, found := s.devices[data.DeviceAddress]; found {
+			measurement.Device = descriptorOf(dev)
+		}
+		s.mutex.Unlock()
+
+		return server.Send(measurement)
+	})
+
+	switch err {
+	case context.Canceled:
+		return nil
+	case devicestream.ErrLagged:
+		return status.Error(codes.Aborted, "The client lagged behind, resume with the id of the last measurement as last_id.")
+	}
+	return err
+}
+
+// ###########################################################################
+
+func descriptorOf(d devicedescriptor.IDeviceDescriptor) *Descriptor {
+	return &Descriptor{
+		Type:    d.GetDeviceType(),
+		Address: d.GetDeviceAddress(),
+		Unit:    d.GetUnit(),
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func valueOf(v devicevalue.IDeviceValue) *Value {
+	return &Value{
+		Raw:       int64(v.GetValue()),
+		Formatted: v.GetFormatted(),
+		Stamp:     timestamppb.New(v.GetStamp()),
+	}
+}
@@ -1,6 +1,7 @@
 package devicenode
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -9,6 +10,8 @@ import (
 
 	"github.com/com-gft-tsbo-source/go-common/device/implementation/devicedescriptor"
 	"github.com/com-gft-tsbo-source/go-common/device/implementation/devicevalue"
+	"github.com/com-gft-tsbo-source/go-common/device/util/devicestream"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher"
 )
 
 // ###########################################################################
@@ -27,6 +30,9 @@ type DeviceNode struct {
 	URLDevice  string `json:"urlDevice"`
 	URLMeasure string `json:"urlMeasure"`
 	URLStatus  string `json:"urlStatus"`
+	URLStream  string `json:"urlStream,omitempty"`
+
+	lastEventID string
 }
 
 // ---------------------------------------------------------------------------
@@ -36,6 +42,7 @@ type IDeviceNode interface {
 	devicedescriptor.IDeviceDescriptor
 	devicevalue.IDeviceValue
 	Update() error
+	Watch(ctx context.Context, fn func(*DeviceNode)) error
 	SetSequence(int)
 	GetSequence() int
 	IsNew() bool
@@ -43,6 +50,7 @@ type IDeviceNode interface {
 	GetURLDevice() string
 	GetURLMeasure() string
 	GetURLStatus() string
+	GetURLStream() string
 }
 
 // ###########################################################################
@@ -130,6 +138,65 @@ func (node *DeviceNode) Update() error {
 	return nil
 }
 
+// ---------------------------------------------------------------------------
+
+// Watch subscribes to the value events at URLStream instead of polling. Each
+// value updates the node and is passed to fn, until ctx is done or the stream
+// ends. A later Watch resumes after the last value received.
+func (node *DeviceNode) Watch(ctx context.Context, fn func(*DeviceNode)) error {
+	if len(node.URLStream) == 0 {
+		return fmt.Errorf("Device '%s' has no stream!", node.DeviceAddress)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, node.URLStream, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", dispatcher.EventStreamContentType)
+	if len(node.lastEventID) > 0 {
+		req.Header.Set("Last-Event-ID", node.lastEventID)
+	}
+
+	// The stream stays open, so the client has no timeout
+	httpClient := &http.Client{}
+	r, err := httpClient.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(r.Body)
+		return fmt.Errorf("Could not watch device, status was '%d', message was '%s'!", r.StatusCode, body)
+	}
+
+	err = dispatcher.ReadEvents(r.Body, func(event *dispatcher.Event) error {
+		if event.Event != devicestream.EventMeasure {
+			return nil
+		}
+
+		var value devicestream.DeviceEvent
+		if err := json.Unmarshal([]byte(event.Data.(string)), &value); err != nil {
+			return err
+		}
+		if value.DeviceAddress != node.DeviceAddress {
+			return nil
+		}
+
+		node.DeviceValue = value.DeviceValue
+		node.lastEventID = event.ID
+		fn(node)
+		return nil
+	})
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
 // ###########################################################################
 
 // SetSequence ...
@@ -166,3 +233,8 @@ func (node *DeviceNode) GetURLMeasure() string { return node.URLMeasure }
 
 // GetURLStatus ...
 func (node *DeviceNode) GetURLStatus() string { return node.URLStatus }
+
+// ---------------------------------------------------------------------------
+
+// GetURLStream ...
+func (node *DeviceNode) GetURLStream() string { return node.URLStream }
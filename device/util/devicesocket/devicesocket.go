@@ -0,0 +1,195 @@
+package devicesocket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/com-gft-tsbo-source/go-common/device"
+	"github.com/com-gft-tsbo-source/go-common/device/implementation/devicevalue"
+	"github.com/com-gft-tsbo-source/go-common/device/util/devicestream"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher"
+	"github.com/gorilla/websocket"
+)
+
+// ###########################################################################
+// ###########################################################################
+// ###########################################################################
+// ###########################################################################
+// ###########################################################################
+
+const (
+	// MessageMeasure carries a value from a device
+	MessageMeasure = "measure"
+	// MessageTranslate asks a device to translate its value, see
+	// devicesimulation.TranslateValue
+	MessageTranslate = "translate"
+)
+
+// Message is exchanged with device simulators over a WebSocket
+type Message struct {
+	Type          string                   `json:"type"`
+	DeviceAddress string                   `json:"address"`
+	Value         *devicevalue.DeviceValue `json:"value,omitempty"`
+	Translate     *int                     `json:"translate,omitempty"`
+}
+
+// ---------------------------------------------------------------------------
+
+// DeviceHub keeps the WebSocket connections of device simulators by device
+// address. Their values are published to a stream, commands are sent back to
+// them.
+type DeviceHub struct {
+	mutex     sync.Mutex
+	devices   map[string]*dispatcher.WebSocket
+	stream    devicestream.IDeviceStream
+	onMeasure func(deviceAddress string, value devicevalue.DeviceValue)
+}
+
+// ---------------------------------------------------------------------------
+
+// IDeviceHub ...
+type IDeviceHub interface {
+	OnMeasure(fn func(deviceAddress string, value devicevalue.DeviceValue))
+	Translate(deviceAddress string, i int) error
+	Handler() dispatcher.WebSocketHandler
+}
+
+// ###########################################################################
+
+// InitDeviceHub creates a hub publishing to stream, which may be nil
+func InitDeviceHub(h *DeviceHub, stream devicestream.IDeviceStream) {
+	h.devices = map[string]*dispatcher.WebSocket{}
+	h.stream = stream
+	h.onMeasure = nil
+}
+
+// ###########################################################################
+
+// OnMeasure sets a function called with each value received
+func (h *DeviceHub) OnMeasure(fn func(deviceAddress string, value devicevalue.DeviceValue)) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.onMeasure = fn
+}
+
+// ---------------------------------------------------------------------------
+
+// Translate sends a translate command to a connected device
+func (h *DeviceHub) Translate(deviceAddress string, i int) error {
+	h.mutex.Lock()
+	conn, found := h.devices[deviceAddress]
+	h.mutex.Unlock()
+
+	if !found {
+		return fmt.Errorf("Device '%s' is not connected!", deviceAddress)
+	}
+	return conn.WriteJSON(&Message{Type: MessageTranslate, DeviceAddress: deviceAddress, Translate: &i})
+}
+
+// ---------------------------------------------------------------------------
+
+// Handler returns the handler devices connect to. A device is known by the
+// address of its first value, a later connection of the same device replaces
+// the earlier one.
+func (h *DeviceHub) Handler() dispatcher.WebSocketHandler {
+	return func(conn *dispatcher.WebSocket, r *http.Request) error {
+		var deviceAddress string
+
+		defer func() {
+			h.mutex.Lock()
+			defer h.mutex.Unlock()
+			if h.devices[deviceAddress] == conn {
+				delete(h.devices, deviceAddress)
+			}
+		}()
+
+		for {
+			var msg Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return err
+			}
+			if msg.Type != MessageMeasure || msg.Value == nil || len(msg.DeviceAddress) == 0 {
+				continue
+			}
+
+			h.mutex.Lock()
+			if msg.DeviceAddress != deviceAddress {
+				if h.devices[deviceAddress] == conn {
+					delete(h.devices, deviceAddress)
+				}
+				deviceAddress = msg.DeviceAddress
+				h.devices[deviceAddress] = conn
+			}
+			onMeasure := h.onMeasure
+			h.mutex.Unlock()
+
+			if h.stream != nil {
+				h.stream.Publish(deviceAddress, msg.Value)
+			}
+			if onMeasure != nil {
+				onMeasure(deviceAddress, *msg.Value)
+			}
+		}
+	}
+}
+
+// ###########################################################################
+
+// Connect runs dev against the hub at url. It sends a value every interval
+// of the device and applies the translate commands it receives, until ctx
+// is done or the connection fails.
+func Connect(ctx context.Context, url string, dev device.IDevice) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var mutex sync.Mutex
+	errs := make(chan error, 1)
+
+	go func() {
+		for {
+			var msg Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				errs <- err
+				return
+			}
+			if msg.Type == MessageTranslate && msg.Translate != nil {
+				mutex.Lock()
+				dev.TranslateValue(*msg.Translate)
+				mutex.Unlock()
+			}
+		}
+	}()
+
+	interval := time.Duration(dev.GetInterval()) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case <-ticker.C:
+			var value devicevalue.DeviceValue
+			mutex.Lock()
+			dev.Simulate()
+			dev.FillDeviceValue(&value)
+			mutex.Unlock()
+
+			if err := conn.WriteJSON(&Message{Type: MessageMeasure, DeviceAddress: dev.GetDeviceAddress(), Value: &value}); err != nil {
+				return err
+			}
+		}
+	}
+}
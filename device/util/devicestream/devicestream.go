@@ -0,0 +1,208 @@
+package devicestream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/com-gft-tsbo-source/go-common/device/implementation/devicevalue"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher"
+)
+
+// ###########################################################################
+// ###########################################################################
+// ###########################################################################
+// ###########################################################################
+// ###########################################################################
+
+// EventMeasure is the event type of device values
+const EventMeasure = "measure"
+
+// subscriberBuffer is the number of events a subscriber may lag behind. A
+// subscriber lagging further is dropped, its client reconnects and resumes.
+const subscriberBuffer = 64
+
+// ErrLagged is returned by Watch if the watcher lagged behind and was
+// dropped. It resumes by watching again after the last event it got.
+var ErrLagged = errors.New("the watcher lagged behind the stream")
+
+// DeviceEvent is the data of a measure event
+type DeviceEvent struct {
+	DeviceAddress string `json:"address"`
+	devicevalue.DeviceValue
+}
+
+// ---------------------------------------------------------------------------
+
+// DeviceStream publishes the values of devices as Server-Sent Events. Clients
+// subscribe to some device addresses, or to all devices. Recent events are
+// kept, so that reconnecting clients resume after their Last-Event-ID.
+type DeviceStream struct {
+	mutex       sync.Mutex
+	sequence    uint64
+	history     []*event
+	size        int
+	subscribers map[*subscriber]struct{}
+}
+
+// ---------------------------------------------------------------------------
+
+// IDeviceStream ...
+type IDeviceStream interface {
+	Publish(deviceAddress string, value devicevalue.IDeviceValue)
+	Watch(ctx context.Context, addresses []string, lastEventID string, fn func(*dispatcher.Event) error) error
+	Handler() dispatcher.EventHandler
+}
+
+// ---------------------------------------------------------------------------
+
+type event struct {
+	sequence      uint64
+	deviceAddress string
+	event         *dispatcher.Event
+}
+
+type subscriber struct {
+	addresses map[string]bool
+	events    chan *dispatcher.Event
+}
+
+// ###########################################################################
+
+// InitDeviceStream creates a stream keeping the last history events
+func InitDeviceStream(s *DeviceStream, history int) {
+	s.sequence = 0
+	s.history = nil
+	s.size = history
+	s.subscribers = map[*subscriber]struct{}{}
+}
+
+// ###########################################################################
+
+// Publish sends a value of a device to its subscribers
+func (s *DeviceStream) Publish(deviceAddress string, value devicevalue.IDeviceValue) {
+	var data DeviceEvent
+	data.DeviceAddress = deviceAddress
+	devicevalue.InitFromDeviceValue(&data.DeviceValue, value)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sequence++
+	e := &event{
+		sequence:      s.sequence,
+		deviceAddress: deviceAddress,
+		event:         &dispatcher.Event{ID: strconv.FormatUint(s.sequence, 10), Event: EventMeasure, Data: data},
+	}
+
+	if s.size > 0 {
+		s.history = append(s.history, e)
+		if len(s.history) > s.size {
+			s.history = s.history[len(s.history)-s.size:]
+		}
+	}
+
+	for sub := range s.subscribers {
+		if !sub.wants(deviceAddress) {
+			continue
+		}
+		select {
+		case sub.events <- e.event:
+		default:
+			close(sub.events)
+			delete(s.subscribers, sub)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// Watch calls fn with the events of the devices at addresses, or of all
+// devices if none are given, starting with the kept ones after lastEventID.
+// It returns when ctx is done or fn fails, and ErrLagged if the watcher
+// lagged behind.
+func (s *DeviceStream) Watch(ctx context.Context, addresses []string, lastEventID string, fn func(*dispatcher.Event) error) error {
+	sub, replay := s.subscribe(addresses, lastEventID)
+	defer s.unsubscribe(sub)
+
+	for _, e := range replay {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e, ok := <-sub.events:
+			if !ok {
+				return ErrLagged
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// Handler returns the handler of the stream. Devices are selected by
+// 'address' query parameters, all devices are sent if none is selected.
+// Lagging clients are disconnected, they reconnect with their Last-Event-ID.
+func (s *DeviceStream) Handler() dispatcher.EventHandler {
+	return func(stream *dispatcher.EventStream, r *http.Request) error {
+		err := s.Watch(r.Context(), r.URL.Query()["address"], stream.LastEventID, stream.Send)
+		if err == ErrLagged {
+			return nil
+		}
+		return err
+	}
+}
+
+// ###########################################################################
+
+// subscribe registers a subscriber and returns the kept events after
+// lastEventID it wants
+func (s *DeviceStream) subscribe(addresses []string, lastEventID string) (*subscriber, []*dispatcher.Event) {
+	sub := &subscriber{addresses: map[string]bool{}, events: make(chan *dispatcher.Event, subscriberBuffer)}
+	for _, address := range addresses {
+		sub.addresses[address] = true
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var replay []*dispatcher.Event
+	if last, err := strconv.ParseUint(lastEventID, 10, 64); err == nil {
+		// An id ahead of the stream was sent before the service restarted
+		if last > s.sequence {
+			last = 0
+		}
+		for _, e := range s.history {
+			if e.sequence > last && sub.wants(e.deviceAddress) {
+				replay = append(replay, e.event)
+			}
+		}
+	}
+
+	s.subscribers[sub] = struct{}{}
+	return sub, replay
+}
+
+// ---------------------------------------------------------------------------
+
+func (s *DeviceStream) unsubscribe(sub *subscriber) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.subscribers, sub)
+}
+
+// ---------------------------------------------------------------------------
+
+func (sub *subscriber) wants(deviceAddress string) bool {
+	return len(sub.addresses) == 0 || sub.addresses[deviceAddress]
+}
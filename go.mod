@@ -3,11 +3,21 @@ module github.com/com-gft-tsbo-source/go-common
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.2.1
+	github.com/andybalholm/brotli v1.0.4
 	github.com/boltdb/bolt v1.3.1
+	github.com/fxamacker/cbor/v2 v2.3.0
 	github.com/gocql/gocql v0.0.0-20211015133455-b225f9b53fa1
+	github.com/gorilla/websocket v1.4.2
+	github.com/klauspost/compress v1.13.6
 	github.com/lib/pq v1.10.4
 	github.com/mattn/go-sqlite3 v1.14.9
 	github.com/prometheus/client_golang v1.11.0
+	github.com/prometheus/client_model v0.2.0
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 	golang.org/x/crypto v0.0.0-20211115234514-b4de73f9ece8
 	golang.org/x/net v0.0.0-20211116231205-47ca1ff31462
+	google.golang.org/grpc v1.42.0
+	google.golang.org/protobuf v1.26.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,465 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/discovery"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Client side load balancing
+// ###########################################################################
+// ###########################################################################
+
+// Requests to 'service://name/path' are sent to an endpoint of the service
+// 'name', resolved by a discovery and picked by the policy:
+//
+//	roundrobin      the endpoints in turn
+//	leastrequests   the endpoint with the fewest requests in progress
+//	hash            the endpoint of the hash of a request header on a
+//	                consistent hash ring, so the same key sticks to the same
+//	                endpoint while endpoints come and go
+//
+// Endpoints failing MaxFailures times in a row, with an error or a 5xx
+// status, are ejected for EjectTime. Ejected endpoints are probed through
+// their /status and come back as soon as they answer it. If all endpoints
+// of a service are ejected, all of them are used.
+//
+// Requests to other URLs are passed on unchanged.
+
+// Scheme is the URL scheme of balanced requests
+const Scheme = "service"
+
+// Policies of picking an endpoint
+const (
+	PolicyRoundRobin    = "roundrobin"
+	PolicyLeastRequests = "leastrequests"
+	PolicyHash          = "hash"
+)
+
+// Options of a Balancer, zero values are replaced by the defaults
+type Options struct {
+	Policy          string
+	HashHeader      string
+	MaxFailures     int
+	EjectTime       time.Duration
+	ProbeInterval   time.Duration
+	ProbePath       string
+	ResolveInterval time.Duration
+	Logger          *log.Logger
+}
+
+// DefaultOptions are used for options which are not set
+var DefaultOptions = Options{
+	Policy:          PolicyRoundRobin,
+	HashHeader:      "X-Session-Id",
+	MaxFailures:     5,
+	EjectTime:       30 * time.Second,
+	ProbeInterval:   5 * time.Second,
+	ProbePath:       "/status",
+	ResolveInterval: 5 * time.Second,
+}
+
+// ---------------------------------------------------------------------------
+
+// Balancer is an http.RoundTripper balancing requests across the endpoints
+// of services
+type Balancer struct {
+	discovery discovery.Discovery
+	transport http.RoundTripper
+	options   Options
+
+	mutex   sync.Mutex
+	pools   map[string]*pool
+	closed  chan struct{}
+	probing sync.Once
+	closing sync.Once
+}
+
+// endpoint is an endpoint with its state
+type endpoint struct {
+	url          string
+	outstanding  int64
+	failures     int
+	ejectedUntil time.Time
+}
+
+// pool holds the endpoints of a service
+type pool struct {
+	mutex     sync.Mutex
+	service   string
+	endpoints []*endpoint
+	ring      *ring
+	next      int
+	resolved  time.Time
+}
+
+// ###########################################################################
+
+// URL returns the balanced URL of path at service
+func URL(service string, path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return fmt.Sprintf("%s://%s%s", Scheme, service, path)
+}
+
+// ---------------------------------------------------------------------------
+
+// New creates a balancer resolving services with d and sending requests
+// with transport, http.DefaultTransport if it is nil
+func New(d discovery.Discovery, transport http.RoundTripper, options Options) *Balancer {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	if len(options.Policy) == 0 {
+		options.Policy = DefaultOptions.Policy
+	}
+	if len(options.HashHeader) == 0 {
+		options.HashHeader = DefaultOptions.HashHeader
+	}
+	if options.MaxFailures == 0 {
+		options.MaxFailures = DefaultOptions.MaxFailures
+	}
+	if options.EjectTime == 0 {
+		options.EjectTime = DefaultOptions.EjectTime
+	}
+	if options.ProbeInterval == 0 {
+		options.ProbeInterval = DefaultOptions.ProbeInterval
+	}
+	if len(options.ProbePath) == 0 {
+		options.ProbePath = DefaultOptions.ProbePath
+	}
+	if options.ResolveInterval == 0 {
+		options.ResolveInterval = DefaultOptions.ResolveInterval
+	}
+
+	return &Balancer{
+		discovery: d,
+		transport: transport,
+		options:   options,
+		pools:     map[string]*pool{},
+		closed:    make(chan struct{}),
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// Transport returns the transport requests are sent with
+func (b *Balancer) Transport() http.RoundTripper {
+	return b.transport
+}
+
+// ---------------------------------------------------------------------------
+
+// Close stops probing ejected endpoints
+func (b *Balancer) Close() {
+	b.closing.Do(func() { close(b.closed) })
+}
+
+// ---------------------------------------------------------------------------
+
+// RoundTrip sends a request to 'service://name/path' to an endpoint of
+// 'name', other requests unchanged
+func (b *Balancer) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Scheme != Scheme {
+		return b.transport.RoundTrip(r)
+	}
+
+	p, err := b.pool(r.Context(), r.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	e := p.pick(b.options, r)
+	if e == nil {
+		return nil, fmt.Errorf("%w '%s'", discovery.ErrUnknownService, p.service)
+	}
+
+	out, err := rewrite(r, e.url)
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&e.outstanding, 1)
+	response, err := b.transport.RoundTrip(out)
+
+	failed := err != nil || response.StatusCode >= http.StatusInternalServerError
+	if ejected := p.report(e, failed, b.options); ejected {
+		b.logf("Ejecting endpoint '%s' of service '%s' after %d failures.", e.url, p.service, b.options.MaxFailures)
+	}
+
+	// The body of an upgraded connection must stay writable, it is not
+	// tracked
+	if err != nil || response.StatusCode == http.StatusSwitchingProtocols {
+		atomic.AddInt64(&e.outstanding, -1)
+		return response, err
+	}
+
+	// The request is in progress until its body is read
+	response.Body = &trackedBody{ReadCloser: response.Body, done: func() { atomic.AddInt64(&e.outstanding, -1) }}
+	return response, nil
+}
+
+// ###########################################################################
+
+// pool returns the pool of service, resolved again after ResolveInterval
+func (b *Balancer) pool(ctx context.Context, service string) (*pool, error) {
+	b.mutex.Lock()
+	p, found := b.pools[service]
+	if !found {
+		p = &pool{service: service}
+		b.pools[service] = p
+	}
+	b.mutex.Unlock()
+
+	b.probing.Do(func() { go b.probe() })
+
+	p.mutex.Lock()
+	stale := time.Since(p.resolved) > b.options.ResolveInterval
+	empty := len(p.endpoints) == 0
+	p.mutex.Unlock()
+
+	if !stale {
+		return p, nil
+	}
+
+	endpoints, err := b.discovery.Resolve(ctx, service)
+	if err != nil {
+		// Keep using the known endpoints if the discovery fails
+		if !empty && !errors.Is(err, discovery.ErrUnknownService) {
+			b.logf("Could not resolve service '%s', keeping its endpoints. Error was '%s'.", service, err.Error())
+			return p, nil
+		}
+		return nil, err
+	}
+
+	p.update(endpoints)
+	return p, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// probe checks the ejected endpoints every ProbeInterval until the balancer
+// is closed
+func (b *Balancer) probe() {
+	ticker := time.NewTicker(b.options.ProbeInterval)
+	defer ticker.Stop()
+
+	client := &http.Client{Transport: b.transport, Timeout: b.options.ProbeInterval}
+
+	for {
+		select {
+		case <-b.closed:
+			return
+		case <-ticker.C:
+		}
+
+		b.mutex.Lock()
+		pools := make([]*pool, 0, len(b.pools))
+		for _, p := range b.pools {
+			pools = append(pools, p)
+		}
+		b.mutex.Unlock()
+
+		for _, p := range pools {
+			for _, e := range p.ejected() {
+				response, err := client.Get(fmt.Sprintf("%s%s", e.url, b.options.ProbePath))
+				if err != nil {
+					continue
+				}
+				io.Copy(ioutil.Discard, response.Body)
+				response.Body.Close()
+
+				if response.StatusCode < http.StatusMultipleChoices {
+					p.restore(e)
+					b.logf("Endpoint '%s' of service '%s' answered its probe, using it again.", e.url, p.service)
+				}
+			}
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func (b *Balancer) logf(format string, v ...interface{}) {
+	if b.options.Logger != nil {
+		b.options.Logger.Println(fmt.Sprintf(format, v...))
+	}
+}
+
+// ###########################################################################
+
+// update replaces the endpoints, keeping the state of the known ones
+func (p *pool) update(endpoints []discovery.Endpoint) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	known := map[string]*endpoint{}
+	for _, e := range p.endpoints {
+		known[e.url] = e
+	}
+
+	var updated []*endpoint
+	for _, de := range endpoints {
+		e, found := known[de.URL]
+		if !found {
+			e = &endpoint{url: de.URL}
+		}
+		updated = append(updated, e)
+	}
+
+	p.endpoints = updated
+	p.ring = newRing(updated)
+	p.resolved = time.Now()
+}
+
+// ---------------------------------------------------------------------------
+
+// pick chooses an endpoint by the policy among the available ones
+func (p *pool) pick(options Options, r *http.Request) *endpoint {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+	available := make([]*endpoint, 0, len(p.endpoints))
+	for _, e := range p.endpoints {
+		if now.After(e.ejectedUntil) {
+			available = append(available, e)
+		}
+	}
+	if len(available) == 0 {
+		available = p.endpoints
+	}
+	if len(available) == 0 {
+		return nil
+	}
+
+	switch options.Policy {
+	case PolicyLeastRequests:
+		var best *endpoint
+		for i := range available {
+			// Start at the next endpoint, so ties are spread
+			e := available[(p.next+i)%len(available)]
+			if best == nil || atomic.LoadInt64(&e.outstanding) < atomic.LoadInt64(&best.outstanding) {
+				best = e
+			}
+		}
+		p.next++
+		return best
+	case PolicyHash:
+		key := r.Header.Get(options.HashHeader)
+		if len(key) == 0 {
+			key = r.URL.Path
+		}
+		usable := map[*endpoint]bool{}
+		for _, e := range available {
+			usable[e] = true
+		}
+		return p.ring.get(key, usable)
+	}
+
+	e := available[p.next%len(available)]
+	p.next++
+	return e
+}
+
+// ---------------------------------------------------------------------------
+
+// report counts the result of a request and reports if it ejected e
+func (p *pool) report(e *endpoint, failed bool, options Options) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !failed {
+		e.failures = 0
+		return false
+	}
+
+	e.failures++
+	if e.failures < options.MaxFailures || time.Now().Before(e.ejectedUntil) {
+		return false
+	}
+	e.ejectedUntil = time.Now().Add(options.EjectTime)
+	return true
+}
+
+// ---------------------------------------------------------------------------
+
+// ejected returns the ejected endpoints
+func (p *pool) ejected() []*endpoint {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var ejected []*endpoint
+	now := time.Now()
+	for _, e := range p.endpoints {
+		if now.Before(e.ejectedUntil) {
+			ejected = append(ejected, e)
+		}
+	}
+	return ejected
+}
+
+// ---------------------------------------------------------------------------
+
+// restore makes an ejected endpoint available again
+func (p *pool) restore(e *endpoint) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	e.failures = 0
+	e.ejectedUntil = time.Time{}
+}
+
+// ###########################################################################
+
+// rewrite returns a copy of r sent to path at the endpoint base
+func rewrite(r *http.Request, base string) (*http.Request, error) {
+	target, err := r.URL.Parse(base + r.URL.EscapedPath())
+	if err != nil {
+		return nil, err
+	}
+	target.RawQuery = r.URL.RawQuery
+	target.Fragment = ""
+
+	out := r.Clone(r.Context())
+	out.URL = target
+	out.Host = ""
+	return out, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// trackedBody calls done once the body is read or closed
+type trackedBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+// Read ...
+func (b *trackedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.once.Do(b.done)
+	}
+	return n, err
+}
+
+// Close ...
+func (b *trackedBody) Close() error {
+	b.once.Do(b.done)
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,244 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/discovery"
+)
+
+// upstream is an endpoint replying with its name, or with a 500 while it
+// is failing
+type upstream struct {
+	name    string
+	failing int32
+	server  *httptest.Server
+}
+
+func newUpstream(t *testing.T, name string) *upstream {
+	u := &upstream{name: name}
+	u.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&u.failing) != 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		fmt.Fprint(w, u.name)
+	}))
+	t.Cleanup(u.server.Close)
+	return u
+}
+
+func (u *upstream) fail(failing bool) {
+	var v int32
+	if failing {
+		v = 1
+	}
+	atomic.StoreInt32(&u.failing, v)
+}
+
+// newBalancer balances the service 'svc' across upstreams
+func newBalancer(t *testing.T, options Options, upstreams ...*upstream) (*Balancer, *discovery.Registry) {
+	registry := discovery.NewRegistry()
+	for _, u := range upstreams {
+		registry.Register(context.Background(), discovery.Endpoint{Service: "svc", Instance: u.name, URL: u.server.URL})
+	}
+	b := New(registry, nil, options)
+	t.Cleanup(b.Close)
+	return b, registry
+}
+
+// get sends a balanced request and returns the name of the upstream
+func get(t *testing.T, b *Balancer, path string, header ...string) string {
+	t.Helper()
+
+	r, _ := http.NewRequest(http.MethodGet, URL("svc", path), nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	response, err := (&http.Client{Transport: b}).Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	return string(body)
+}
+
+// ###########################################################################
+
+func TestPolicies(t *testing.T) {
+	a, b, c := newUpstream(t, "a"), newUpstream(t, "b"), newUpstream(t, "c")
+
+	tests := []struct {
+		policy string
+		header []string
+		want   []string
+	}{
+		{PolicyRoundRobin, nil, []string{"a", "b", "c", "a", "b", "c"}},
+		{PolicyLeastRequests, nil, []string{"a", "b", "c", "a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			balancer, _ := newBalancer(t, Options{Policy: tt.policy}, a, b, c)
+			for i, want := range tt.want {
+				if got := get(t, balancer, "/", tt.header...); got != want {
+					t.Errorf("request %d: %s != %s", i, got, want)
+				}
+			}
+		})
+	}
+
+	t.Run(PolicyHash, func(t *testing.T) {
+		balancer, registry := newBalancer(t, Options{Policy: PolicyHash, ResolveInterval: time.Nanosecond}, a, b, c)
+
+		keys := map[string]string{}
+		for i := 0; i < 30; i++ {
+			key := fmt.Sprintf("session-%d", i)
+			keys[key] = get(t, balancer, "/", "X-Session-Id", key)
+			if again := get(t, balancer, "/other", "X-Session-Id", key); again != keys[key] {
+				t.Errorf("%s: %s != %s", key, again, keys[key])
+			}
+		}
+
+		// Only the keys of a removed endpoint move
+		registry.Deregister(context.Background(), discovery.Endpoint{Service: "svc", URL: c.server.URL})
+		for key, name := range keys {
+			got := get(t, balancer, "/", "X-Session-Id", key)
+			if (name != "c" && got != name) || got == "c" {
+				t.Errorf("%s: %s, was %s", key, got, name)
+			}
+		}
+	})
+}
+
+// ---------------------------------------------------------------------------
+
+func TestLeastRequests(t *testing.T) {
+	a, b := newUpstream(t, "a"), newUpstream(t, "b")
+	balancer, _ := newBalancer(t, Options{Policy: PolicyLeastRequests}, a, b)
+
+	// A request is in progress on a until its body is read
+	r, _ := http.NewRequest(http.MethodGet, URL("svc", "/"), nil)
+	held, err := balancer.RoundTrip(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := get(t, balancer, "/"); got != "b" {
+			t.Errorf("request %d: %s != b", i, got)
+		}
+	}
+
+	ioutil.ReadAll(held.Body)
+	held.Body.Close()
+
+	names := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		names[get(t, balancer, "/")] = true
+	}
+	if !names["a"] || !names["b"] {
+		t.Errorf("requests are not spread after the body was read: %v", names)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestEjection(t *testing.T) {
+	a, b := newUpstream(t, "a"), newUpstream(t, "b")
+	balancer, _ := newBalancer(t, Options{MaxFailures: 2, EjectTime: time.Minute, ProbeInterval: 10 * time.Millisecond}, a, b)
+
+	b.fail(true)
+	for i := 0; i < 4; i++ {
+		get(t, balancer, "/")
+	}
+
+	for i := 0; i < 4; i++ {
+		if got := get(t, balancer, "/"); got != "a" {
+			t.Fatalf("request %d went to the ejected endpoint %s", i, got)
+		}
+	}
+
+	// If all endpoints are ejected, all of them are used
+	a.fail(true)
+	for i := 0; i < 4; i++ {
+		get(t, balancer, "/")
+	}
+	names := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		names[get(t, balancer, "/")] = true
+	}
+	if !names["a"] || !names["b"] {
+		t.Errorf("all endpoints ejected: only %v are used", names)
+	}
+
+	// Probes bring endpoints back before EjectTime
+	a.fail(false)
+	b.fail(false)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		p, _ := balancer.pool(context.Background(), "svc")
+		if len(p.ejected()) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the endpoints were not restored by their probes")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestRoundTrip(t *testing.T) {
+	a := newUpstream(t, "a")
+	balancer, _ := newBalancer(t, Options{}, a)
+
+	// Other URLs are passed on unchanged
+	response, err := (&http.Client{Transport: balancer}).Get(a.server.URL + "/direct")
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("direct request: %v, %v", response, err)
+	}
+	response.Body.Close()
+
+	r, _ := http.NewRequest(http.MethodGet, URL("missing", "/"), nil)
+	if _, err := balancer.RoundTrip(r); !errors.Is(err, discovery.ErrUnknownService) {
+		t.Errorf("unknown service: %v", err)
+	}
+
+	if u := URL("svc", "path?q=1"); u != "service://svc/path?q=1" {
+		t.Errorf("URL: %s", u)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		target string
+		base   string
+		want   string
+	}{
+		{"service://svc/", "http://a:8080", "http://a:8080/"},
+		{"service://svc/items/1?q=1#frag", "http://a:8080", "http://a:8080/items/1?q=1"},
+		{"service://svc/a%2Fb", "http://a:8080/prefix", "http://a:8080/prefix/a%2Fb"},
+	}
+
+	for _, tt := range tests {
+		r, _ := http.NewRequest(http.MethodGet, tt.target, nil)
+		out, err := rewrite(r, tt.base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.URL.String() != tt.want || len(out.Host) > 0 {
+			t.Errorf("%s: %s (host '%s') != %s", tt.target, out.URL.String(), out.Host, tt.want)
+		}
+	}
+}
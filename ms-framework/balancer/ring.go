@@ -0,0 +1,64 @@
+package balancer
+
+import (
+	"fmt"
+	"hash/crc32"
+	"sort"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Consistent hash ring
+// ###########################################################################
+// ###########################################################################
+
+// replicas is the number of points of an endpoint on the ring, which spread
+// the keys evenly
+const replicas = 100
+
+// ring places the endpoints at the hashes of their URLs. A key belongs to
+// the first endpoint at or after its hash, so adding or removing an
+// endpoint only moves the keys next to its points.
+type ring struct {
+	hashes    []uint32
+	endpoints map[uint32]*endpoint
+}
+
+// ###########################################################################
+
+// newRing creates the ring of endpoints
+func newRing(endpoints []*endpoint) *ring {
+	r := &ring{endpoints: map[uint32]*endpoint{}}
+	for _, e := range endpoints {
+		for i := 0; i < replicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%d-%s", i, e.url)))
+			if _, found := r.endpoints[hash]; found {
+				continue
+			}
+			r.endpoints[hash] = e
+			r.hashes = append(r.hashes, hash)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// ---------------------------------------------------------------------------
+
+// get returns the endpoint of key, skipping the ones which are not usable
+func (r *ring) get(key string, usable map[*endpoint]bool) *endpoint {
+	if len(r.hashes) == 0 {
+		return nil
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+
+	for i := 0; i < len(r.hashes); i++ {
+		e := r.endpoints[r.hashes[(start+i)%len(r.hashes)]]
+		if usable[e] {
+			return e
+		}
+	}
+	return nil
+}
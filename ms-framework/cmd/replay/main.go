@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/recorder"
+)
+
+// ###########################################################################
+// ###########################################################################
+// replay sends recorded requests to a service and reports the replies
+// differing from the recorded ones:
+//
+//	replay -target http://localhost:8080 [-header 'Authorization: Basic ...']
+//	       [-ignoreheader X-Version] [-ignorefield trace] recording.jsonl ...
+//
+// It exits with 1 if any reply differs.
+// ###########################################################################
+// ###########################################################################
+
+// stringList collects repeated flags
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(s string) error { *l = append(*l, s); return nil }
+
+func main() {
+	var headers, ignoreHeaders, ignoreFields stringList
+
+	flagset := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	target := flagset.String("target", "", "Base URL of the service to replay the requests to.")
+	timeout := flagset.Int("timeout", 10000, "Timeout of each request in ms.")
+	verbose := flagset.Bool("verbose", false, "Report matching replies too.")
+	flagset.Var(&headers, "header", "Send this header ('Key: value') with each request, e.g. credentials which were redacted.")
+	flagset.Var(&ignoreHeaders, "ignoreheader", "Do not compare this reply header.")
+	flagset.Var(&ignoreFields, "ignorefield", "Do not compare this JSON field, a path like 'trace.hostname' or a name.")
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: %s -target URL [options] recording ...\n", os.Args[0])
+		flagset.PrintDefaults()
+	}
+	flagset.Parse(os.Args[1:])
+
+	if len(*target) == 0 || flagset.NArg() == 0 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	replayer := &recorder.Replayer{
+		BaseURL:       *target,
+		Client:        &http.Client{Timeout: time.Duration(*timeout) * time.Millisecond},
+		Header:        http.Header{},
+		IgnoreHeaders: ignoreHeaders,
+		IgnoreFields:  ignoreFields,
+	}
+	for _, header := range headers {
+		kv := strings.SplitN(header, ":", 2)
+		if len(kv) != 2 {
+			fmt.Fprintf(os.Stderr, "Header '%s' is not like 'Key: value'.\n", header)
+			os.Exit(2)
+		}
+		replayer.Header.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+
+	total, failed := 0, 0
+	for _, filename := range flagset.Args() {
+		entries, err := recorder.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read recording '%s', error was '%s'!\n", filename, err.Error())
+			os.Exit(2)
+		}
+
+		for _, result := range replayer.Replay(context.Background(), entries) {
+			total++
+			path := result.Entry.Request.URL
+			if u, err := url.Parse(path); err == nil {
+				path = u.RequestURI()
+			}
+			line := fmt.Sprintf("%-6s %s -> %d (%.1fms, recorded %d in %.1fms)", result.Entry.Request.Method, path, result.Status, result.Duration, result.Entry.Response.Status, result.Entry.Duration)
+
+			switch {
+			case result.Err != nil:
+				failed++
+				fmt.Printf("FAIL %s: %s\n", line, result.Err.Error())
+			case !result.OK():
+				failed++
+				fmt.Printf("DIFF %s\n", line)
+				for _, diff := range result.Diffs {
+					fmt.Printf("       %s\n", diff)
+				}
+			case *verbose:
+				fmt.Printf("OK   %s\n", line)
+			}
+		}
+	}
+
+	fmt.Printf("%d of %d replies matched.\n", total-failed, total)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
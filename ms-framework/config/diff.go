@@ -0,0 +1,107 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Configuration changes
+// ###########################################################################
+// ###########################################################################
+
+// Change describes a value which differs between a live and a reloaded
+// configuration. Safe changes are tagged 'reload:"safe"' and may be applied
+// to a running service, all others require a restart.
+type Change struct {
+	Key  string
+	Safe bool
+	Old  interface{}
+	New  interface{}
+
+	live   reflect.Value
+	loaded reflect.Value
+}
+
+// ---------------------------------------------------------------------------
+
+// Apply sets the live value to the reloaded one
+func (c *Change) Apply() {
+	c.live.Set(c.loaded)
+}
+
+// ###########################################################################
+
+// Diff compares two configuration structs of the same type field by field.
+// Fields are named by their configuration file keys, prefixed with section if
+// it is not empty.
+func Diff(section string, live interface{}, loaded interface{}) []Change {
+	lv := reflect.ValueOf(live)
+	nv := reflect.ValueOf(loaded)
+
+	if lv.Kind() != reflect.Ptr || nv.Kind() != reflect.Ptr || lv.Type() != nv.Type() || lv.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	prefix := ""
+	if len(section) > 0 {
+		prefix = section + "."
+	}
+
+	var changes []Change
+	diffStruct(lv.Elem(), nv.Elem(), prefix, &changes)
+	return changes
+}
+
+// ---------------------------------------------------------------------------
+
+func diffStruct(lv reflect.Value, nv reflect.Value, prefix string, changes *[]Change) {
+	rt := lv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			diffStruct(lv.Field(i), nv.Field(i), prefix, changes)
+			continue
+		}
+
+		jsonName := strings.Split(sf.Tag.Get("json"), ",")[0]
+		flagName, hasFlag := sf.Tag.Lookup("flag")
+
+		if jsonName == "-" && !hasFlag {
+			continue
+		}
+
+		key := jsonName
+		if key == "-" {
+			key = flagName
+		}
+		if len(key) == 0 {
+			key = strings.ToLower(sf.Name)
+		}
+
+		if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+			diffStruct(lv.Field(i), nv.Field(i), prefix+key+".", changes)
+			continue
+		}
+
+		if reflect.DeepEqual(lv.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+
+		*changes = append(*changes, Change{
+			Key:    prefix + key,
+			Safe:   sf.Tag.Get("reload") == "safe",
+			Old:    lv.Field(i).Interface(),
+			New:    nv.Field(i).Interface(),
+			live:   lv.Field(i),
+			loaded: nv.Field(i),
+		})
+	}
+}
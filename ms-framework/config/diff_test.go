@@ -0,0 +1,95 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+// DiffEmbedded is exported, Diff skips unexported embedded structs
+type DiffEmbedded struct {
+	Delay int `json:"delay" reload:"safe"`
+}
+
+type diffConfiguration struct {
+	DiffEmbedded
+	File     string     `json:"-" flag:"config"`
+	Internal string     `json:"-"`
+	Port     int        `json:"port"`
+	Headers  []string   `json:"headers" reload:"safe"`
+	Nested   testNested `json:"nested"`
+	Plain    string
+	hidden   string
+}
+
+// ---------------------------------------------------------------------------
+
+func TestDiff(t *testing.T) {
+	live := diffConfiguration{Port: 80, Headers: []string{"A: 1"}, hidden: "a"}
+	live.Delay = 1
+	loaded := live
+	loaded.hidden = "b"
+
+	if changes := Diff("", &live, &loaded); len(changes) != 0 {
+		t.Fatalf("equal configurations: %+v", changes)
+	}
+
+	loaded.Delay = 2
+	loaded.File = "other.yaml"
+	loaded.Internal = "x"
+	loaded.Port = 8080
+	loaded.Headers = []string{"A: 1", "B: 2"}
+	loaded.Nested.Level = 3
+	loaded.Plain = "p"
+
+	changes := Diff("svc", &live, &loaded)
+
+	want := []struct {
+		key  string
+		safe bool
+		old  interface{}
+		new  interface{}
+	}{
+		{"svc.delay", true, 1, 2},
+		{"svc.config", false, "", "other.yaml"},
+		{"svc.port", false, 80, 8080},
+		{"svc.headers", true, []string{"A: 1"}, []string{"A: 1", "B: 2"}},
+		{"svc.nested.level", false, 0, 3},
+		{"svc.plain", false, "", "p"},
+	}
+
+	if len(changes) != len(want) {
+		t.Fatalf("changes: %+v", changes)
+	}
+	for i, w := range want {
+		c := changes[i]
+		if c.Key != w.key || c.Safe != w.safe || !reflect.DeepEqual(c.Old, w.old) || !reflect.DeepEqual(c.New, w.new) {
+			t.Errorf("change %d: %+v, want %+v", i, c, w)
+		}
+	}
+
+	for i := range changes {
+		if changes[i].Safe {
+			changes[i].Apply()
+		}
+	}
+	if live.Delay != 2 || len(live.Headers) != 2 || live.Port != 80 || live.Nested.Level != 0 {
+		t.Errorf("applied: %+v", live)
+	}
+	if changes := Diff("", &live, &loaded); len(changes) != 4 {
+		t.Errorf("after apply: %+v", changes)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestDiffTypes(t *testing.T) {
+	live := diffConfiguration{Port: 1}
+	other := testConfiguration{Port: 2}
+
+	if changes := Diff("", &live, &other); changes != nil {
+		t.Errorf("different types: %+v", changes)
+	}
+	if changes := Diff("", live, live); changes != nil {
+		t.Errorf("no pointers: %+v", changes)
+	}
+}
@@ -0,0 +1,356 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/secret"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Configuration fields
+// ###########################################################################
+// ###########################################################################
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field describes a single configurable value of a configuration struct
+type field struct {
+	name     string
+	key      string
+	flagName string
+	envName  string
+	help     string
+	def      string
+	preset   string
+	sep      string
+	secret   bool
+	envSet   bool
+	rules    string
+	value    reflect.Value
+	flagRaw  []string
+	given    bool
+}
+
+// ---------------------------------------------------------------------------
+
+// flagValue exposes a field as flag.Value. Values are checked when the flag is
+// parsed, but only applied to the field once all other sources are loaded.
+type flagValue struct {
+	f *field
+}
+
+func (v *flagValue) String() string {
+	if v == nil || v.f == nil {
+		return ""
+	}
+	if len(v.f.def) > 0 {
+		return v.f.def
+	}
+	return v.f.preset
+}
+
+func (v *flagValue) Set(s string) error {
+	resolved, err := secret.Resolve(s)
+	if err != nil {
+		return err
+	}
+	if _, err := parseString(v.f.value.Type(), resolved, ""); err != nil {
+		return err
+	}
+	v.f.flagRaw = append(v.f.flagRaw, s)
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.f != nil && v.f.value.Kind() == reflect.Bool
+}
+
+// ###########################################################################
+
+// isSupported reports if values of type t can be configured
+func isSupported(t reflect.Type) bool {
+	if t == durationType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// ---------------------------------------------------------------------------
+
+// setString sets the field from its string representation as it is used in
+// defaults and environment variables.
+func (f *field) setString(s string) error {
+	s, err := secret.Resolve(s)
+	if err != nil {
+		return err
+	}
+	v, err := parseString(f.value.Type(), s, f.sep)
+	if err != nil {
+		return err
+	}
+	f.value.Set(v)
+	f.given = true
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+// setFlags sets the field from the values given on the command line. Lists
+// take all values of a repeated flag, other types the last one.
+func (f *field) setFlags() {
+	if len(f.flagRaw) == 0 {
+		return
+	}
+	f.given = true
+
+	if f.value.Kind() == reflect.Slice {
+		list := reflect.MakeSlice(f.value.Type(), 0, len(f.flagRaw))
+		for _, raw := range f.flagRaw {
+			raw, _ = secret.Resolve(raw)
+			list = reflect.Append(list, reflect.ValueOf(raw).Convert(f.value.Type().Elem()))
+		}
+		f.value.Set(list)
+		return
+	}
+
+	raw, _ := secret.Resolve(f.flagRaw[len(f.flagRaw)-1])
+	v, _ := parseString(f.value.Type(), raw, "")
+	f.value.Set(v)
+}
+
+// ---------------------------------------------------------------------------
+
+// parseString converts s to a value of type t. Lists are split at sep, if sep
+// is empty s is taken as a single element.
+func parseString(t reflect.Type, s string, sep string) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+
+	if t == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return v, fmt.Errorf("invalid duration '%s'", s)
+		}
+		v.SetInt(int64(d))
+		return v, nil
+	}
+
+	switch t.Kind() {
+
+	case reflect.String:
+		v.SetString(s)
+
+	case reflect.Bool:
+		b, err := parseBool(s)
+		if err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 0, t.Bits())
+		if err != nil {
+			return v, fmt.Errorf("invalid integer '%s'", s)
+		}
+		v.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 0, t.Bits())
+		if err != nil {
+			return v, fmt.Errorf("invalid unsigned integer '%s'", s)
+		}
+		v.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		fl, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return v, fmt.Errorf("invalid number '%s'", s)
+		}
+		v.SetFloat(fl)
+
+	case reflect.Slice:
+		parts := []string{s}
+		if len(sep) > 0 {
+			parts = strings.Split(s, sep)
+		}
+		for _, part := range parts {
+			part = strings.TrimSpace(part)
+			if len(part) == 0 {
+				continue
+			}
+			v = reflect.Append(v, reflect.ValueOf(part).Convert(t.Elem()))
+		}
+
+	default:
+		return v, fmt.Errorf("unsupported type %s", t)
+	}
+
+	return v, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// parseBool accepts yes/no and on/off besides the values of strconv.ParseBool
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "yes", "y", "on":
+		return true, nil
+	case "no", "n", "off":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(s))
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean '%s'", s)
+	}
+	return b, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// setRaw sets the field from a value decoded from a configuration file.
+// Values must already have the right type, strings are not converted to
+// numbers or booleans.
+func (f *field) setRaw(raw interface{}) error {
+	t := f.value.Type()
+	v := reflect.New(t).Elem()
+
+	if t == durationType {
+		s, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("expected a duration like '1.5s', got %s", describe(raw))
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration '%s'", s)
+		}
+		f.value.SetInt(int64(d))
+		f.given = true
+		return nil
+	}
+
+	switch t.Kind() {
+
+	case reflect.String:
+		s, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %s", describe(raw))
+		}
+		s, err := secret.Resolve(s)
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+
+	case reflect.Bool:
+		b, ok := raw.(bool)
+		if !ok {
+			return fmt.Errorf("expected a boolean, got %s", describe(raw))
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fl, ok := toNumber(raw)
+		if !ok || fl != math.Trunc(fl) {
+			return fmt.Errorf("expected an integer, got %s", describe(raw))
+		}
+		if v.OverflowInt(int64(fl)) {
+			return fmt.Errorf("integer %v out of range", raw)
+		}
+		v.SetInt(int64(fl))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		fl, ok := toNumber(raw)
+		if !ok || fl != math.Trunc(fl) || fl < 0 {
+			return fmt.Errorf("expected an unsigned integer, got %s", describe(raw))
+		}
+		if v.OverflowUint(uint64(fl)) {
+			return fmt.Errorf("integer %v out of range", raw)
+		}
+		v.SetUint(uint64(fl))
+
+	case reflect.Float32, reflect.Float64:
+		fl, ok := toNumber(raw)
+		if !ok {
+			return fmt.Errorf("expected a number, got %s", describe(raw))
+		}
+		v.SetFloat(fl)
+
+	case reflect.Slice:
+		list, ok := raw.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected a list of strings, got %s", describe(raw))
+		}
+		for i, entry := range list {
+			s, ok := entry.(string)
+			if !ok {
+				return fmt.Errorf("expected a string at index %d, got %s", i, describe(entry))
+			}
+			s, err := secret.Resolve(s)
+			if err != nil {
+				return fmt.Errorf("index %d: %s", i, err.Error())
+			}
+			v = reflect.Append(v, reflect.ValueOf(s).Convert(t.Elem()))
+		}
+
+	default:
+		return fmt.Errorf("unsupported type %s", t)
+	}
+
+	f.value.Set(v)
+	f.given = true
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+func toNumber(raw interface{}) (float64, bool) {
+	switch n := raw.(type) {
+	case json.Number:
+		fl, err := n.Float64()
+		return fl, err == nil
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// ---------------------------------------------------------------------------
+
+func describe(raw interface{}) string {
+	switch raw.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("string '%s'", raw)
+	case bool:
+		return fmt.Sprintf("boolean %v", raw)
+	case json.Number, int, int64, uint64, float64:
+		return fmt.Sprintf("number %v", raw)
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", raw)
+}
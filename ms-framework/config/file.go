@@ -0,0 +1,98 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Configuration files
+// ###########################################################################
+// ###########################################################################
+
+// ReadFile decodes a configuration file into a generic map. The format is
+// chosen by the extension: '.yaml' and '.yml' are read as YAML, '.toml' as
+// TOML and everything else as JSON.
+func ReadFile(filename string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+
+	case ".toml":
+		_, err = toml.Decode(string(data), &values)
+
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&values)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// applyFile sets all fields found in values. Nested objects are matched
+// against dotted keys. Unknown keys are reported as error.
+func (l *Loader) applyFile(values map[string]interface{}, prefix string) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		raw := values[key]
+		path := prefix + key
+
+		if f, exists := l.byKey[path]; exists {
+			if err := f.setRaw(raw); err != nil {
+				return fmt.Errorf("key '%s': %s", path, err.Error())
+			}
+			continue
+		}
+
+		if nested, ok := raw.(map[string]interface{}); ok && l.hasPrefix(path+".") {
+			if err := l.applyFile(nested, path+"."); err != nil {
+				return err
+			}
+			continue
+		}
+
+		return fmt.Errorf("unknown key '%s'", path)
+	}
+
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+func (l *Loader) hasPrefix(prefix string) bool {
+	for key := range l.byKey {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,397 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/secret"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/validate"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Configuration Loader
+// ###########################################################################
+// ###########################################################################
+
+// Loader fills configuration structs from several sources. Later sources
+// override earlier ones:
+//
+//	defaults < configuration file < environment variables < flags
+//
+// Fields are described by struct tags:
+//
+//	json:"port"        key in the configuration file, '-' if not in a file
+//	flag:"port"        flag name, defaults to the key, '-' for none
+//	env:"MS_PORT"      environment variable, defaults to the prefix and the
+//	                   upper case flag name, '-' for none
+//	envset:"true"      a bool is true if its environment variable is set to
+//	                   any value, as MS_NO_METRICS was before the Loader
+//	default:"8080"     default if the field is not set otherwise
+//	sep:";"            separator of list values in env and defaults (',')
+//	help:"..."         usage text of the flag
+//	validate:"..."     rules checked after loading, see package validate
+//	secret:"true"      the value is masked by Redact, the password of an URL
+//	                   value is scrubbed from logs
+//	reload:"safe"      the value may change while the service runs, see Diff
+//
+// All string values may be secret references like 'file:/run/secrets/db',
+// see package secret. They are resolved while loading.
+//
+// Embedded structs are flattened, other struct fields become nested objects
+// in the file and prefix the flag names of their fields with 'name-'.
+type Loader struct {
+	// FileFlag is the name of the flag which names the configuration file
+	FileFlag string
+
+	flagset   *flag.FlagSet
+	envPrefix string
+	targets   []section
+	fields    []*field
+	byKey     map[string]*field
+	byFlag    map[string]*field
+}
+
+// section is a struct registered with the Loader
+type section struct {
+	name   string
+	target interface{}
+}
+
+// ###########################################################################
+
+// NewLoader creates a Loader which registers its flags on flagset and
+// derives environment variable names from envPrefix
+func NewLoader(flagset *flag.FlagSet, envPrefix string) *Loader {
+	return &Loader{
+		flagset:   flagset,
+		envPrefix: envPrefix,
+		byKey:     map[string]*field{},
+		byFlag:    map[string]*field{},
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// Add registers the fields of the struct target points to and defines their
+// flags.
+func (l *Loader) Add(target interface{}) error {
+	return l.AddSection("", target)
+}
+
+// ---------------------------------------------------------------------------
+
+// AddSection registers the fields of the struct target points to below the
+// key name. In the configuration file they are read from the object 'name',
+// their flags are named 'name-<flag>' and their environment variables get
+// '<NAME>_' added to the prefix. An empty name adds the fields at the top
+// level like Add does.
+func (l *Loader) AddSection(name string, target interface{}) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("configuration target must be a pointer to a struct, got %T", target)
+	}
+
+	keyPrefix, flagPrefix := "", ""
+	if len(name) > 0 {
+		keyPrefix, flagPrefix = name+".", name+"-"
+	}
+
+	var fields []*field
+	if err := l.collect(rv.Elem(), keyPrefix, flagPrefix, &fields); err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		if len(f.key) > 0 {
+			if _, exists := l.byKey[f.key]; exists {
+				return fmt.Errorf("configuration key '%s' is defined twice", f.key)
+			}
+		}
+		if len(f.flagName) > 0 {
+			if _, exists := l.byFlag[f.flagName]; exists || l.flagset.Lookup(f.flagName) != nil {
+				return fmt.Errorf("configuration flag '-%s' is defined twice", f.flagName)
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if len(f.key) > 0 {
+			l.byKey[f.key] = f
+		}
+		if len(f.flagName) > 0 {
+			l.byFlag[f.flagName] = f
+			usage := f.help
+			if len(f.envName) > 0 {
+				usage = fmt.Sprintf("%s [$%s]", usage, f.envName)
+			}
+			l.flagset.Var(&flagValue{f}, f.flagName, usage)
+		}
+	}
+
+	l.fields = append(l.fields, fields...)
+	l.targets = append(l.targets, section{name: name, target: target})
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+// Load parses args and fills all registered structs. It returns the first
+// error of a source, or all fields which failed validation.
+func (l *Loader) Load(args []string) error {
+	err := l.load(args)
+	if err != nil && err != flag.ErrHelp {
+		err = errors.New(secret.Scrub(err.Error()))
+	}
+	return err
+}
+
+// ---------------------------------------------------------------------------
+
+func (l *Loader) load(args []string) error {
+
+	if err := l.flagset.Parse(args); err != nil {
+		return err
+	}
+
+	if err := l.applyDefaults(); err != nil {
+		return err
+	}
+
+	filename, err := l.filename()
+	if err != nil {
+		return err
+	}
+
+	if len(filename) > 0 {
+		values, err := ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("failed to read configuration file '%s': %s", filename, err.Error())
+		}
+		if err = l.applyFile(values, ""); err != nil {
+			return fmt.Errorf("configuration file '%s': %s", filename, err.Error())
+		}
+	}
+
+	for _, f := range l.fields {
+		if len(f.envName) == 0 {
+			continue
+		}
+		ev := os.Getenv(f.envName)
+		if len(ev) == 0 {
+			continue
+		}
+		if f.envSet && f.value.Kind() == reflect.Bool {
+			f.value.SetBool(true)
+			f.given = true
+			continue
+		}
+		if err := f.setString(ev); err != nil {
+			return fmt.Errorf("environment variable %s: %s", f.envName, err.Error())
+		}
+	}
+
+	for _, f := range l.fields {
+		f.setFlags()
+	}
+
+	return l.check()
+}
+
+// ---------------------------------------------------------------------------
+
+// Defaults fills the fields of all registered structs which are not set
+// from their defaults and validates them, without reading flags, a
+// configuration file or the environment. Tests build configurations like
+// this.
+func (l *Loader) Defaults() error {
+	err := l.applyDefaults()
+	if err == nil {
+		err = l.check()
+	}
+	if err != nil {
+		err = errors.New(secret.Scrub(err.Error()))
+	}
+	return err
+}
+
+// ---------------------------------------------------------------------------
+
+// applyDefaults sets the fields which are not set to their defaults
+func (l *Loader) applyDefaults() error {
+	for _, f := range l.fields {
+		if len(f.def) == 0 || !f.value.IsZero() {
+			continue
+		}
+		if err := f.setString(f.def); err != nil {
+			return fmt.Errorf("default of '%s': %s", f.name, err.Error())
+		}
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+// check registers the passwords of secret values and validates all
+// registered structs
+func (l *Loader) check() error {
+	for _, f := range l.fields {
+		if f.secret {
+			for _, value := range stringValues(f.value) {
+				secret.RegisterPassword(value)
+			}
+		}
+	}
+
+	var errs validate.FieldErrors
+
+	for _, target := range l.targets {
+		err := validate.Struct(target.target)
+		if err == nil {
+			continue
+		}
+		fieldErrors, ok := err.(validate.FieldErrors)
+		if !ok {
+			return fmt.Errorf("invalid configuration: %s", err.Error())
+		}
+		if len(target.name) > 0 {
+			for i := range fieldErrors {
+				fieldErrors[i].Field = target.name + "." + fieldErrors[i].Field
+			}
+		}
+		errs = append(errs, fieldErrors...)
+	}
+
+	// Zero values are only skipped if they were not given, an explicit 0
+	// must satisfy min=1 as well
+	for _, f := range l.fields {
+		if !f.given || len(f.rules) == 0 || !f.value.IsZero() {
+			continue
+		}
+		name := f.key
+		if len(name) == 0 {
+			name = f.name
+		}
+		if err := validate.Explicit(name, f.value, f.rules); err != nil {
+			errs = append(errs, err.(validate.FieldErrors)...)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %s", errs.Error())
+	}
+	return nil
+}
+
+// ###########################################################################
+
+// filename resolves the configuration file from its flag, environment
+// variable or preset value, in this order.
+func (l *Loader) filename() (string, error) {
+	f, exists := l.byFlag[l.FileFlag]
+	if !exists || len(l.FileFlag) == 0 {
+		return "", nil
+	}
+
+	if len(f.flagRaw) > 0 {
+		f.setFlags()
+	} else if ev := os.Getenv(f.envName); len(f.envName) > 0 && len(ev) > 0 {
+		if err := f.setString(ev); err != nil {
+			return "", fmt.Errorf("environment variable %s: %s", f.envName, err.Error())
+		}
+	}
+
+	return f.value.String(), nil
+}
+
+// ---------------------------------------------------------------------------
+
+// collect walks a struct and describes all of its configurable fields
+func (l *Loader) collect(rv reflect.Value, keyPrefix string, flagPrefix string, fields *[]*field) error {
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		fv := rv.Field(i)
+
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			if err := l.collect(fv, keyPrefix, flagPrefix, fields); err != nil {
+				return err
+			}
+			continue
+		}
+
+		jsonName := strings.Split(sf.Tag.Get("json"), ",")[0]
+		flagName, hasFlag := sf.Tag.Lookup("flag")
+
+		if jsonName == "-" && !hasFlag {
+			continue
+		}
+
+		key := jsonName
+		if len(key) == 0 {
+			key = strings.ToLower(sf.Name)
+		}
+
+		if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+			if err := l.collect(fv, keyPrefix+key+".", flagPrefix+key+"-", fields); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !isSupported(sf.Type) {
+			return fmt.Errorf("configuration field '%s' has unsupported type %s", sf.Name, sf.Type)
+		}
+
+		f := &field{
+			name:   sf.Name,
+			help:   sf.Tag.Get("help"),
+			def:    sf.Tag.Get("default"),
+			rules:  sf.Tag.Get("validate"),
+			sep:    sf.Tag.Get("sep"),
+			secret: sf.Tag.Get("secret") == "true",
+			envSet: sf.Tag.Get("envset") == "true",
+			value:  fv,
+		}
+
+		if len(f.def) == 0 && !fv.IsZero() {
+			f.preset = fmt.Sprint(fv.Interface())
+		}
+
+		if jsonName != "-" {
+			f.key = keyPrefix + key
+		}
+
+		if !hasFlag {
+			flagName = flagPrefix + key
+		}
+		if flagName != "-" {
+			f.flagName = flagName
+		}
+
+		envName, hasEnv := sf.Tag.Lookup("env")
+		if !hasEnv && len(f.flagName) > 0 && len(l.envPrefix) > 0 {
+			envName = l.envPrefix + strings.ToUpper(strings.ReplaceAll(f.flagName, "-", "_"))
+		}
+		if envName != "-" {
+			f.envName = envName
+		}
+
+		if len(f.sep) == 0 {
+			f.sep = ","
+		}
+
+		*fields = append(*fields, f)
+	}
+
+	return nil
+}
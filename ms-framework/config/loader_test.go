@@ -0,0 +1,293 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testNested struct {
+	Level int `json:"level" default:"1"`
+}
+
+type testConfiguration struct {
+	File     string        `json:"-" flag:"config" env:"CFGTEST_CONFIG"`
+	Name     string        `json:"name" default:"service" validate:"required"`
+	Port     int           `json:"port" default:"8080" validate:"min=1,max=65535"`
+	Mode     string        `json:"mode" default:"fast" validate:"enum=fast|slow"`
+	Tags     []string      `json:"tags" flag:"tag"`
+	Interval time.Duration `json:"interval" default:"1s"`
+	Limit    int           `json:"limit" validate:"min=5"`
+	Nested   testNested    `json:"nested"`
+}
+
+// setenv sets an environment variable for the test
+func setenv(t *testing.T, key string, value string) {
+	t.Helper()
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Unsetenv(key) })
+}
+
+// ---------------------------------------------------------------------------
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want func(cfg *testConfiguration)
+		err  string
+	}{
+		{
+			name: "defaults",
+			want: func(cfg *testConfiguration) {},
+		},
+		{
+			name: "file overrides defaults",
+			file: `{"port": 9090, "tags": ["a", "b"], "interval": "2s", "nested": {"level": 3}}`,
+			want: func(cfg *testConfiguration) {
+				cfg.Port = 9090
+				cfg.Tags = []string{"a", "b"}
+				cfg.Interval = 2 * time.Second
+				cfg.Nested.Level = 3
+			},
+		},
+		{
+			name: "environment overrides file",
+			file: `{"port": 9090, "mode": "slow"}`,
+			env:  map[string]string{"CFGTEST_PORT": "9191", "CFGTEST_TAG": "x,y"},
+			want: func(cfg *testConfiguration) {
+				cfg.Port = 9191
+				cfg.Mode = "slow"
+				cfg.Tags = []string{"x", "y"}
+			},
+		},
+		{
+			name: "flags override environment",
+			file: `{"port": 9090}`,
+			env:  map[string]string{"CFGTEST_PORT": "9191", "CFGTEST_NESTED_LEVEL": "4"},
+			args: []string{"-port", "9292", "-tag", "p", "-tag", "q"},
+			want: func(cfg *testConfiguration) {
+				cfg.Port = 9292
+				cfg.Tags = []string{"p", "q"}
+				cfg.Nested.Level = 4
+			},
+		},
+		{
+			name: "unknown key",
+			file: `{"port": 9090, "bogus": 1}`,
+			err:  "unknown key 'bogus'",
+		},
+		{
+			name: "unknown nested key",
+			file: `{"nested": {"bogus": 1}}`,
+			err:  "unknown key 'nested.bogus'",
+		},
+		{
+			name: "wrong type",
+			file: `{"port": "9090"}`,
+			err:  "key 'port': expected an integer",
+		},
+		{
+			name: "invalid environment variable",
+			env:  map[string]string{"CFGTEST_PORT": "many"},
+			err:  "environment variable CFGTEST_PORT",
+		},
+		{
+			name: "invalid enum",
+			args: []string{"-mode", "medium"},
+			err:  "mode: must be one of [fast, slow], got 'medium'",
+		},
+		{
+			name: "explicit zero from a flag",
+			args: []string{"-port", "0"},
+			err:  "port: must be at least 1",
+		},
+		{
+			name: "explicit zero from the environment",
+			env:  map[string]string{"CFGTEST_LIMIT": "0"},
+			err:  "limit: must be at least 5",
+		},
+		{
+			name: "explicit zero from the file",
+			file: `{"limit": 0}`,
+			err:  "limit: must be at least 5",
+		},
+		{
+			name: "explicit empty required value",
+			file: `{"name": ""}`,
+			err:  "name: is required",
+		},
+		{
+			name: "configuration file from a missing reference",
+			env:  map[string]string{"CFGTEST_CONFIG": "file:/nonexistent/config"},
+			err:  "environment variable CFGTEST_CONFIG",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if len(tt.file) > 0 {
+				filename := filepath.Join(t.TempDir(), "config.json")
+				if err := ioutil.WriteFile(filename, []byte(tt.file), 0600); err != nil {
+					t.Fatal(err)
+				}
+				args = append([]string{"-config", filename}, args...)
+			}
+			for key, value := range tt.env {
+				setenv(t, key, value)
+			}
+
+			var cfg testConfiguration
+			loader := NewLoader(flag.NewFlagSet("test", flag.ContinueOnError), "CFGTEST_")
+			loader.FileFlag = "config"
+			if err := loader.Add(&cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			err := loader.Load(args)
+			if len(tt.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error: '%v', want '%s'", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := testConfiguration{Name: "service", Port: 8080, Mode: "fast", Interval: time.Second, Nested: testNested{Level: 1}}
+			tt.want(&want)
+			cfg.File = ""
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("configuration:\n%+v, want\n%+v", cfg, want)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestSections(t *testing.T) {
+	var cfg testConfiguration
+	var section testNested
+
+	loader := NewLoader(flag.NewFlagSet("test", flag.ContinueOnError), "CFGTEST_")
+	if err := loader.Add(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.AddSection("extra", &section); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.AddSection("extra", &section); err == nil {
+		t.Error("a section added twice is accepted")
+	}
+
+	if err := loader.Load([]string{"-extra-level", "7"}); err != nil {
+		t.Fatal(err)
+	}
+	if section.Level != 7 {
+		t.Errorf("level: %d != 7", section.Level)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestDefaults(t *testing.T) {
+	setenv(t, "CFGTEST_PORT", "9191")
+
+	cfg := testConfiguration{Port: 7070}
+	loader := NewLoader(flag.NewFlagSet("test", flag.ContinueOnError), "CFGTEST_")
+	if err := loader.Add(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Defaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Preset values are kept, the environment is not read
+	if cfg.Port != 7070 || cfg.Name != "service" || cfg.Nested.Level != 1 {
+		t.Errorf("configuration: %+v", cfg)
+	}
+
+	invalid := testConfiguration{Mode: "medium"}
+	loader = NewLoader(flag.NewFlagSet("test", flag.ContinueOnError), "CFGTEST_")
+	if err := loader.Add(&invalid); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Defaults(); err == nil {
+		t.Error("an invalid preset is accepted")
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestBool(t *testing.T) {
+	type boolConfiguration struct {
+		Debug     bool `json:"debug"`
+		NoMetrics bool `json:"nometrics" env:"CFGTEST_NO_METRICS" envset:"true"`
+	}
+
+	tests := []struct {
+		env       string
+		value     string
+		debug     bool
+		noMetrics bool
+		err       bool
+	}{
+		{"CFGTEST_DEBUG", "true", true, false, false},
+		{"CFGTEST_DEBUG", "1", true, false, false},
+		{"CFGTEST_DEBUG", "yes", true, false, false},
+		{"CFGTEST_DEBUG", "On", true, false, false},
+		{"CFGTEST_DEBUG", "off", false, false, false},
+		{"CFGTEST_DEBUG", "no", false, false, false},
+		{"CFGTEST_DEBUG", "maybe", false, false, true},
+		{"CFGTEST_NO_METRICS", "yes", false, true, false},
+		{"CFGTEST_NO_METRICS", "anything", false, true, false},
+		{"CFGTEST_NO_METRICS", "false", false, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env+"="+tt.value, func(t *testing.T) {
+			setenv(t, tt.env, tt.value)
+
+			var cfg boolConfiguration
+			loader := NewLoader(flag.NewFlagSet("test", flag.ContinueOnError), "CFGTEST_")
+			if err := loader.Add(&cfg); err != nil {
+				t.Fatal(err)
+			}
+			err := loader.Load(nil)
+			if tt.err {
+				if err == nil || !strings.Contains(err.Error(), "invalid boolean") {
+					t.Errorf("error: '%v'", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Debug != tt.debug || cfg.NoMetrics != tt.noMetrics {
+				t.Errorf("debug %v, nometrics %v", cfg.Debug, cfg.NoMetrics)
+			}
+		})
+	}
+
+	// Flags take the same values
+	var cfg boolConfiguration
+	loader := NewLoader(flag.NewFlagSet("test", flag.ContinueOnError), "CFGTEST_")
+	if err := loader.Add(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Load([]string{"-debug=yes", "-nometrics=off"}); err != nil || !cfg.Debug || cfg.NoMetrics {
+		t.Errorf("flags: debug %v, nometrics %v, '%v'", cfg.Debug, cfg.NoMetrics, err)
+	}
+}
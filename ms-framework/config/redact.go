@@ -0,0 +1,89 @@
+package config
+
+import (
+	"reflect"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/secret"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Redaction
+// ###########################################################################
+// ###########################################################################
+
+// Redact masks the secrets in the struct target points to, so it can be
+// logged or served. Fields tagged 'secret:"true"' are masked, all other
+// strings are scrubbed from resolved secret references. Slices are replaced,
+// not modified, so target may be a shallow copy of a live configuration.
+func Redact(target interface{}) {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return
+	}
+	redactStruct(rv.Elem())
+}
+
+// ---------------------------------------------------------------------------
+
+func redactStruct(rv reflect.Value) {
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		fv := rv.Field(i)
+
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		isSecret := sf.Tag.Get("secret") == "true"
+
+		switch fv.Kind() {
+
+		case reflect.Struct:
+			redactStruct(fv)
+
+		case reflect.String:
+			fv.SetString(redactString(fv.String(), isSecret))
+
+		case reflect.Slice:
+			if fv.Type().Elem().Kind() != reflect.String || fv.Len() == 0 {
+				continue
+			}
+			list := reflect.MakeSlice(fv.Type(), fv.Len(), fv.Len())
+			for j := 0; j < fv.Len(); j++ {
+				list.Index(j).SetString(redactString(fv.Index(j).String(), isSecret))
+			}
+			fv.Set(list)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func redactString(value string, isSecret bool) string {
+	if isSecret {
+		return secret.Redact(value)
+	}
+	return secret.Scrub(value)
+}
+
+// ---------------------------------------------------------------------------
+
+// stringValues returns the string values of a string or string list field
+func stringValues(v reflect.Value) []string {
+	switch v.Kind() {
+	case reflect.String:
+		return []string{v.String()}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			values := make([]string, v.Len())
+			for i := range values {
+				values[i] = v.Index(i).String()
+			}
+			return values
+		}
+	}
+	return nil
+}
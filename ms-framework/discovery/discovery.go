@@ -0,0 +1,91 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Service discovery
+// ###########################################################################
+// ###########################################################################
+
+// A discovery resolves logical service names to the URLs of their
+// instances. It is opened from a URI or a file name:
+//
+//	/etc/ms/services.yaml                    static file, see File
+//	dns://svc.cluster.local?port=http        DNS SRV records, see DNS
+//	memory://                                in process registry, see Registry
+//	memory://name                            a separate in process registry
+//
+// Instances register themselves with registries supporting it, see
+// Registrar.
+
+// ErrUnknownService is returned for services without any endpoint
+var ErrUnknownService = errors.New("unknown service")
+
+// Endpoint is an instance of a service. URL is its base URL, paths are
+// appended to it.
+type Endpoint struct {
+	Service  string `json:"service"`
+	Instance string `json:"instance,omitempty"`
+	URL      string `json:"url"`
+}
+
+// ---------------------------------------------------------------------------
+
+// Discovery resolves a service to its endpoints
+type Discovery interface {
+	Resolve(ctx context.Context, service string) ([]Endpoint, error)
+}
+
+// ---------------------------------------------------------------------------
+
+// Registrar is a Discovery which instances register with
+type Registrar interface {
+	Discovery
+	Register(ctx context.Context, endpoint Endpoint) error
+	Deregister(ctx context.Context, endpoint Endpoint) error
+}
+
+// ###########################################################################
+
+// Open returns the discovery of uri. Anything but a URI is a file name, as
+// configuration values starting with 'file:' are secret references.
+func Open(uri string) (Discovery, error) {
+	if !strings.Contains(uri, "://") {
+		return NewFile(uri), nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "dns":
+		return NewDNS(u.Host, u.Query().Get("port"), u.Query().Get("scheme")), nil
+	case "memory":
+		return SharedRegistry(u.Host), nil
+	}
+
+	return nil, fmt.Errorf("unknown discovery '%s'", u.Scheme)
+}
+
+// ---------------------------------------------------------------------------
+
+// unknown returns the error of a service without endpoints
+func unknown(service string) error {
+	return fmt.Errorf("%w '%s'", ErrUnknownService, service)
+}
+
+// ---------------------------------------------------------------------------
+
+// trimURL removes a trailing slash, as paths are appended to the URL
+func trimURL(u string) string {
+	return strings.TrimSuffix(u, "/")
+}
@@ -0,0 +1,171 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry()
+
+	if _, err := r.Resolve(ctx, "svc"); !errors.Is(err, ErrUnknownService) {
+		t.Fatalf("empty registry: %v", err)
+	}
+
+	r.Register(ctx, Endpoint{Service: "svc", Instance: "a", URL: "http://a:8080/"})
+	r.Register(ctx, Endpoint{Service: "svc", Instance: "b", URL: "http://b:8080"})
+	r.Register(ctx, Endpoint{Service: "other", URL: "http://c:8080"})
+	r.Register(ctx, Endpoint{Service: "svc", Instance: "a2", URL: "http://a:8080"})
+
+	tests := []struct {
+		name   string
+		change func()
+		want   []Endpoint
+	}{
+		{
+			"registered in order, replaced by URL",
+			func() {},
+			[]Endpoint{{"svc", "b", "http://b:8080"}, {"svc", "a2", "http://a:8080"}},
+		},
+		{
+			"deregistered",
+			func() { r.Deregister(ctx, Endpoint{Service: "svc", URL: "http://b:8080/"}) },
+			[]Endpoint{{"svc", "a2", "http://a:8080"}},
+		},
+		{
+			"unknown URL",
+			func() { r.Deregister(ctx, Endpoint{Service: "svc", URL: "http://x:8080"}) },
+			[]Endpoint{{"svc", "a2", "http://a:8080"}},
+		},
+		{
+			"last one deregistered",
+			func() { r.Deregister(ctx, Endpoint{Service: "svc", URL: "http://a:8080"}) },
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		tt.change()
+		endpoints, err := r.Resolve(ctx, "svc")
+		if tt.want == nil {
+			if !errors.Is(err, ErrUnknownService) {
+				t.Errorf("%s: %v, %v", tt.name, endpoints, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(endpoints, tt.want) {
+			t.Errorf("%s: %v, %v, want %v", tt.name, endpoints, err, tt.want)
+		}
+	}
+
+	// Resolve returns a copy
+	other, _ := r.Resolve(ctx, "other")
+	other[0].URL = "changed"
+	if other, _ = r.Resolve(ctx, "other"); other[0].URL != "http://c:8080" {
+		t.Errorf("the registry was changed through a resolved endpoint")
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "services.yaml")
+
+	write := func(content string, stamp time.Time) {
+		if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filename, stamp, stamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := NewFile(filename)
+	if _, err := f.Resolve(ctx, "svc"); err == nil {
+		t.Fatal("a missing file is accepted")
+	}
+
+	now := time.Now()
+	write("svc:\n  - http://a:8080/\n  - http://b:8080\nother: http://c:8080\n", now)
+
+	tests := []struct {
+		service string
+		want    []Endpoint
+	}{
+		{"svc", []Endpoint{{Service: "svc", URL: "http://a:8080"}, {Service: "svc", URL: "http://b:8080"}}},
+		{"other", []Endpoint{{Service: "other", URL: "http://c:8080"}}},
+		{"missing", nil},
+	}
+
+	for _, tt := range tests {
+		endpoints, err := f.Resolve(ctx, tt.service)
+		if tt.want == nil {
+			if !errors.Is(err, ErrUnknownService) {
+				t.Errorf("%s: %v, %v", tt.service, endpoints, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(endpoints, tt.want) {
+			t.Errorf("%s: %v, %v, want %v", tt.service, endpoints, err, tt.want)
+		}
+	}
+
+	// The file is read again when it was modified
+	write("svc: http://d:8080\n", now.Add(time.Second))
+	if endpoints, err := f.Resolve(ctx, "svc"); err != nil || len(endpoints) != 1 || endpoints[0].URL != "http://d:8080" {
+		t.Errorf("modified file: %v, %v", endpoints, err)
+	}
+
+	write("svc: 8080\n", now.Add(2*time.Second))
+	if _, err := f.Resolve(ctx, "svc"); err == nil {
+		t.Error("a service without URL is accepted")
+	}
+
+	write("svc: [http://a:8080, 1]\n", now.Add(3*time.Second))
+	if _, err := f.Resolve(ctx, "svc"); err == nil {
+		t.Error("a list with a number is accepted")
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want interface{}
+		err  bool
+	}{
+		{"/etc/ms/services.yaml", &File{}, false},
+		{"services.json", &File{}, false},
+		{"dns://svc.cluster.local?port=http", &DNS{}, false},
+		{"memory://", &Registry{}, false},
+		{"consul://localhost", nil, true},
+	}
+
+	for _, tt := range tests {
+		d, err := Open(tt.uri)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: no error", tt.uri)
+			}
+			continue
+		}
+		if err != nil || reflect.TypeOf(d) != reflect.TypeOf(tt.want) {
+			t.Errorf("%s: %T, %v", tt.uri, d, err)
+		}
+	}
+
+	a, _ := Open("memory://a")
+	b, _ := Open("memory://b")
+	if again, _ := Open("memory://a"); a != again || a == b {
+		t.Error("memory registries are not shared by name")
+	}
+}
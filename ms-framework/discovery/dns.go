@@ -0,0 +1,83 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ###########################################################################
+// ###########################################################################
+// DNS SRV discovery
+// ###########################################################################
+// ###########################################################################
+
+// DNS resolves services from SRV records. With port 'http' the service
+// 'thermometer' in domain 'svc.cluster.local' is looked up as
+// '_http._tcp.thermometer.svc.cluster.local', like the named ports of
+// Kubernetes services. Without a port 'thermometer.svc.cluster.local' is
+// looked up as it is.
+//
+// The endpoints are sorted by priority and weight of their records. Their
+// scheme is 'https' if the port is named so, 'http' otherwise, unless a
+// scheme is given.
+type DNS struct {
+	domain   string
+	port     string
+	scheme   string
+	Resolver *net.Resolver
+}
+
+// ###########################################################################
+
+// NewDNS creates a discovery of domain, which may be empty for fully
+// qualified service names
+func NewDNS(domain string, port string, scheme string) *DNS {
+	if len(scheme) == 0 {
+		scheme = "http"
+		if port == "https" {
+			scheme = "https"
+		}
+	}
+	return &DNS{domain: domain, port: port, scheme: scheme, Resolver: net.DefaultResolver}
+}
+
+// ---------------------------------------------------------------------------
+
+// Resolve ...
+func (d *DNS) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	name := service
+	if len(d.domain) > 0 {
+		name = fmt.Sprintf("%s.%s", service, d.domain)
+	}
+
+	proto := ""
+	if len(d.port) > 0 {
+		proto = "tcp"
+	}
+
+	_, records, err := d.Resolver.LookupSRV(ctx, d.port, proto, name)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return nil, unknown(service)
+		}
+		return nil, err
+	}
+
+	var endpoints []Endpoint
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		endpoints = append(endpoints, Endpoint{
+			Service:  service,
+			Instance: host,
+			URL:      fmt.Sprintf("%s://%s", d.scheme, net.JoinHostPort(host, strconv.Itoa(int(record.Port)))),
+		})
+	}
+
+	if len(endpoints) == 0 {
+		return nil, unknown(service)
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,102 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/config"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Static file discovery
+// ###########################################################################
+// ###########################################################################
+
+// File resolves services from a configuration file, JSON, YAML or TOML like
+// the configuration of the service. Each key is a service, with one URL or
+// a list of URLs:
+//
+//	thermometer:
+//	  - https://thermometer-1:8443
+//	  - https://thermometer-2:8443
+//	hygrometer: https://hygrometer:8443
+//
+// The file is read again when it was modified.
+type File struct {
+	filename  string
+	mutex     sync.Mutex
+	stamp     time.Time
+	endpoints map[string][]Endpoint
+}
+
+// ###########################################################################
+
+// NewFile creates a discovery reading filename
+func NewFile(filename string) *File {
+	return &File{filename: filename}
+}
+
+// ---------------------------------------------------------------------------
+
+// Resolve ...
+func (f *File) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	endpoints := f.endpoints[service]
+	if len(endpoints) == 0 {
+		return nil, unknown(service)
+	}
+	return append([]Endpoint(nil), endpoints...), nil
+}
+
+// ---------------------------------------------------------------------------
+
+// load reads the file if it was modified, the mutex must be held
+func (f *File) load() error {
+	info, err := os.Stat(f.filename)
+	if err != nil {
+		return err
+	}
+	if f.endpoints != nil && info.ModTime().Equal(f.stamp) {
+		return nil
+	}
+
+	values, err := config.ReadFile(f.filename)
+	if err != nil {
+		return fmt.Errorf("could not read services from '%s', error was '%s'", f.filename, err.Error())
+	}
+
+	endpoints := map[string][]Endpoint{}
+	for service, value := range values {
+		var urls []interface{}
+		switch v := value.(type) {
+		case string:
+			urls = []interface{}{v}
+		case []interface{}:
+			urls = v
+		default:
+			return fmt.Errorf("service '%s' in '%s' must be a URL or a list of URLs", service, f.filename)
+		}
+
+		for _, u := range urls {
+			s, ok := u.(string)
+			if !ok {
+				return fmt.Errorf("service '%s' in '%s' must be a URL or a list of URLs", service, f.filename)
+			}
+			endpoints[service] = append(endpoints[service], Endpoint{Service: service, URL: trimURL(s)})
+		}
+	}
+
+	f.endpoints = endpoints
+	f.stamp = info.ModTime()
+	return nil
+}
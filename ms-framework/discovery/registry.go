@@ -0,0 +1,102 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+)
+
+// ###########################################################################
+// ###########################################################################
+// In process registry
+// ###########################################################################
+// ###########################################################################
+
+// Registry keeps the endpoints registered in this process. Services started
+// together, like in tests, find each other through a shared registry.
+type Registry struct {
+	mutex     sync.Mutex
+	endpoints map[string][]Endpoint
+}
+
+var sharedRegistries = struct {
+	sync.Mutex
+	registries map[string]*Registry
+}{registries: map[string]*Registry{}}
+
+// ###########################################################################
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{endpoints: map[string][]Endpoint{}}
+}
+
+// ---------------------------------------------------------------------------
+
+// SharedRegistry returns the registry of the process named name, which is
+// opened by 'memory://name'
+func SharedRegistry(name string) *Registry {
+	sharedRegistries.Lock()
+	defer sharedRegistries.Unlock()
+
+	registry, found := sharedRegistries.registries[name]
+	if !found {
+		registry = NewRegistry()
+		sharedRegistries.registries[name] = registry
+	}
+	return registry
+}
+
+// ###########################################################################
+
+// Resolve returns the endpoints in the order they were registered
+func (r *Registry) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	endpoints := r.endpoints[service]
+	if len(endpoints) == 0 {
+		return nil, unknown(service)
+	}
+	return append([]Endpoint(nil), endpoints...), nil
+}
+
+// ---------------------------------------------------------------------------
+
+// Register adds an endpoint, replacing one with the same URL
+func (r *Registry) Register(ctx context.Context, endpoint Endpoint) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	endpoint.URL = trimURL(endpoint.URL)
+	r.remove(endpoint)
+	r.endpoints[endpoint.Service] = append(r.endpoints[endpoint.Service], endpoint)
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+// Deregister removes an endpoint by its URL
+func (r *Registry) Deregister(ctx context.Context, endpoint Endpoint) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	endpoint.URL = trimURL(endpoint.URL)
+	r.remove(endpoint)
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+// remove deletes endpoint, the mutex must be held
+func (r *Registry) remove(endpoint Endpoint) {
+	endpoints := r.endpoints[endpoint.Service]
+	for i, e := range endpoints {
+		if e.URL == endpoint.URL {
+			r.endpoints[endpoint.Service] = append(endpoints[:i:i], endpoints[i+1:]...)
+			break
+		}
+	}
+	if len(r.endpoints[endpoint.Service]) == 0 {
+		delete(r.endpoints, endpoint.Service)
+	}
+}
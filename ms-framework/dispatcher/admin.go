@@ -0,0 +1,133 @@
+package dispatcher
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher admin listener
+// ###########################################################################
+// ###########################################################################
+
+// Names of the built-in endpoints which can be moved to the admin listener.
+const (
+	AdminEndpointMetrics = "metrics"
+	AdminEndpointStatus  = "status"
+	AdminEndpointDebug   = "debug"
+	AdminEndpointHealth  = "health"
+)
+
+// IsAdminEndpoint reports if the named endpoint is served by the admin
+// listener. If an admin port is configured without an explicit endpoint list,
+// all built-in endpoints are moved there.
+func (ds *Dispatcher) IsAdminEndpoint(name string) bool {
+	if ds.adminMuxer == nil {
+		return false
+	}
+
+	if len(ds.GetAdminEndpoints()) == 0 {
+		return true
+	}
+
+	for _, endpoint := range ds.GetAdminEndpoints() {
+		if endpoint == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ---------------------------------------------------------------------------
+
+// HandleAdmin registers an operational endpoint. It is served without the
+// namespace on the admin listener if the endpoint is moved there, otherwise
+// it is registered like Handle does.
+func (ds *Dispatcher) HandleAdmin(name string, path string, handler http.Handler) {
+	if ds.IsAdminEndpoint(name) {
+		ds.adminMuxer.Handle(path, handler)
+		return
+	}
+	ds.Handle(path, handler)
+}
+
+// ---------------------------------------------------------------------------
+
+// AddAdminHandler registers an operational HandlerGroup. It is served without
+// the namespace on the admin listener if the endpoint is moved there,
+// otherwise it is registered like AddHandler does.
+func (ds *Dispatcher) AddAdminHandler(name string, path string, handlers *HandlerGroup) {
+	if ds.IsAdminEndpoint(name) {
+		ds.fillHandlerGroup(handlers)
+		ds.registerHandler(ds.adminMuxer, path, handlers)
+		return
+	}
+	ds.AddHandler(path, handlers)
+}
+
+// ---------------------------------------------------------------------------
+
+// adminTLSConfig builds the TLS configuration of the admin listener, nil if
+// the admin listener is served in plain text.
+func (ds *Dispatcher) adminTLSConfig() (*tls.Config, error) {
+
+	if len(ds.GetAdminCertChainFile()) == 0 || len(ds.GetAdminKeyFile()) == 0 {
+		return nil, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(ds.GetAdminCertChainFile(), ds.GetAdminKeyFile())
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{certificate}}
+
+	if len(ds.GetAdminCAFile()) > 0 {
+		caCert, err := ioutil.ReadFile(ds.GetAdminCAFile())
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		tlsConfig.ClientCAs.AppendCertsFromPEM(caCert)
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// listenAdmin opens the admin listener and creates its server. The public
+// wrappers, the reply delay and the connection limit are not applied to it,
+// the timeouts of the public listeners are.
+func (ds *Dispatcher) listenAdmin() (*http.Server, net.Listener, error) {
+	var listener net.Listener
+	var scheme string
+
+	addr := net.JoinHostPort(ds.GetAdminHost(), strconv.Itoa(ds.GetAdminPort()))
+	tlsConfig, err := ds.adminTLSConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if tlsConfig != nil {
+		scheme = "https"
+		listener, err = tls.Listen("tcp", addr, tlsConfig)
+	} else {
+		scheme = "http"
+		listener, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ds.GetLogger().Println(fmt.Sprintf("Starting admin listener on '%s://%s'", scheme, addr))
+	return ds.newHTTPServer(ds.adminMuxer), listener, nil
+}
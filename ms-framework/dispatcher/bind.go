@@ -0,0 +1,472 @@
+package dispatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/validate"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher Request binding
+// ###########################################################################
+// ###########################################################################
+
+// DefaultBindBodySize is the body size Bind accepts if no other is set
+const DefaultBindBodySize = 1 << 20
+
+// BindOptions change how requests are bound
+type BindOptions struct {
+	// MaxBodySize is the largest body accepted, DefaultBindBodySize if 0
+	MaxBodySize int64
+	// AllowUnknownFields accepts JSON and form fields the target does not have
+	AllowUnknownFields bool
+}
+
+// ###########################################################################
+
+// Bind decodes r into the struct v points to and validates it with its
+// 'validate' tags, see package validate. The body is decoded by its content
+// type (JSON or form), requests without body are bound from their query.
+// Fields are named by their 'form' tag for forms and queries, or their JSON
+// name.
+//
+// Zero values the request contained, like "count":0 or an empty query
+// parameter, are checked with all rules, see validate.Explicit.
+//
+// Errors are problems ready to be replied: 400 with the list of field
+// errors, 413 for too large bodies and 415 for unsupported content types.
+// Invalid 'validate' tags of v, like unknown rules, are internal errors.
+//
+//	func (s *Service) httpPostDevice(w http.ResponseWriter, r *http.Request) error {
+//		var device Registration
+//		if err := s.Bind(r, &device); err != nil {
+//			return err
+//		}
+//		...
+//	}
+func (ds *Dispatcher) Bind(r *http.Request, v interface{}) error {
+	return ds.BindWith(r, v, BindOptions{})
+}
+
+// ---------------------------------------------------------------------------
+
+// BindWith binds like Bind with options
+func (ds *Dispatcher) BindWith(r *http.Request, v interface{}, options BindOptions) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return Internal(fmt.Errorf("bind target must be a pointer to a struct, got %T", v))
+	}
+
+	if options.MaxBodySize <= 0 {
+		options.MaxBodySize = DefaultBindBodySize
+	}
+
+	var explicit validate.FieldErrors
+	var err error
+	if hasBody(r) {
+		explicit, err = bindBody(r, rv.Elem(), options)
+	} else {
+		query := r.URL.Query()
+		if err = bindValues(query, rv.Elem(), true); err == nil {
+			explicit = givenErrors(rv.Elem(), valueFields(query), formName)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return validateBound(v, explicit)
+}
+
+// ---------------------------------------------------------------------------
+
+// BindQuery binds the query of r into the struct v points to and validates
+// it. Unknown query parameters are ignored.
+func (ds *Dispatcher) BindQuery(r *http.Request, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return Internal(fmt.Errorf("bind target must be a pointer to a struct, got %T", v))
+	}
+
+	query := r.URL.Query()
+	if err := bindValues(query, rv.Elem(), true); err != nil {
+		return err
+	}
+
+	return validateBound(v, givenErrors(rv.Elem(), valueFields(query), formName))
+}
+
+// ###########################################################################
+
+// validateBound validates v after binding. explicit are the errors of the
+// zero values the request contained, which validate.Struct skips. Invalid
+// 'validate' tags are programming errors and reported as internal errors.
+func validateBound(v interface{}, explicit validate.FieldErrors) error {
+	var errs validate.FieldErrors
+	if err := validate.Struct(v); err != nil {
+		fieldErrors, ok := err.(validate.FieldErrors)
+		if !ok {
+			return Internal(err)
+		}
+		errs = fieldErrors
+	}
+
+	for _, fe := range explicit {
+		if !hasFieldError(errs, fe.Field) {
+			errs = append(errs, fe)
+		}
+	}
+
+	for _, fe := range errs {
+		if fe.IsRuleError() {
+			return Internal(fmt.Errorf("bind target %T has invalid validate tags: %s", v, errs.Error()))
+		}
+	}
+
+	if len(errs) > 0 {
+		return ProblemFromError(errs)
+	}
+	return nil
+}
+
+func hasFieldError(errs validate.FieldErrors, field string) bool {
+	for _, fe := range errs {
+		if fe.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// ---------------------------------------------------------------------------
+
+func hasBody(r *http.Request) bool {
+	if r.Body == nil || r.Body == http.NoBody {
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions:
+		return r.ContentLength > 0
+	}
+	return r.ContentLength != 0
+}
+
+// ---------------------------------------------------------------------------
+
+// bindBody sets the fields of rv from the body of r. It returns the errors
+// of the zero values the body contained, see givenErrors.
+func bindBody(r *http.Request, rv reflect.Value, options BindOptions) (validate.FieldErrors, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if r.ContentLength > options.MaxBodySize {
+		return nil, bodyTooLarge(options.MaxBodySize)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, options.MaxBodySize+1))
+	if isBodyTooLarge(err) {
+		return nil, NewProblem(http.StatusRequestEntityTooLarge, "The body exceeds the limit of the route.").WithCause(err)
+	}
+	if err != nil {
+		return nil, BadRequest("Failed to read the body.").WithCause(err)
+	}
+	if int64(len(data)) > options.MaxBodySize {
+		return nil, bodyTooLarge(options.MaxBodySize)
+	}
+
+	switch {
+
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || len(mediaType) == 0:
+		if err := bindJSON(data, rv, options); err != nil {
+			return nil, err
+		}
+		return givenErrors(rv, jsonFields(data), jsonName), nil
+
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(data))
+		if err != nil {
+			return nil, BadRequest("The form is malformed.").WithCause(err)
+		}
+		if err := bindValues(values, rv, options.AllowUnknownFields); err != nil {
+			return nil, err
+		}
+		return givenErrors(rv, valueFields(values), formName), nil
+	}
+
+	return nil, NewProblem(http.StatusUnsupportedMediaType, fmt.Sprintf("Content type '%s' is not supported, use JSON or a form.", mediaType))
+}
+
+// ---------------------------------------------------------------------------
+
+func bindJSON(data []byte, rv reflect.Value, options BindOptions) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if !options.AllowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+
+	err := decoder.Decode(rv.Addr().Interface())
+
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+
+	switch {
+	case err == nil:
+		if decoder.More() {
+			return BadRequest("The body must contain a single JSON value.")
+		}
+		return nil
+	case errors.Is(err, io.EOF):
+		return BadRequest("The body is empty.")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return BadRequest("The body is incomplete JSON.")
+	case errors.As(err, &syntaxError):
+		return BadRequest("The body is not valid JSON at offset %d.", syntaxError.Offset)
+	case errors.As(err, &typeError):
+		return ProblemFromError(validate.FieldErrors{{Field: typeError.Field, Rule: "type", Message: fmt.Sprintf("must be %s", typeError.Type)}})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return ProblemFromError(validate.FieldErrors{{Field: field, Rule: "unknown", Message: "is not a known field"}})
+	}
+
+	return BadRequest("The body could not be decoded.").WithCause(err)
+}
+
+// ---------------------------------------------------------------------------
+
+// bindValues sets the fields of rv from form or query values
+func bindValues(values url.Values, rv reflect.Value, allowUnknown bool) error {
+	known := map[string]bool{}
+	var errs validate.FieldErrors
+
+	bindStructValues(values, rv, known, &errs)
+
+	if !allowUnknown {
+		for name := range values {
+			if !known[name] {
+				errs = append(errs, validate.FieldError{Field: name, Rule: "unknown", Message: "is not a known field"})
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return ProblemFromError(errs)
+	}
+	return nil
+}
+
+func bindStructValues(values url.Values, rv reflect.Value, known map[string]bool, errs *validate.FieldErrors) {
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			bindStructValues(values, rv.Field(i), known, errs)
+			continue
+		}
+
+		name := formName(sf)
+		if name == "-" {
+			continue
+		}
+
+		known[name] = true
+		list, exists := values[name]
+		if !exists {
+			continue
+		}
+
+		if err := setFieldValues(rv.Field(i), list); err != nil {
+			*errs = append(*errs, validate.FieldError{Field: name, Rule: "type", Message: err.Error()})
+		}
+	}
+}
+
+// formName returns the name of a struct field in forms and queries, which is
+// its 'form' tag or its json name
+func formName(sf reflect.StructField) string {
+	name := strings.Split(sf.Tag.Get("form"), ",")[0]
+	if len(name) == 0 {
+		name = validate.FieldName(sf)
+	}
+	return name
+}
+
+// jsonName returns the name of a struct field in JSON, '-' if it is skipped
+func jsonName(sf reflect.StructField) string {
+	if sf.Tag.Get("json") == "-" {
+		return "-"
+	}
+	return validate.FieldName(sf)
+}
+
+// ---------------------------------------------------------------------------
+
+// givenFields is the tree of the fields a request contained. Fields which are
+// no JSON objects have no children.
+type givenFields map[string]givenFields
+
+// lookup finds a field by name, JSON names are matched case insensitive as
+// encoding/json does
+func (g givenFields) lookup(name string) (givenFields, bool) {
+	if children, exists := g[name]; exists {
+		return children, true
+	}
+	for key, children := range g {
+		if strings.EqualFold(key, name) {
+			return children, true
+		}
+	}
+	return nil, false
+}
+
+func jsonFields(data []byte) givenFields {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil
+	}
+	return objectFields(value)
+}
+
+func objectFields(value interface{}) givenFields {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	given := givenFields{}
+	for key, child := range object {
+		given[key] = objectFields(child)
+	}
+	return given
+}
+
+func valueFields(values url.Values) givenFields {
+	given := givenFields{}
+	for key := range values {
+		given[key] = nil
+	}
+	return given
+}
+
+// ---------------------------------------------------------------------------
+
+// givenErrors validates the zero values of the fields the request contained
+// with all rules, an explicit 0 must satisfy min=1 as well. Fields are
+// looked up by their key, errors are named as validate.Struct names them.
+func givenErrors(rv reflect.Value, given givenFields, key func(reflect.StructField) string) validate.FieldErrors {
+	var errs validate.FieldErrors
+	validateGiven(rv, "", given, key, &errs)
+	return errs
+}
+
+func validateGiven(rv reflect.Value, prefix string, given givenFields, key func(reflect.StructField) string, errs *validate.FieldErrors) {
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		fv := rv.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if sf.Anonymous && fv.Kind() == reflect.Struct {
+			validateGiven(fv, prefix, given, key, errs)
+			continue
+		}
+
+		k := key(sf)
+		if k == "-" {
+			continue
+		}
+		children, exists := given.lookup(k)
+		if !exists {
+			continue
+		}
+
+		name := prefix + validate.FieldName(sf)
+		if rules := sf.Tag.Get("validate"); len(rules) > 0 && fv.IsZero() && fv.Kind() != reflect.Ptr {
+			if err := validate.Explicit(name, fv, rules); err != nil {
+				*errs = append(*errs, err.(validate.FieldErrors)...)
+			}
+		}
+
+		if fv.Kind() == reflect.Struct && children != nil {
+			validateGiven(fv, name+".", children, key, errs)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// setFieldValues sets v from its form values, lists take all of them
+func setFieldValues(v reflect.Value, list []string) error {
+	if v.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(v.Type(), len(list), len(list))
+		for i, s := range list {
+			if err := setFieldValue(slice.Index(i), s); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		ptr := reflect.New(v.Type().Elem())
+		if err := setFieldValues(ptr.Elem(), list); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	}
+
+	return setFieldValue(v, list[len(list)-1])
+}
+
+func setFieldValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an unsigned integer")
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("can not be set from a form")
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package dispatcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type bindNested struct {
+	Level int `json:"level" validate:"min=1"`
+}
+
+type bindTarget struct {
+	Name   string     `json:"name" validate:"required"`
+	Count  int        `json:"count" form:"n" validate:"min=1,max=10"`
+	Mode   string     `json:"mode" validate:"enum=fast|slow"`
+	Limit  *int       `json:"limit" validate:"min=1"`
+	Nested bindNested `json:"nested"`
+}
+
+func bindRequest(method string, target string, contentType string, body string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if len(body) == 0 {
+		r = httptest.NewRequest(method, target, nil)
+	}
+	if len(contentType) > 0 {
+		r.Header.Set("Content-Type", contentType)
+	}
+	return r
+}
+
+// ---------------------------------------------------------------------------
+
+func TestBind(t *testing.T) {
+	const form = "application/x-www-form-urlencoded"
+
+	tests := []struct {
+		name   string
+		r      *http.Request
+		status int
+		fields []string
+	}{
+		{"json", bindRequest("POST", "/", "application/json", `{"name":"a","count":2,"mode":"fast","nested":{"level":1}}`), 0, nil},
+		{"json case insensitive", bindRequest("POST", "/", "", `{"NAME":"a","Count":0}`), 400, []string{"count"}},
+		{"json zero values not given", bindRequest("POST", "/", "application/json", `{"name":"a"}`), 0, nil},
+		{"json explicit zero", bindRequest("POST", "/", "application/json", `{"name":"a","count":0}`), 400, []string{"count"}},
+		{"json explicit empty enum", bindRequest("POST", "/", "application/json", `{"name":"a","mode":""}`), 400, []string{"mode"}},
+		{"json explicit null", bindRequest("POST", "/", "application/json", `{"name":"a","limit":null}`), 0, nil},
+		{"json explicit nested zero", bindRequest("POST", "/", "application/json", `{"name":"a","nested":{"level":0}}`), 400, []string{"nested.level"}},
+		{"json empty required", bindRequest("POST", "/", "application/json", `{"name":""}`), 400, []string{"name"}},
+		{"json above max", bindRequest("POST", "/", "application/json", `{"name":"a","count":20}`), 400, []string{"count"}},
+		{"json unknown field", bindRequest("POST", "/", "application/json", `{"name":"a","other":1}`), 400, []string{"other"}},
+		{"json type", bindRequest("POST", "/", "application/json", `{"name":"a","count":"1"}`), 400, []string{"count"}},
+		{"json syntax", bindRequest("POST", "/", "application/json", `{"name":`), 400, nil},
+		{"form", bindRequest("POST", "/", form, "name=a&n=3"), 0, nil},
+		{"form explicit zero", bindRequest("POST", "/", form, "name=a&n=0"), 400, []string{"count"}},
+		{"form explicit empty enum", bindRequest("POST", "/", form, "name=a&mode="), 400, []string{"mode"}},
+		{"form type", bindRequest("POST", "/", form, "name=a&n=x"), 400, []string{"n"}},
+		{"form unknown field", bindRequest("POST", "/", form, "name=a&x=1"), 400, []string{"x"}},
+		{"query", bindRequest("GET", "/?name=a&n=3&x=1", "", ""), 0, nil},
+		{"query explicit zero", bindRequest("GET", "/?name=a&n=0", "", ""), 400, []string{"count"}},
+		{"unsupported content type", bindRequest("POST", "/", "text/plain", "name=a"), 415, nil},
+	}
+
+	var ds Dispatcher
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var target bindTarget
+			err := ds.Bind(tt.r, &target)
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			p := ProblemFromError(err)
+			if err == nil || p.Status != tt.status {
+				t.Fatalf("error: '%v', want status %d", err, tt.status)
+			}
+			var fields []string
+			for _, fe := range p.Errors {
+				fields = append(fields, fe.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("fields: %v != %v (%s)", fields, tt.fields, err.Error())
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestBindWith(t *testing.T) {
+	var ds Dispatcher
+	var target bindTarget
+
+	r := bindRequest("POST", "/", "application/json", `{"name":"a","other":1}`)
+	if err := ds.BindWith(r, &target, BindOptions{AllowUnknownFields: true}); err != nil {
+		t.Errorf("unknown fields: %s", err.Error())
+	}
+
+	r = bindRequest("POST", "/", "application/json", `{"name":"abcdefgh"}`)
+	err := ds.BindWith(r, &target, BindOptions{MaxBodySize: 8})
+	if p := ProblemFromError(err); err == nil || p.Status != http.StatusRequestEntityTooLarge {
+		t.Errorf("body size: '%v'", err)
+	}
+
+	r = bindRequest("POST", "/", "application/json", `{"name":"a"}`)
+	if err := ds.Bind(r, target); err == nil || ProblemFromError(err).Status != http.StatusInternalServerError {
+		t.Errorf("no pointer: '%v'", err)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestBindQuery(t *testing.T) {
+	var ds Dispatcher
+	var target bindTarget
+
+	r := bindRequest("POST", "/?name=a&n=4", "application/json", `{"count":1}`)
+	if err := ds.BindQuery(r, &target); err != nil || target.Count != 4 {
+		t.Errorf("query: %d, '%v'", target.Count, err)
+	}
+
+	r = bindRequest("GET", "/?name=a&n=0", "", "")
+	if err := ds.BindQuery(r, &target); err == nil || ProblemFromError(err).Status != http.StatusBadRequest {
+		t.Errorf("explicit zero: '%v'", err)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestBindInvalidRule(t *testing.T) {
+	var ds Dispatcher
+	var target struct {
+		Mode string `json:"mode" validate:"oneof=a b"`
+	}
+
+	for _, body := range []string{`{"mode":"c"}`, `{"mode":""}`} {
+		r := bindRequest("POST", "/", "application/json", body)
+		err := ds.Bind(r, &target)
+		if p := ProblemFromError(err); err == nil || p.Status != http.StatusInternalServerError || len(p.Errors) > 0 {
+			t.Errorf("%s: '%v'", body, err)
+		}
+	}
+}
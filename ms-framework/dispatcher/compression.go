@@ -0,0 +1,341 @@
+package dispatcher
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher Compression
+// ###########################################################################
+// ###########################################################################
+
+// compressor writes one content encoding. Its writers are reused.
+type compressor struct {
+	pool sync.Pool
+}
+
+// encodingWriter is implemented by the gzip, brotli and zstd writers
+type encodingWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+var compressors = map[string]*compressor{
+	"gzip": {pool: sync.Pool{New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	}}},
+	"br": {pool: sync.Pool{New: func() interface{} {
+		return brotli.NewWriterLevel(nil, 4)
+	}}},
+	"zstd": {pool: sync.Pool{New: func() interface{} {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+		return w
+	}}},
+}
+
+// ###########################################################################
+
+// compressionHandler decompresses request bodies and compresses replies
+// with the encoding preferred by the client
+func (ds *Dispatcher) compressionHandler(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := decompressRequest(r); err != nil {
+			status, contentLen, msg := ds.ReplyProblem(w, r, NewProblem(http.StatusUnsupportedMediaType, err.Error()))
+			ds.logRequest(r, status, contentLen, msg)
+			return
+		}
+
+		var encoding string
+		var minSize int
+		var types []string
+
+		ds.ViewConfiguration(func() {
+			encoding = negotiateContentEncoding(r.Header.Get("Accept-Encoding"), ds.GetCompression())
+			minSize = ds.GetCompressionMinSize()
+			types = ds.GetCompressionTypes()
+		})
+
+		if len(encoding) == 0 || r.Method == http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			ds:             ds,
+			encoding:       encoding,
+			minSize:        minSize,
+			types:          types,
+		}
+		defer cw.close()
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		h.ServeHTTP(cw, r)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// decompressRequest replaces the body of r by its decoded content
+func decompressRequest(r *http.Request) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if len(encoding) == 0 || encoding == "identity" || r.Body == nil {
+		return nil
+	}
+
+	var body io.ReadCloser
+
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return fmt.Errorf("invalid gzip request body: %s", err.Error())
+		}
+		body = reader
+	case "br":
+		body = ioutil.NopCloser(brotli.NewReader(r.Body))
+	case "zstd":
+		reader, err := zstd.NewReader(r.Body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("invalid zstd request body: %s", err.Error())
+		}
+		body = reader.IOReadCloser()
+	default:
+		return fmt.Errorf("unsupported content encoding '%s'", encoding)
+	}
+
+	r.Body = &decodedBody{ReadCloser: body, source: r.Body}
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	return nil
+}
+
+// decodedBody closes the decoder and the original body
+type decodedBody struct {
+	io.ReadCloser
+	source io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.source.Close()
+}
+
+// ---------------------------------------------------------------------------
+
+// negotiateContentEncoding picks the encoding with the highest quality in
+// accept, which is enabled. Ties go to the first enabled one.
+func negotiateContentEncoding(accept string, enabled []string) string {
+	if len(accept) == 0 {
+		return ""
+	}
+
+	qualities := map[string]float64{}
+	for _, entry := range strings.Split(accept, ",") {
+		parts := strings.Split(entry, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		quality := 1.0
+		for _, param := range parts[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && kv[0] == "q" {
+				quality, _ = strconv.ParseFloat(kv[1], 64)
+			}
+		}
+		qualities[name] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, name := range enabled {
+		if _, exists := compressors[name]; !exists {
+			continue
+		}
+		quality, exists := qualities[name]
+		if !exists {
+			quality, exists = qualities["*"]
+		}
+		if exists && quality > bestQuality {
+			best, bestQuality = name, quality
+		}
+	}
+	return best
+}
+
+// ---------------------------------------------------------------------------
+
+// compressibleType reports if contentType matches one of types
+func compressibleType(contentType string, types []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == EventStreamContentType {
+		// Events must reach the client when they are flushed
+		return false
+	}
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// ###########################################################################
+
+// compressWriter buffers the start of a reply until it knows if the reply
+// is worth compressing: at least minSize bytes of an allowed content type
+// without an encoding of its own.
+type compressWriter struct {
+	http.ResponseWriter
+	ds       *Dispatcher
+	encoding string
+	minSize  int
+	types    []string
+
+	status   int
+	buffer   bytes.Buffer
+	decided  bool
+	hijacked bool
+	writer   encodingWriter
+	counter  countingWriter
+	plain    int
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.buffer.Write(p)
+		if cw.buffer.Len() < cw.minSize {
+			return len(p), nil
+		}
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.writer == nil {
+		return cw.ResponseWriter.Write(p)
+	}
+	cw.plain += len(p)
+	return cw.writer.Write(p)
+}
+
+// decide starts the reply, compressed or not, and writes the buffer
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	header := cw.Header()
+
+	compress := cw.buffer.Len() >= cw.minSize &&
+		len(header.Get("Content-Encoding")) == 0 &&
+		cw.status != http.StatusNoContent && cw.status != http.StatusNotModified &&
+		compressibleType(header.Get("Content-Type"), cw.types)
+
+	if compress {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		cw.counter.Writer = cw.ResponseWriter
+		cw.writer = compressors[cw.encoding].pool.Get().(encodingWriter)
+		cw.writer.Reset(&cw.counter)
+	}
+
+	if cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+
+	if cw.buffer.Len() == 0 {
+		return nil
+	}
+
+	data := cw.buffer.Bytes()
+	cw.buffer = bytes.Buffer{}
+
+	if cw.writer == nil {
+		_, err := cw.ResponseWriter.Write(data)
+		return err
+	}
+	cw.plain += len(data)
+	_, err := cw.writer.Write(data)
+	return err
+}
+
+// Flush sends what was written so far, streams are not held back
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide()
+	}
+	if cw.writer != nil {
+		cw.writer.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands the connection to the caller
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection can not be hijacked")
+	}
+	cw.hijacked = true
+	return hijacker.Hijack()
+}
+
+// close finishes the reply and records the compression ratio
+func (cw *compressWriter) close() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.decided {
+		cw.decide()
+	}
+	if cw.writer == nil {
+		return
+	}
+
+	cw.writer.Close()
+	cw.writer.Reset(nil)
+	compressors[cw.encoding].pool.Put(cw.writer)
+	cw.writer = nil
+
+	if cw.plain > 0 {
+		cw.ds.prometheusCompressionRatio.WithLabelValues(cw.encoding).Observe(float64(cw.counter.count) / float64(cw.plain))
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	io.Writer
+	count int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.Writer.Write(p)
+	c.count += n
+	return n, err
+}
@@ -0,0 +1,60 @@
+package dispatcher
+
+import "testing"
+
+func TestNegotiateContentEncoding(t *testing.T) {
+	enabled := []string{"gzip", "br", "zstd"}
+
+	tests := []struct {
+		accept  string
+		enabled []string
+		want    string
+	}{
+		{"", enabled, ""},
+		{"identity", enabled, ""},
+		{"gzip", enabled, "gzip"},
+		{"GZIP", enabled, "gzip"},
+		{"gzip, br", enabled, "gzip"},
+		{"br, gzip", enabled, "gzip"},
+		{"gzip;q=0.5, zstd", enabled, "zstd"},
+		{"gzip;q=0, br;q=0.1", enabled, "br"},
+		{"*", enabled, "gzip"},
+		{"*;q=0.2, zstd;q=0.5", enabled, "zstd"},
+		{"gzip", []string{"br"}, ""},
+		{"gzip, br", []string{"none"}, ""},
+		{"deflate", enabled, ""},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateContentEncoding(tt.accept, tt.enabled); got != tt.want {
+			t.Errorf("'%s' %v: '%s' != '%s'", tt.accept, tt.enabled, got, tt.want)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestCompressibleType(t *testing.T) {
+	types := []string{"application/json", " Text/* "}
+
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"application/json", true},
+		{"application/json; charset=utf-8", true},
+		{"text/plain", true},
+		{"text/html; charset=utf-8", true},
+		{"text/event-stream", false},
+		{"image/png", false},
+		{"application/jsonp", false},
+		{"", false},
+		{"invalid;;", false},
+	}
+
+	for _, tt := range tests {
+		if got := compressibleType(tt.contentType, types); got != tt.want {
+			t.Errorf("'%s': %t != %t", tt.contentType, got, tt.want)
+		}
+	}
+}
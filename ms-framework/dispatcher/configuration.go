@@ -9,12 +9,18 @@ type ResponseHeaderFunction func(out http.ResponseWriter, in *http.Request)
 
 // ConnectionConfiguration ...
 type ConnectionConfiguration struct {
-	Host      string `json:"host"`
-	Port      int    `json:"port"`
-	Namespace string `json:"namespace"`
-	Name      string `json:"name"`
-	Hostname  string `json:"hostname"`
-	Version   string `json:"version"`
+	Host      string `json:"host" default:"0.0.0.0" help:"Ip address to listen on."`
+	Port      int    `json:"port" default:"8080" validate:"min=0,max=65535" help:"Listen port."`
+	Namespace string `json:"namespace" help:"Prefix for all urls."`
+	Name      string `json:"name" help:"Name of the service."`
+	Hostname  string `json:"hostname" help:"Hostname of the service."`
+	Version   string `json:"version" help:"Version of the service."`
+
+	Listen []string `json:"listen" env:"MS_LISTEN" validate:"regex=^((https?|unix|systemd)://.*|[^/]*:[0-9]+)$" help:"Listen on this address instead of host and port ('https://[::]:8443', 'unix:///run/ms.sock?mode=0660&owner=user:group&tls=false', 'systemd://[name]')."`
+
+	HTTP2                bool `json:"http2" default:"true" help:"Offer HTTP/2 on TLS listeners."`
+	H2C                  bool `json:"h2c" help:"Accept HTTP/2 without TLS (h2c) on plain listeners, e.g. behind a sidecar."`
+	MaxConcurrentStreams int  `json:"maxconcurrentstreams" default:"250" validate:"min=0" help:"Maximum of concurrent HTTP/2 streams per connection."`
 }
 
 // IConnectionConfiguration ...
@@ -26,13 +32,17 @@ type IConnectionConfiguration interface {
 	GetName() string
 	GetHostname() string
 	GetVersion() string
+	GetListen() []string
+	GetHTTP2() bool
+	GetH2C() bool
+	GetMaxConcurrentStreams() int
 }
 
 // TLSConfiguration ...
 type TLSConfiguration struct {
-	CertChainFile string `json:"certchainfile"`
-	KeyFile       string `json:"keyfile"`
-	CAFile        string `json:"cafile"`
+	CertChainFile string `json:"certchainfile" flag:"cert" env:"MS_CERTCHAINFILE" help:"Certificate chain (host cert + all sigining CAs)"`
+	KeyFile       string `json:"keyfile" flag:"key" env:"MS_KEYFILE" help:"Private key file."`
+	CAFile        string `json:"cafile" flag:"ca" env:"MS_CAFILE" help:"CA chains."`
 }
 
 // ITLSConfiguration ...
@@ -45,9 +55,23 @@ type ITLSConfiguration interface {
 // LimitConfiguration ...
 type LimitConfiguration struct {
 	// MaxTcpConnections int `json:"maxtcpconnections"`
-	MaxConnections int `json:"maxconnections"`
-	DelayReply     int `json:"delayreply"`
-	ClientTimeout  int `json:"clienttimeout"`
+	MaxConnections int `json:"maxconnections" validate:"min=0" help:"Maximum of parallel connections to accept."`
+	DelayReply     int `json:"delayreply" reload:"safe" validate:"min=0" help:"Slow down replying by this amount of ms."`
+	ClientTimeout  int `json:"clienttimeout" default:"1500" validate:"min=0" help:"Timeout of HTTP client in ms."`
+
+	ReadHeaderTimeout int `json:"readheadertimeout" default:"5000" validate:"min=0" help:"Timeout for reading the headers of a request in ms (0=read timeout)."`
+	ReadTimeout       int `json:"readtimeout" default:"30000" validate:"min=0" help:"Timeout for reading a request including its body in ms (0=none)."`
+	WriteTimeout      int `json:"writetimeout" validate:"min=0" help:"Timeout for writing a reply in ms, this also ends streamed replies (0=none)."`
+	IdleTimeout       int `json:"idletimeout" default:"120000" validate:"min=0" help:"Close idle keep-alive connections after ms (0=read timeout)."`
+	MaxHeaderBytes    int `json:"maxheaderbytes" default:"65536" validate:"min=0" help:"Maximum size of the request headers."`
+	ShutdownTimeout   int `json:"shutdowntimeout" default:"10000" validate:"min=0" help:"Wait for requests to finish on shutdown (SIGINT or SIGTERM) for ms (0=no limit)."`
+
+	// A reloaded MaxBodySize applies to HTTP routes only, the gRPC server
+	// keeps the message size limit it was created with
+	MaxBodySize    int `json:"maxbodysize" default:"10485760" reload:"safe" validate:"min=0" help:"Maximum size of a request body, if its route does not set one (0=none). gRPC messages keep the limit the service was started with."`
+	RequestTimeout int `json:"requesttimeout" default:"30000" reload:"safe" validate:"min=0" help:"Cancel the context of a request after ms, if its route does not set a timeout (0=none)."`
+	EventHeartbeat int `json:"eventheartbeat" default:"15000" reload:"safe" validate:"min=0" help:"Send a comment on event streams every ms, so proxies keep them open (0=never)."`
+	WebSocketPing  int `json:"websocketping" default:"30000" reload:"safe" validate:"min=0" help:"Ping WebSocket clients every ms and close the connection if they don't answer (0=never)."`
 }
 
 // ILimitConfiguration ...
@@ -56,11 +80,21 @@ type ILimitConfiguration interface {
 	GetMaxConnections() int
 	GetDelayReply() int
 	GetClientTimeout() int
+	GetReadHeaderTimeout() int
+	GetReadTimeout() int
+	GetWriteTimeout() int
+	GetIdleTimeout() int
+	GetMaxHeaderBytes() int
+	GetShutdownTimeout() int
+	GetMaxBodySize() int
+	GetRequestTimeout() int
+	GetEventHeartbeat() int
+	GetWebSocketPing() int
 }
 
 // LogConfiguration ...
 type LogConfiguration struct {
-	Logfile string `json:"logfile"`
+	Logfile string `json:"logfile" reload:"safe" help:"Logfile (empty=stdout)."`
 }
 
 // ILogConfiguration ...
@@ -70,7 +104,7 @@ type ILogConfiguration interface {
 
 // MetricsConfiguration ...
 type MetricsConfiguration struct {
-	NoMetrics bool `json:"nometrics"`
+	NoMetrics bool `json:"nometrics" env:"MS_NO_METRICS" envset:"true" help:"Don't report metrics.."`
 }
 
 // IMetricsConfiguration ...
@@ -80,7 +114,7 @@ type IMetricsConfiguration interface {
 
 // AuthConfiguration ...
 type AuthConfiguration struct {
-	Passwordfile string `json:"passwordfile"`
+	Passwordfile string `json:"passwordfile" reload:"safe" help:"User/password list."`
 }
 
 // ILogConfiguration ...
@@ -96,16 +130,128 @@ func (cs *HeaderList) Set(value string) error {
 	return nil
 }
 
+// AdminConfiguration ...
+type AdminConfiguration struct {
+	AdminHost          string   `json:"adminhost" help:"Ip address of the admin listener."`
+	AdminPort          int      `json:"adminport" validate:"min=0,max=65535" help:"Port of the admin listener (disabled if not set)."`
+	AdminCertChainFile string   `json:"admincertchainfile" flag:"admincert" env:"MS_ADMINCERTCHAINFILE" help:"Certificate chain of the admin listener."`
+	AdminKeyFile       string   `json:"adminkeyfile" flag:"adminkey" env:"MS_ADMINKEYFILE" help:"Private key file of the admin listener."`
+	AdminCAFile        string   `json:"admincafile" flag:"adminca" env:"MS_ADMINCAFILE" help:"CA chains to verify clients of the admin listener."`
+	AdminEndpoints     []string `json:"adminendpoints" flag:"adminendpoint" env:"MS_ADMINENDPOINTS" validate:"enum=metrics|status|debug|health" help:"Serve this built-in endpoint (metrics, status, debug, health) on the admin listener (default all)."`
+}
+
+// IAdminConfiguration ...
+type IAdminConfiguration interface {
+	GetAdminHost() string
+	GetAdminPort() int
+	GetAdminCertChainFile() string
+	GetAdminKeyFile() string
+	GetAdminCAFile() string
+	GetAdminEndpoints() []string
+}
+
+// DebugConfiguration ...
+type DebugConfiguration struct {
+	Debug     bool   `json:"debug" help:"Serve pprof, expvar and configuration debug endpoints (requires a passwordfile)."`
+	DebugPath string `json:"debugpath" help:"Path of the debug endpoints (default /debug)."`
+	Repanic   bool   `json:"repanic" help:"Panic again after a handler panic was recovered and logged (for tests)."`
+}
+
+// IDebugConfiguration ...
+type IDebugConfiguration interface {
+	GetDebug() bool
+	GetDebugPath() string
+	GetRepanic() bool
+}
+
+// GRPCConfiguration ...
+type GRPCConfiguration struct {
+	GRPC           bool `json:"grpc" help:"Serve the registered gRPC services."`
+	GRPCPort       int  `json:"grpcport" validate:"min=0,max=65535" help:"Port of the gRPC listener (0=serve gRPC on the listeners of the service, which requires HTTP/2 or h2c)."`
+	GRPCReflection bool `json:"grpcreflection" default:"true" help:"Serve the gRPC reflection service."`
+}
+
+// IGRPCConfiguration ...
+type IGRPCConfiguration interface {
+	GetGRPC() bool
+	GetGRPCPort() int
+	GetGRPCReflection() bool
+}
+
+// ProxyConfiguration ...
+type ProxyConfiguration struct {
+	Proxy []string `json:"proxy" env:"MS_PROXY" validate:"regex=^/\\S*=[a-z]+://\\S+$" help:"Forward the requests below a prefix to an upstream, replacing namespace and prefix ('/devices/=service://devices/', see ProxyRoute)."`
+}
+
+// IProxyConfiguration ...
+type IProxyConfiguration interface {
+	GetProxy() []string
+}
+
+// RecordConfiguration ...
+type RecordConfiguration struct {
+	Record            string   `json:"record" env:"MS_RECORD" help:"Record requests and replies to this file, see recordformat."`
+	RecordFormat      string   `json:"recordformat" default:"jsonl" validate:"enum=jsonl|har" help:"Format of the recording, jsonl (appended) or har (replaced)."`
+	RecordRoutes      []string `json:"recordroutes" flag:"recordroute" env:"MS_RECORDROUTES" reload:"safe" help:"Record requests to this path without namespace, a trailing '*' matches any suffix (default all)."`
+	RecordRedact      []string `json:"recordredact" flag:"recordredact" env:"MS_RECORDREDACT" reload:"safe" help:"Redact this header in recordings, Authorization, Proxy-Authorization, Cookie and Set-Cookie always are."`
+	RecordRedactQuery []string `json:"recordredactquery" flag:"recordredactquery" env:"MS_RECORDREDACTQUERY" reload:"safe" help:"Redact this query parameter in recordings, access_token, token, api_key, apikey, key, password and secret always are."`
+	RecordMaxBody     int      `json:"recordmaxbody" default:"65536" reload:"safe" validate:"min=0" help:"Record at most n bytes of each body."`
+}
+
+// IRecordConfiguration ...
+type IRecordConfiguration interface {
+	GetRecord() string
+	GetRecordFormat() string
+	GetRecordRoutes() []string
+	GetRecordRedact() []string
+	GetRecordRedactQuery() []string
+	GetRecordMaxBody() int
+}
+
+// CORSConfiguration ...
+type CORSConfiguration struct {
+	CORSOrigins       []string `json:"corsorigins" flag:"corsorigin" env:"MS_CORSORIGINS" default:"*" reload:"safe" help:"Allowed origin, '*' for all (ignored with corscredentials), 'https://*.example.com' for subdomains."`
+	CORSMethods       []string `json:"corsmethods" flag:"corsmethod" env:"MS_CORSMETHODS" reload:"safe" help:"Allowed method (default the methods of the route)."`
+	CORSHeaders       []string `json:"corsheaders" flag:"corsheader" env:"MS_CORSHEADERS" reload:"safe" help:"Allowed request header (default Content-Type and the tracing headers)."`
+	CORSExposeHeaders []string `json:"corsexposeheaders" flag:"corsexposeheader" env:"MS_CORSEXPOSEHEADERS" reload:"safe" help:"Response header readable by scripts, X-cid, X-chost and X-version always are."`
+	CORSCredentials   bool     `json:"corscredentials" reload:"safe" help:"Allow requests with cookies or authorization."`
+	CORSMaxAge        int      `json:"corsmaxage" reload:"safe" validate:"min=0" help:"Let browsers cache preflight results for n seconds."`
+}
+
+// CompressionConfiguration ...
+type CompressionConfiguration struct {
+	Compression        []string `json:"compression" env:"MS_COMPRESSION" default:"gzip,br,zstd" reload:"safe" validate:"enum=gzip|br|zstd|none" help:"Compress replies with these encodings, by preference ('none' disables it)."`
+	CompressionMinSize int      `json:"compressionminsize" default:"1024" reload:"safe" validate:"min=0" help:"Compress replies of at least this many bytes."`
+	CompressionTypes   []string `json:"compressiontypes" flag:"compressiontype" env:"MS_COMPRESSIONTYPES" default:"application/json,application/problem+json,application/yaml,application/msgpack,application/cbor,text/*" reload:"safe" help:"Compress replies of this content type, 'text/*' matches all subtypes."`
+}
+
+// ICompressionConfiguration ...
+type ICompressionConfiguration interface {
+	GetCompression() []string
+	GetCompressionMinSize() int
+	GetCompressionTypes() []string
+}
+
+// ICORSConfiguration ...
+type ICORSConfiguration interface {
+	GetCORSOrigins() []string
+	GetCORSMethods() []string
+	GetCORSHeaders() []string
+	GetCORSExposeHeaders() []string
+	GetCORSCredentials() bool
+	GetCORSMaxAge() int
+}
+
 // HeaderConfiguration ...
 type HeaderConfiguration struct {
-	RequestHeaderFunctions  [](RequestHeaderFunction)
-	RequestHeaderStrings    []string
-	RequestHeaders          []*Header
-	ResponseHeaderFunctions [](ResponseHeaderFunction)
-	ResponseHeaderStrings   []string
-	ResponseHeaders         []*Header
-	CopyHeaderStrings       []string
-	CopyHeaderOperations    []*HeaderOperation
+	RequestHeaderFunctions  [](RequestHeaderFunction)  `json:"-"`
+	RequestHeaderStrings    []string                   `json:"requestheaders" reload:"safe" flag:"requestheader" env:"MS_REQUESTHEADERS" sep:";" validate:"regex=^(\\[[^]]*\\]\\s*)?(-\\S+|[^:>]+>.+|[^:]+:.*)$" help:"Header rule for outgoing requests ('Key: value', 'Key?: value', '-Key', 'Old>New', see Header)."`
+	RequestHeaders          []*Header                  `json:"-"`
+	ResponseHeaderFunctions [](ResponseHeaderFunction) `json:"-"`
+	ResponseHeaderStrings   []string                   `json:"responseheaders" reload:"safe" flag:"responseheader" env:"MS_RESPONSEHEADERS" sep:";" validate:"regex=^(\\[[^]]*\\]\\s*)?(-\\S+|[^:>]+>.+|[^:]+:.*)$" help:"Header rule for outgoing replies ('Key: value', 'Key?: value', '-Key', 'Old>New', see Header)."`
+	ResponseHeaders         []*Header                  `json:"-"`
+	CopyHeaderStrings       []string                   `json:"copyheaders" reload:"safe" flag:"copyheader" env:"MS_COPYHEADERS" validate:"regex=^(\\[[^]]*\\]\\s*)?((copy|append|force):)?[^:\\s]+$" help:"Copy this header from incoming requests ('Key', 'append:Key', 'force:Key')."`
+	CopyHeaderOperations    []*HeaderOperation         `json:"-"`
 }
 
 type IHeaderConfiguration interface {
@@ -119,6 +265,12 @@ type IHeaderConfiguration interface {
 	GetResponseHeaderFunctions() []ResponseHeaderFunction
 	GetCopyHeaderOperations() []*HeaderOperation
 	AddCopyHeaderOperation(op *HeaderOperation)
+	RemoveRequestHeader(h *Header)
+	RemoveResponseHeader(h *Header)
+	RemoveCopyHeaderOperation(op *HeaderOperation)
+	GetRequestHeaderStrings() []string
+	GetResponseHeaderStrings() []string
+	GetCopyHeaderStrings() []string
 }
 
 // Configuration ...
@@ -129,6 +281,13 @@ type Configuration struct {
 	LogConfiguration
 	MetricsConfiguration
 	AuthConfiguration
+	AdminConfiguration
+	DebugConfiguration
+	GRPCConfiguration
+	ProxyConfiguration
+	RecordConfiguration
+	CORSConfiguration
+	CompressionConfiguration
 	HeaderConfiguration
 }
 
@@ -140,6 +299,13 @@ type IConfiguration interface {
 	ILogConfiguration
 	IMetricsConfiguration
 	IAuthConfiguration
+	IAdminConfiguration
+	IDebugConfiguration
+	IGRPCConfiguration
+	IProxyConfiguration
+	IRecordConfiguration
+	ICORSConfiguration
+	ICompressionConfiguration
 	IHeaderConfiguration
 }
 
@@ -164,6 +330,18 @@ func (cfg ConnectionConfiguration) GetHostname() string { return cfg.Hostname }
 // GetVersion ...
 func (cfg ConnectionConfiguration) GetVersion() string { if cfg.Version == "" { return _build_version } else { return cfg.Version } }
 
+// GetListen ...
+func (cfg *ConnectionConfiguration) GetListen() []string { return cfg.Listen }
+
+// GetHTTP2 ...
+func (cfg *ConnectionConfiguration) GetHTTP2() bool { return cfg.HTTP2 }
+
+// GetH2C ...
+func (cfg *ConnectionConfiguration) GetH2C() bool { return cfg.H2C }
+
+// GetMaxConcurrentStreams ...
+func (cfg *ConnectionConfiguration) GetMaxConcurrentStreams() int { return cfg.MaxConcurrentStreams }
+
 // GetCertChainFile ...
 func (cfg *TLSConfiguration) GetCertChainFile() string { return cfg.CertChainFile }
 
@@ -185,6 +363,36 @@ func (cfg *LimitConfiguration) GetDelayReply() int { return cfg.DelayReply }
 // GetDelayReply ...
 func (cfg *LimitConfiguration) GetClientTimeout() int { return cfg.ClientTimeout }
 
+// GetReadHeaderTimeout ...
+func (cfg *LimitConfiguration) GetReadHeaderTimeout() int { return cfg.ReadHeaderTimeout }
+
+// GetReadTimeout ...
+func (cfg *LimitConfiguration) GetReadTimeout() int { return cfg.ReadTimeout }
+
+// GetWriteTimeout ...
+func (cfg *LimitConfiguration) GetWriteTimeout() int { return cfg.WriteTimeout }
+
+// GetIdleTimeout ...
+func (cfg *LimitConfiguration) GetIdleTimeout() int { return cfg.IdleTimeout }
+
+// GetMaxHeaderBytes ...
+func (cfg *LimitConfiguration) GetMaxHeaderBytes() int { return cfg.MaxHeaderBytes }
+
+// GetShutdownTimeout ...
+func (cfg *LimitConfiguration) GetShutdownTimeout() int { return cfg.ShutdownTimeout }
+
+// GetMaxBodySize ...
+func (cfg *LimitConfiguration) GetMaxBodySize() int { return cfg.MaxBodySize }
+
+// GetRequestTimeout ...
+func (cfg *LimitConfiguration) GetRequestTimeout() int { return cfg.RequestTimeout }
+
+// GetEventHeartbeat ...
+func (cfg *LimitConfiguration) GetEventHeartbeat() int { return cfg.EventHeartbeat }
+
+// GetWebSocketPing ...
+func (cfg *LimitConfiguration) GetWebSocketPing() int { return cfg.WebSocketPing }
+
 // GetLogfile ...
 func (cfg *LogConfiguration) GetLogfile() string { return cfg.Logfile }
 
@@ -194,6 +402,100 @@ func (cfg *MetricsConfiguration) GetNoMetrics() bool { return cfg.NoMetrics }
 // GetPasswordfile ...
 func (cfg *AuthConfiguration) GetPasswordfile() string { return cfg.Passwordfile }
 
+// GetAdminHost ...
+func (cfg *AdminConfiguration) GetAdminHost() string { return cfg.AdminHost }
+
+// GetAdminPort ...
+func (cfg *AdminConfiguration) GetAdminPort() int { return cfg.AdminPort }
+
+// GetAdminCertChainFile ...
+func (cfg *AdminConfiguration) GetAdminCertChainFile() string { return cfg.AdminCertChainFile }
+
+// GetAdminKeyFile ...
+func (cfg *AdminConfiguration) GetAdminKeyFile() string { return cfg.AdminKeyFile }
+
+// GetAdminCAFile ...
+func (cfg *AdminConfiguration) GetAdminCAFile() string { return cfg.AdminCAFile }
+
+// GetAdminEndpoints ...
+func (cfg *AdminConfiguration) GetAdminEndpoints() []string { return cfg.AdminEndpoints }
+
+// GetDebug ...
+func (cfg *DebugConfiguration) GetDebug() bool { return cfg.Debug }
+
+// GetDebugPath ...
+func (cfg *DebugConfiguration) GetDebugPath() string {
+	if cfg.DebugPath == "" {
+		return "/debug"
+	}
+	return cfg.DebugPath
+}
+
+// GetRepanic ...
+func (cfg *DebugConfiguration) GetRepanic() bool { return cfg.Repanic }
+
+// GetGRPC ...
+func (cfg *GRPCConfiguration) GetGRPC() bool { return cfg.GRPC }
+
+// GetGRPCPort ...
+func (cfg *GRPCConfiguration) GetGRPCPort() int { return cfg.GRPCPort }
+
+// GetGRPCReflection ...
+func (cfg *GRPCConfiguration) GetGRPCReflection() bool { return cfg.GRPCReflection }
+
+// GetProxy ...
+func (cfg *ProxyConfiguration) GetProxy() []string { return cfg.Proxy }
+
+// GetRecord ...
+func (cfg *RecordConfiguration) GetRecord() string { return cfg.Record }
+
+// GetRecordFormat ...
+func (cfg *RecordConfiguration) GetRecordFormat() string { return cfg.RecordFormat }
+
+// GetRecordRoutes ...
+func (cfg *RecordConfiguration) GetRecordRoutes() []string { return cfg.RecordRoutes }
+
+// GetRecordRedact ...
+func (cfg *RecordConfiguration) GetRecordRedact() []string { return cfg.RecordRedact }
+
+// GetRecordRedactQuery ...
+func (cfg *RecordConfiguration) GetRecordRedactQuery() []string { return cfg.RecordRedactQuery }
+
+// GetRecordMaxBody ...
+func (cfg *RecordConfiguration) GetRecordMaxBody() int { return cfg.RecordMaxBody }
+
+// GetCORSOrigins ...
+func (cfg *CORSConfiguration) GetCORSOrigins() []string { return cfg.CORSOrigins }
+
+// GetCORSMethods ...
+func (cfg *CORSConfiguration) GetCORSMethods() []string { return cfg.CORSMethods }
+
+// GetCORSHeaders ...
+func (cfg *CORSConfiguration) GetCORSHeaders() []string {
+	if len(cfg.CORSHeaders) == 0 {
+		return defaultCORSHeaders
+	}
+	return cfg.CORSHeaders
+}
+
+// GetCORSExposeHeaders ...
+func (cfg *CORSConfiguration) GetCORSExposeHeaders() []string { return cfg.CORSExposeHeaders }
+
+// GetCORSCredentials ...
+func (cfg *CORSConfiguration) GetCORSCredentials() bool { return cfg.CORSCredentials }
+
+// GetCORSMaxAge ...
+func (cfg *CORSConfiguration) GetCORSMaxAge() int { return cfg.CORSMaxAge }
+
+// GetCompression ...
+func (cfg *CompressionConfiguration) GetCompression() []string { return cfg.Compression }
+
+// GetCompressionMinSize ...
+func (cfg *CompressionConfiguration) GetCompressionMinSize() int { return cfg.CompressionMinSize }
+
+// GetCompressionTypes ...
+func (cfg *CompressionConfiguration) GetCompressionTypes() []string { return cfg.CompressionTypes }
+
 // AddRequestHeaderFunction ...
 func (cfg *HeaderConfiguration) AddRequestHeaderFunction(fn RequestHeaderFunction) {
 	cfg.RequestHeaderFunctions = append(cfg.RequestHeaderFunctions, fn)
@@ -243,3 +545,48 @@ func (cfg *HeaderConfiguration) AddCopyHeaderOperation(op *HeaderOperation) {
 func (cfg *HeaderConfiguration) GetCopyHeaderOperations() []*HeaderOperation {
 	return cfg.CopyHeaderOperations
 }
+
+// RemoveRequestHeader ...
+func (cfg *HeaderConfiguration) RemoveRequestHeader(h *Header) {
+	for i, entry := range cfg.RequestHeaders {
+		if entry == h {
+			cfg.RequestHeaders = append(cfg.RequestHeaders[:i:i], cfg.RequestHeaders[i+1:]...)
+			return
+		}
+	}
+}
+
+// RemoveResponseHeader ...
+func (cfg *HeaderConfiguration) RemoveResponseHeader(h *Header) {
+	for i, entry := range cfg.ResponseHeaders {
+		if entry == h {
+			cfg.ResponseHeaders = append(cfg.ResponseHeaders[:i:i], cfg.ResponseHeaders[i+1:]...)
+			return
+		}
+	}
+}
+
+// RemoveCopyHeaderOperation ...
+func (cfg *HeaderConfiguration) RemoveCopyHeaderOperation(op *HeaderOperation) {
+	for i, entry := range cfg.CopyHeaderOperations {
+		if entry == op {
+			cfg.CopyHeaderOperations = append(cfg.CopyHeaderOperations[:i:i], cfg.CopyHeaderOperations[i+1:]...)
+			return
+		}
+	}
+}
+
+// GetRequestHeaderStrings ...
+func (cfg *HeaderConfiguration) GetRequestHeaderStrings() []string {
+	return cfg.RequestHeaderStrings
+}
+
+// GetResponseHeaderStrings ...
+func (cfg *HeaderConfiguration) GetResponseHeaderStrings() []string {
+	return cfg.ResponseHeaderStrings
+}
+
+// GetCopyHeaderStrings ...
+func (cfg *HeaderConfiguration) GetCopyHeaderStrings() []string {
+	return cfg.CopyHeaderStrings
+}
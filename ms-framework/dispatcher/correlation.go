@@ -0,0 +1,112 @@
+package dispatcher
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher Correlation IDs
+// ###########################################################################
+// ###########################################################################
+
+// HeaderCorrelationID identifies all requests of one call chain
+const HeaderCorrelationID = "X-Correlation-Id"
+
+// HeaderRequestID identifies a request as it is passed on, like envoy does
+const HeaderRequestID = "X-Request-Id"
+
+// RequestIDs are the ids of a request, taken from its headers or generated
+// when it was received
+type RequestIDs struct {
+	CorrelationID string
+	RequestID     string
+}
+
+type contextKey int
+
+const (
+	requestIDsKey contextKey = iota
+	incomingHeaderKey
+)
+
+// ###########################################################################
+
+// GetRequestIDs returns the ids stored in ctx by the dispatcher, or empty ids
+func GetRequestIDs(ctx context.Context) RequestIDs {
+	if ctx == nil {
+		return RequestIDs{}
+	}
+	ids, _ := ctx.Value(requestIDsKey).(RequestIDs)
+	return ids
+}
+
+// ---------------------------------------------------------------------------
+
+// WithRequestIDs returns a copy of ctx carrying ids. Outgoing requests made
+// with this context get the ids as headers from SetRequestHeaders.
+func WithRequestIDs(ctx context.Context, ids RequestIDs) context.Context {
+	return context.WithValue(ctx, requestIDsKey, ids)
+}
+
+// ---------------------------------------------------------------------------
+
+// requestIDs returns the ids of r from its context, or its headers if it did
+// not pass the dispatcher
+func requestIDs(r *http.Request) RequestIDs {
+	ids := GetRequestIDs(r.Context())
+	if len(ids.CorrelationID) == 0 {
+		ids.CorrelationID = r.Header.Get(HeaderCorrelationID)
+	}
+	if len(ids.RequestID) == 0 {
+		ids.RequestID = r.Header.Get(HeaderRequestID)
+	}
+	return ids
+}
+
+// ###########################################################################
+
+// correlationHandler generates missing ids of incoming requests. They are
+// set on the request, so they are copied to replies and outgoing requests
+// like the other tracing headers, stored in the request context and echoed
+// right away, for replies which do not set the response headers.
+func (ds *Dispatcher) correlationHandler(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ids := RequestIDs{
+			CorrelationID: r.Header.Get(HeaderCorrelationID),
+			RequestID:     r.Header.Get(HeaderRequestID),
+		}
+
+		if len(ids.CorrelationID) == 0 {
+			ids.CorrelationID = newUUID()
+			r.Header.Set(HeaderCorrelationID, ids.CorrelationID)
+		}
+
+		if len(ids.RequestID) == 0 {
+			ids.RequestID = newUUID()
+			r.Header.Set(HeaderRequestID, ids.RequestID)
+		}
+
+		w.Header().Set(HeaderCorrelationID, ids.CorrelationID)
+		w.Header().Set(HeaderRequestID, ids.RequestID)
+
+		h.ServeHTTP(w, r.WithContext(WithRequestIDs(r.Context(), ids)))
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// logRequest writes the log line of a served request
+func (ds *Dispatcher) logRequest(r *http.Request, status int, contentLen int, msg string) {
+	ids := requestIDs(r)
+
+	// Handlers mounted with StripPrefix see an empty path
+	path := r.URL.Path
+	if len(path) == 0 {
+		path = strings.SplitN(r.RequestURI, "?", 2)[0]
+	}
+
+	ds.GetLogger().Printf("> %-6.6s | %3d | %6d | %-*.*s | %-36.36s | %-36.36s | %s\n", r.Method, status, contentLen, ds.maxPathLen, ds.maxPathLen, path, ids.CorrelationID, ids.RequestID, msg)
+}
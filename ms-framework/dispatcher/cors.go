@@ -0,0 +1,176 @@
+package dispatcher
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher CORS
+// ###########################################################################
+// ###########################################################################
+
+// defaultCORSHeaders are allowed in requests if no headers are configured
+var defaultCORSHeaders = []string{
+	"Content-Type",
+	"X-Cid", "X-Chost", "X-Version", "X-Namespace", "X-Environment",
+	"x-session-id", "x-correlation-id", "x-sequence-nr", "x-request-id",
+	"x-b3-traceid", "x-b3-spanid", "x-b3-parentspanid", "x-b3-sampled", "x-b3-flags", "b3",
+	"x-ot-span-context",
+}
+
+// fixedCORSExposeHeaders are always readable by scripts of allowed origins
+var fixedCORSExposeHeaders = []string{"X-cid", "X-chost", "X-version", HeaderCorrelationID, HeaderRequestID}
+
+// allMethods are allowed for routes which handle any method
+var allMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// ###########################################################################
+
+// corsHandler answers preflight requests for all routes and adds the CORS
+// headers to all other replies. It runs before the wrappers, as browsers
+// send preflights without credentials.
+func (ds *Dispatcher) corsHandler(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions && len(r.Header.Get("Origin")) > 0 && len(r.Header.Get("Access-Control-Request-Method")) > 0 {
+			status, msg := ds.corsPreflight(w, r)
+			ds.logRequest(r, status, 0, msg)
+			return
+		}
+
+		ds.ViewConfiguration(func() { ds.setCORSHeaders(w, r) })
+		h.ServeHTTP(w, r)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// corsPreflight replies to a preflight with the methods of the requested
+// route
+func (ds *Dispatcher) corsPreflight(w http.ResponseWriter, r *http.Request) (status int, msg string) {
+	ds.prometheusOps.Inc()
+
+	allowed := false
+	ds.ViewConfiguration(func() {
+		if allowed = ds.setCORSHeaders(w, r); allowed {
+			ds.setCORSPreflightHeaders(w, ds.routeMethods(r))
+		}
+	})
+
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		return http.StatusForbidden, fmt.Sprintf("CORS origin '%s' not allowed.", r.Header.Get("Origin"))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return http.StatusNoContent, "Sent CORS preflight."
+}
+
+// ---------------------------------------------------------------------------
+
+// setCORSHeaders adds the headers for all replies and reports if the origin
+// of the request is allowed. Requests without origin get a wildcard if all
+// origins are allowed without credentials, as they always did. With
+// credentials only the listed origins are allowed, '*' is ignored.
+func (ds *Dispatcher) setCORSHeaders(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	credentials := ds.GetCORSCredentials()
+	wildcard := !credentials && matchesOrigin(ds.GetCORSOrigins(), "*", false)
+
+	switch {
+	case wildcard:
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	case len(origin) > 0 && matchesOrigin(ds.GetCORSOrigins(), origin, credentials):
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+	default:
+		return false
+	}
+
+	if ds.GetCORSCredentials() {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	expose := append(append([]string{}, fixedCORSExposeHeaders...), ds.GetCORSExposeHeaders()...)
+	w.Header().Set("Access-Control-Expose-Headers", strings.Join(expose, ", "))
+	return true
+}
+
+// ---------------------------------------------------------------------------
+
+// setCORSPreflightHeaders adds the headers answering a preflight. Configured
+// methods override the ones of the route.
+func (ds *Dispatcher) setCORSPreflightHeaders(w http.ResponseWriter, methods []string) {
+	if len(ds.GetCORSMethods()) > 0 {
+		methods = ds.GetCORSMethods()
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	w.Header().Set("Access-Control-Allow-Headers", strings.Join(ds.GetCORSHeaders(), ", "))
+
+	if ds.GetCORSMaxAge() > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(ds.GetCORSMaxAge()))
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// routeMethods returns the methods the route matching r has handlers for
+func (ds *Dispatcher) routeMethods(r *http.Request) []string {
+	_, pattern := ds.muxer.Handler(r)
+	handlers, exists := ds.routes[pattern]
+	if !exists || len(handlers.methods) == 0 {
+		return allMethods
+	}
+	return handlers.methods
+}
+
+// ###########################################################################
+
+// matchesOrigin reports if origin is matched by one of patterns. Patterns are
+// '*', an origin like 'https://example.com', or an origin with a wildcard
+// subdomain like 'https://*.example.com'. Without scheme a pattern matches
+// any scheme. With credentials '*' matches nothing, as any site could read
+// the replies in the name of the user otherwise.
+func matchesOrigin(patterns []string, origin string, credentials bool) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			if !credentials {
+				return true
+			}
+			continue
+		}
+
+		if strings.EqualFold(pattern, origin) {
+			return true
+		}
+
+		idx := strings.Index(pattern, "*.")
+		if idx < 0 {
+			continue
+		}
+
+		scheme, suffix := strings.ToLower(pattern[:idx]), strings.ToLower(pattern[idx+1:])
+		rest := strings.ToLower(origin)
+
+		if len(scheme) > 0 {
+			if !strings.HasPrefix(rest, scheme) {
+				continue
+			}
+			rest = rest[len(scheme):]
+		} else if i := strings.Index(rest, "://"); i >= 0 {
+			rest = rest[i+3:]
+		}
+
+		if len(rest) > len(suffix) && strings.HasSuffix(rest, suffix) && !strings.Contains(rest, "/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package dispatcher
+
+import "testing"
+
+func TestMatchesOrigin(t *testing.T) {
+	tests := []struct {
+		name        string
+		patterns    []string
+		origin      string
+		credentials bool
+		want        bool
+	}{
+		{"wildcard", []string{"*"}, "https://evil.example", false, true},
+		{"wildcard with credentials", []string{"*"}, "https://evil.example", true, false},
+		{"listed with credentials", []string{"*", "https://app.example.com"}, "https://app.example.com", true, true},
+		{"exact", []string{"https://app.example.com"}, "https://app.example.com", false, true},
+		{"case insensitive", []string{"https://App.Example.com"}, "https://app.example.com", false, true},
+		{"other scheme", []string{"https://app.example.com"}, "http://app.example.com", false, false},
+		{"subdomain", []string{"https://*.example.com"}, "https://app.example.com", false, true},
+		{"subdomain with credentials", []string{"https://*.example.com"}, "https://app.example.com", true, true},
+		{"nested subdomain", []string{"https://*.example.com"}, "https://a.b.example.com", false, true},
+		{"domain itself", []string{"https://*.example.com"}, "https://example.com", false, false},
+		{"subdomain other scheme", []string{"https://*.example.com"}, "http://app.example.com", false, false},
+		{"subdomain any scheme", []string{"*.example.com"}, "http://app.example.com", false, true},
+		{"suffix only", []string{"https://*.example.com"}, "https://evilexample.com", false, false},
+		{"suffix in path", []string{"https://*.example.com"}, "https://evil.com/x.example.com", false, false},
+		{"no patterns", nil, "https://app.example.com", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesOrigin(tt.patterns, tt.origin, tt.credentials); got != tt.want {
+				t.Errorf("matchesOrigin(%v, '%s', %t) = %t, want %t", tt.patterns, tt.origin, tt.credentials, got, tt.want)
+			}
+		})
+	}
+}
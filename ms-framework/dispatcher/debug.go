@@ -0,0 +1,107 @@
+package dispatcher
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher debug endpoints
+// ###########################################################################
+// ###########################################################################
+
+// DebugConfigurationFunc returns the configuration served by the debug
+// endpoint '/configuration'. It must not contain secrets.
+type DebugConfigurationFunc func() (interface{}, error)
+
+// ---------------------------------------------------------------------------
+
+// SetDebugConfiguration sets the function providing the configuration for the
+// debug endpoint '/configuration', which answers 404 as long as it is not set
+func (ds *Dispatcher) SetDebugConfiguration(fn DebugConfigurationFunc) {
+	ds.debugConfiguration = fn
+}
+
+// ---------------------------------------------------------------------------
+
+// httpGetDebugConfiguration serves the result of the DebugConfigurationFunc
+func (ds *Dispatcher) httpGetDebugConfiguration(w http.ResponseWriter, r *http.Request) {
+	if ds.debugConfiguration == nil {
+		ds.PageNotFound(w, r)
+		return
+	}
+	configuration, err := ds.debugConfiguration()
+	if err != nil {
+		ds.ReplyProblem(w, r, Internal(err))
+		return
+	}
+	ds.SetResponseHeaders("application/json; charset=utf-8", w, r)
+	w.WriteHeader(http.StatusOK)
+	ds.Reply(w, configuration)
+}
+
+// ---------------------------------------------------------------------------
+
+// debugHandler serves net/http/pprof, expvar and the configuration below the
+// configured debug path. pprof resolves profile names relative to '/debug/pprof/', so the
+// configured prefix is rewritten to that before the request is dispatched.
+func (ds *Dispatcher) debugHandler(prefix string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/configuration", ds.httpGetDebugConfiguration)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ds.logRequest(r, 0, 0, "Debug endpoint served.")
+		r2 := new(http.Request)
+		*r2 = *r
+		u := *r.URL
+		r2.URL = &u
+		r2.URL.Path = "/debug" + strings.TrimPrefix(r.URL.Path, prefix)
+		r2.URL.RawPath = ""
+		mux.ServeHTTP(w, r2)
+	})
+}
+
+// ---------------------------------------------------------------------------
+
+// mountDebug registers the debug endpoints if they are enabled. They are
+// only mounted if authentication wrappers are present, so profiling data is
+// never exposed anonymously.
+func (ds *Dispatcher) mountDebug() {
+
+	if !ds.GetDebug() {
+		return
+	}
+
+	if len(ds.authWrappers) == 0 {
+		ds.GetLogger().Println("Debug endpoints are enabled but no authentication is configured, not mounting them!")
+		return
+	}
+
+	prefix := "/" + strings.Trim(ds.GetDebugPath(), "/")
+
+	if ds.IsAdminEndpoint(AdminEndpointDebug) {
+		var handler http.Handler = ds.debugHandler(prefix)
+		for _, wrapper := range ds.authWrappers {
+			handler = wrapHandler(handler, wrapper)
+		}
+		ds.adminMuxer.Handle(prefix+"/", handler)
+		ds.GetLogger().Println(fmt.Sprintf("Serving debug endpoints on admin listener below '%s/'.", prefix))
+		return
+	}
+
+	if len(ds.GetNamespace()) > 0 {
+		prefix = fmt.Sprintf("/%s%s", ds.GetNamespace(), prefix)
+	}
+	ds.muxer.Handle(prefix+"/", ds.debugHandler(prefix))
+	ds.GetLogger().Println(fmt.Sprintf("Serving debug endpoints below '%s/'.", prefix))
+}
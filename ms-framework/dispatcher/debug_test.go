@@ -0,0 +1,55 @@
+package dispatcher
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDebugConfiguration(t *testing.T) {
+	var cfg Configuration
+	loader := config.NewLoader(flag.NewFlagSet("ds", flag.ContinueOnError), "MS_")
+	if err := loader.Add(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Defaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	ds := &Dispatcher{Registry: prometheus.NewRegistry()}
+	Init(ds, &cfg, nil, nil, log.New(&output, "", 0))
+	handler := ds.debugHandler("/admin/debug")
+
+	tests := []struct {
+		name   string
+		fn     DebugConfigurationFunc
+		status int
+		body   string
+	}{
+		{"unset", nil, http.StatusNotFound, ""},
+		{"set", func() (interface{}, error) { return map[string]string{"db": "*****"}, nil }, http.StatusOK, `"*****"`},
+		{"failed", func() (interface{}, error) { return nil, errors.New("password=hunter2") }, http.StatusInternalServerError, ""},
+	}
+
+	for _, tt := range tests {
+		ds.SetDebugConfiguration(tt.fn)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/debug/configuration", nil))
+
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d != %d", tt.name, w.Code, tt.status)
+		}
+		if !strings.Contains(w.Body.String(), tt.body) || strings.Contains(w.Body.String(), "hunter2") {
+			t.Errorf("%s: body '%s'", tt.name, w.Body.String())
+		}
+	}
+}
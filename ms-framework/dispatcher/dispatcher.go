@@ -1,23 +1,26 @@
 package dispatcher
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"net"
 	"net/http"
-	"os"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/recorder"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/secret"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"golang.org/x/net/netutil"
+	"google.golang.org/grpc"
 )
 
 var seededRand = rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -48,16 +51,54 @@ type Dispatcher struct {
 	tlsInfo        *TLSInfo
 	HTTPClient     *http.Client
 
-	wrappers []WrapperFunc
+	wrappers     []WrapperFunc
+	authWrappers []WrapperFunc
+	adminMuxer   *http.ServeMux
+	routes       map[string]*HandlerGroup
+
+	debugConfiguration DebugConfigurationFunc
+
+	grpcServices           []grpcService
+	grpcUnaryInterceptors  []grpc.UnaryServerInterceptor
+	grpcStreamInterceptors []grpc.StreamServerInterceptor
+
+	startFuncs    []StartFunc
+	shutdownFuncs []ShutdownFunc
+	shutdown      chan struct{}
+	shutdownOnce  sync.Once
+
+	configMutex               sync.RWMutex
+	configuredRequestHeaders  []*Header
+	configuredResponseHeaders []*Header
+	configuredCopyHeaders     []*HeaderOperation
+	logCloser                 io.Closer
 
 	RequestHeaders  []Header
 	ResponseHeaders []Header
 	CopyHeaders     []HeaderOperation
 
+	// Registry takes the metrics of the dispatcher if it is set before
+	// Init, otherwise they are registered with the default registry of
+	// prometheus. Dispatchers in the same process need their own registry.
+	Registry *prometheus.Registry
+
 	prometheusOps       prometheus.Counter
 	prometheusOpsFailed prometheus.Counter
 	prometheusOps404    prometheus.Counter
 	prometheusOps401    prometheus.Counter
+
+	prometheusCompressionRatio  *prometheus.HistogramVec
+	prometheusProblems          *prometheus.CounterVec
+	prometheusPanics            prometheus.Counter
+	prometheusEventStreams      prometheus.Gauge
+	prometheusEvents            prometheus.Counter
+	prometheusWebSockets        prometheus.Gauge
+	prometheusWebSocketMessages *prometheus.CounterVec
+	prometheusWebSocketBytes    *prometheus.CounterVec
+	prometheusGRPCCalls         *prometheus.CounterVec
+	prometheusGRPCStreams       prometheus.Gauge
+	prometheusProxyRequests     *prometheus.CounterVec
+	recording                   *recorder.Writer
 }
 
 // ---------------------------------------------------------------------------
@@ -88,21 +129,12 @@ func Init(
 	if logger == nil {
 		logFormat := fmt.Sprintf("[%-12.12s] ", "dispatcher")
 		logFlags := log.Ldate | log.Ltime | log.LUTC | log.Lmsgprefix
-		if len(configuration.GetLogfile()) == 0 {
-			logger = log.New(os.Stdout, logFormat, logFlags)
-		} else if configuration.GetLogfile() == "-" {
-			logger = log.New(os.Stdout, logFormat, logFlags)
-		} else if configuration.GetLogfile() == ":stdout" {
-			logger = log.New(os.Stdout, logFormat, logFlags)
-		} else if configuration.GetLogfile() == ":stderr" {
-			logger = log.New(os.Stderr, logFormat, logFlags)
-		} else {
-			file, err := os.OpenFile(configuration.GetLogfile(), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0640)
-			if err != nil {
-				log.Panic(fmt.Printf("Could not open logfile '%s', error was '%s'!", configuration.GetLogfile(), err.Error()))
-			}
-			logger = log.New(&logFlushWriter{Writer: file}, logFormat, logFlags)
+		writer, closer, err := openLogfile(configuration.GetLogfile())
+		if err != nil {
+			log.Panic(secret.Scrub(fmt.Sprintf("Could not open logfile '%s', error was '%s'!", configuration.GetLogfile(), err.Error())))
 		}
+		logger = log.New(writer, logFormat, logFlags)
+		ds.logCloser = closer
 	}
 
 	if muxer == nil {
@@ -111,53 +143,114 @@ func Init(
 
 	ds.muxer = muxer
 	ds.logger = logger
+
+	if ds.GetAdminPort() > 0 {
+		ds.adminMuxer = http.NewServeMux()
+	}
+
 	ds.maxPathLen = 10
+	ds.shutdown = make(chan struct{})
+	ds.routes = map[string]*HandlerGroup{}
 	ds.defaultHandler = defaultHandler
 
 	// ds.HeaderConfiguration = &configuration.HeaderConfiguration
-	for _, line := range configuration.RequestHeaderStrings {
-		h := HeaderFromString(line)
-		ds.AddRequestHeader(h)
-	}
+	ds.ApplyHeaderStrings()
 
-	for _, line := range configuration.ResponseHeaderStrings {
-		h := HeaderFromString(line)
-		ds.AddResponseHeader(h)
-	}
+	var registerer prometheus.Registerer = prometheus.DefaultRegisterer
+	metricsHandler := promhttp.Handler()
 
-	for _, line := range configuration.CopyHeaderStrings {
-		ds.AddCopyHeaderOperation(&HeaderOperation{Key: line, Op: HO_Copy})
+	if ds.Registry != nil {
+		registerer = ds.Registry
+		metricsHandler = promhttp.HandlerFor(ds.Registry, promhttp.HandlerOpts{})
 	}
 
-	ds.prometheusOps = promauto.NewCounter(prometheus.CounterOpts{
+	metrics := promauto.With(registerer)
+
+	ds.prometheusOps = metrics.NewCounter(prometheus.CounterOpts{
 		Name: "ops_total",
 		Help: "The total number of processed events",
 	})
 
-	ds.prometheusOpsFailed = promauto.NewCounter(prometheus.CounterOpts{
+	ds.prometheusOpsFailed = metrics.NewCounter(prometheus.CounterOpts{
 		Name: "ops_failed",
 		Help: "The total number of failed processed events",
 	})
 
-	ds.prometheusOps404 = promauto.NewCounter(prometheus.CounterOpts{
+	ds.prometheusOps404 = metrics.NewCounter(prometheus.CounterOpts{
 		Name: "ops_not_found",
 		Help: "The total number of not found events",
 	})
 
-	ds.prometheusOps401 = promauto.NewCounter(prometheus.CounterOpts{
+	ds.prometheusOps401 = metrics.NewCounter(prometheus.CounterOpts{
 		Name: "ops_not_authorized",
 		Help: "The total number of not authorized events",
 	})
 
+	ds.prometheusProblems = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "problems_total",
+		Help: "The total number of problem replies by status and type",
+	}, []string{"status", "type"})
+
+	ds.prometheusPanics = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "panics_total",
+		Help: "The total number of panics recovered in handlers",
+	})
+
+	ds.prometheusEventStreams = metrics.NewGauge(prometheus.GaugeOpts{
+		Name: "event_streams",
+		Help: "The number of open event streams",
+	})
+
+	ds.prometheusEvents = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "events_total",
+		Help: "The total number of events sent on event streams",
+	})
+
+	ds.prometheusWebSockets = metrics.NewGauge(prometheus.GaugeOpts{
+		Name: "websocket_connections",
+		Help: "The number of open WebSocket connections",
+	})
+
+	ds.prometheusWebSocketMessages = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_messages_total",
+		Help: "The total number of WebSocket messages by direction",
+	}, []string{"direction"})
+
+	ds.prometheusWebSocketBytes = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_bytes_total",
+		Help: "The total size of WebSocket messages by direction",
+	}, []string{"direction"})
+
+	ds.prometheusGRPCCalls = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_calls_total",
+		Help: "The total number of gRPC calls by method and code",
+	}, []string{"method", "code"})
+
+	ds.prometheusGRPCStreams = metrics.NewGauge(prometheus.GaugeOpts{
+		Name: "grpc_streams",
+		Help: "The number of open gRPC streaming calls",
+	})
+
+	ds.prometheusProxyRequests = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_requests_total",
+		Help: "The total number of forwarded requests by route and status",
+	}, []string{"route", "status"})
+
+	ds.prometheusCompressionRatio = metrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "compression_ratio",
+		Help:    "The size of compressed replies relative to their original size",
+		Buckets: prometheus.LinearBuckets(0.1, 0.1, 10),
+	}, []string{"encoding"})
+
 	prometheusLogFn := func(h http.Handler) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			ds.GetLogger().Printf("> %-6.6s | %3d | %6d | /metrics   | %s\n", r.Method, 0, 0, "Prometheus metrics served.")
+			ds.logRequest(r, 0, 0, "Prometheus metrics served.")
 			h.ServeHTTP(w, r)
 		}
 	}
 
 	if !ds.GetNoMetrics() {
-		ds.Handle("/metrics", prometheusLogFn(promhttp.Handler()))
+		ds.HandleAdmin("metrics", "/metrics", prometheusLogFn(metricsHandler))
 	}
 
 	// ds.Handle("/metrics", promhttp.Handler())
@@ -173,6 +266,8 @@ func Init(
 		ds.AddHandlerRaw("/", ds.defaultHandler, "")
 	}
 
+	ds.addConfiguredProxies()
+
 	if len(ds.GetCertChainFile()) > 0 && len(ds.GetKeyFile()) > 0 {
 
 		if ds.tlsInfo == nil {
@@ -245,9 +340,18 @@ func (ds *Dispatcher) GetBaseURL() string {
 	var url string
 
 	if ds.tlsInfo != nil && ds.tlsInfo.certificate != nil {
-		url = fmt.Sprintf("https://%s:%d", ds.GetHost(), ds.GetPort())
+		url = fmt.Sprintf("https://%s", net.JoinHostPort(ds.GetHost(), strconv.Itoa(ds.GetPort())))
 	} else {
-		url = fmt.Sprintf("http://%s:%d", ds.GetHost(), ds.GetPort())
+		url = fmt.Sprintf("http://%s", net.JoinHostPort(ds.GetHost(), strconv.Itoa(ds.GetPort())))
+	}
+
+	// With several listeners the first TCP one is used
+	addresses, _ := ds.listenAddresses()
+	for _, address := range addresses {
+		if address.network == "tcp" && !address.systemd {
+			url = address.String()
+			break
+		}
 	}
 
 	if len(ds.GetNamespace()) > 0 {
@@ -271,63 +375,97 @@ func (ds *Dispatcher) DefaultHandler() *HandlerGroup {
 
 // ---------------------------------------------------------------------------
 
-// Run is the main entry point for the dispatcher
-func (ds *Dispatcher) Run() {
+// Handler returns the handlers and wrappers of the dispatcher as Run serves
+// them, without binding a port. gRPC, the debug endpoints and the admin
+// listener are only set up by Run, requests are only recorded while Run
+// runs. Wrappers added later are not applied to the returned handler.
+func (ds *Dispatcher) Handler() http.Handler {
 
-	addAccessControlAllowOriginFn := func(h http.Handler) http.HandlerFunc {
+	delayReplyFn := func(h http.Handler) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Add("Access-Control-Allow-Origin", "*")
+			var delay int
+			ds.ViewConfiguration(func() { delay = ds.GetDelayReply() })
+			if delay > 0 {
+				time.Sleep(time.Duration(delay) * time.Millisecond)
+			}
 			h.ServeHTTP(w, r)
 		}
 	}
 
-	delayReplyFn := func(h http.Handler) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
-			time.Sleep(time.Duration(ds.GetDelayReply()) * time.Millisecond)
-			h.ServeHTTP(w, r)
-		}
+	var wrappedHandler http.HandlerFunc = ds.muxer.ServeHTTP
+
+	for _, wrapper := range ds.wrappers {
+		wrappedHandler = wrapHandler(wrappedHandler, wrapper)
 	}
 
-	addWrapper := func(h http.Handler, wrapper WrapperFunc) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
-			success := wrapper(w, r)
+	wrappedHandler = ds.recordHandler(wrappedHandler)
+	wrappedHandler = ds.compressionHandler(wrappedHandler)
+	wrappedHandler = ds.corsHandler(wrappedHandler)
+	wrappedHandler = ds.correlationHandler(wrappedHandler)
 
-			if !success {
-				return
-			}
+	// The delay may be changed by a configuration reload
+	return delayReplyFn(wrappedHandler)
+}
 
-			h.ServeHTTP(w, r)
-		}
+// ---------------------------------------------------------------------------
+
+// AdminHandler returns the handler of the admin listener, nil if there is
+// no admin port
+func (ds *Dispatcher) AdminHandler() http.Handler {
+	if ds.adminMuxer == nil {
+		return nil
 	}
+	return ds.adminMuxer
+}
+
+// ---------------------------------------------------------------------------
+
+// Run is the main entry point for the dispatcher
+func (ds *Dispatcher) Run() {
 
 	var err error
-	var listener net.Listener
+	var listeners []net.Listener
 	var wrappedHandler http.HandlerFunc
 
 	ds.GetLogger().Println(fmt.Sprintf("This is '%s' in module '%s' for project '%s' of customer '%s' built at '%s' from '%s' at version '%s (%s)'.", _build_component, _build_module, _build_project, _build_customer, _build_stamp, _build_commit, ds.GetVersion(), _build_version))
 
-	if ds.tlsInfo != nil && ds.tlsInfo.certificate != nil {
-		listener, err = tls.Listen("tcp", fmt.Sprintf("%s:%d", ds.GetHost(), ds.GetPort()), ds.tlsInfo.tlsConfig)
-	} else {
-		listener, err = net.Listen("tcp", fmt.Sprintf("%s:%d", ds.GetHost(), ds.GetPort()))
-	}
+	addresses, err := ds.listenAddresses()
 	if err != nil {
 		ds.GetLogger().Fatal(err)
 		return
 	}
 
-	if ds.GetMaxConnections() > 0 {
-		listener = netutil.LimitListener(listener, ds.GetMaxConnections())
-	}
+	ds.mountDebug()
 
-	wrappedHandler = addAccessControlAllowOriginFn(ds.muxer)
+	var adminServer *http.Server
+	var adminListener net.Listener
 
-	for _, wrapper := range ds.wrappers {
-		wrappedHandler = addWrapper(wrappedHandler, wrapper)
+	if ds.adminMuxer != nil {
+		adminServer, adminListener, err = ds.listenAdmin()
+		if err != nil {
+			ds.GetLogger().Fatal(err)
+			return
+		}
 	}
 
-	if ds.GetDelayReply() > 0 {
-		wrappedHandler = delayReplyFn(wrappedHandler)
+	if err = ds.openRecording(); err != nil {
+		ds.GetLogger().Fatal(err)
+		return
+	}
+
+	wrappedHandler = ds.Handler().ServeHTTP
+
+	var grpcServer *grpc.Server
+
+	if ds.GetGRPC() {
+		grpcServer, err = ds.newGRPCServer()
+		if err != nil {
+			ds.GetLogger().Fatal(err)
+			return
+		}
+		if ds.GetGRPCPort() == 0 {
+			wrappedHandler = grpcHandler(grpcServer, wrappedHandler)
+		}
 	}
 
 	if ds.GetMaxConnections() > 0 {
@@ -342,26 +480,84 @@ func (ds *Dispatcher) Run() {
 		ds.GetLogger().Println(fmt.Sprintf("Delaying replies by %dms..", ds.GetDelayReply()))
 	}
 
-	if ds.tlsInfo != nil && ds.tlsInfo.certificate != nil {
-		ds.GetLogger().Println(fmt.Sprintf("Starting listener on 'https://%s:%d'", ds.GetHost(), ds.GetPort()))
-	} else {
-		ds.GetLogger().Println(fmt.Sprintf("Starting listener on 'http://%s:%d'", ds.GetHost(), ds.GetPort()))
+	server, err := ds.newServer(wrappedHandler)
+	if err != nil {
+		ds.GetLogger().Fatal(err)
+		return
+	}
+
+	for _, address := range addresses {
+		l, err := ds.listen(address, server.TLSConfig)
+		if err != nil {
+			ds.GetLogger().Fatal(err)
+			return
+		}
+		listeners = append(listeners, l...)
+		ds.GetLogger().Println(fmt.Sprintf("Starting listener on '%s' (%s)", address, ds.protocols(address.tls)))
+	}
+
+	var grpcListener net.Listener
+
+	if grpcServer != nil && ds.GetGRPCPort() > 0 {
+		var address *listenAddress
+		grpcListener, address, err = ds.listenGRPC()
+		if err != nil {
+			ds.GetLogger().Fatal(err)
+			return
+		}
+		ds.GetLogger().Println(fmt.Sprintf("Starting gRPC listener on '%s' for %v", address, ds.GetGRPCServices()))
+	} else if grpcServer != nil {
+		ds.GetLogger().Println(fmt.Sprintf("Serving gRPC on the listeners for %v", ds.GetGRPCServices()))
 	}
 
 	// if ds.GetMaxTcpConnections() > 0 {
-	// 	var l LimitedTcpListener
+	// 	var l *LimitedTcpListener
 	// 	l = InitLimitedTcpListener(ds.GetMaxTcpConnections(), listener)
 	// 	err = http.Serve(l, wrappedHandler)
 	// } else {
-	err = http.Serve(listener, wrappedHandler)
+	errs := make(chan error, len(listeners)+2)
+	for _, listener := range listeners {
+		go func(listener net.Listener) { errs <- server.Serve(listener) }(listener)
+	}
+	if grpcListener != nil {
+		go func() { errs <- grpcServer.Serve(grpcListener) }()
+	}
+	if adminListener != nil {
+		go func() { errs <- adminServer.Serve(adminListener) }()
+	}
 	// }
-	ds.GetLogger().Fatal(err)
+
+	for _, fn := range ds.startFuncs {
+		fn()
+	}
+
+	if err = ds.waitForShutdown(errs); err != nil {
+		ds.GetLogger().Fatal(err)
+		return
+	}
+
+	ds.stop(server, grpcServer, adminServer)
+	ds.closeRecording()
+	ds.GetLogger().Println("Shutdown complete.")
 }
 
 // ---------------------------------------------------------------------------
 
 // AddHandlerRaw adds a HTTP handler to the current dispatcher
 func (ds *Dispatcher) AddHandlerRaw(path string, handlers *HandlerGroup, namespace string) {
+	ds.fillHandlerGroup(handlers)
+
+	if len(namespace) > 0 {
+		path = fmt.Sprintf("/%s%s", namespace, path)
+	}
+
+	ds.registerHandler(ds.muxer, path, handlers)
+}
+
+func (ds *Dispatcher) fillHandlerGroup(handlers *HandlerGroup) {
+	if handlers.methods == nil {
+		handlers.methods = handlers.handledMethods()
+	}
 	if handlers.Any == nil {
 		handlers.Any = ds.PageNotFound
 	}
@@ -386,17 +582,25 @@ func (ds *Dispatcher) AddHandlerRaw(path string, handlers *HandlerGroup, namespa
 	if handlers.Options == nil {
 		handlers.Options = ds.PageNotFound
 	}
+}
 
-	if len(namespace) > 0 {
-		path = fmt.Sprintf("/%s%s", namespace, path)
+func (ds *Dispatcher) registerHandler(muxer *http.ServeMux, path string, handlers *HandlerGroup) {
+	ds.fitPathLen(path)
+
+	if muxer == ds.muxer {
+		ds.routes[path] = handlers
 	}
+
+	muxer.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) { ds.handler(handlers, w, r) })
+}
+
+// fitPathLen widens the path column of the log to path
+func (ds *Dispatcher) fitPathLen(path string) {
 	l := len(path)
 
 	if ds.maxPathLen < l {
 		ds.maxPathLen = l
 	}
-
-	ds.muxer.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) { ds.handler(handlers, w, r) })
 }
 
 // AddHandler adds a HTTP handler to the current dispatcher
@@ -416,12 +620,19 @@ func (ds *Dispatcher) Handle(path string, handler http.Handler) {
 
 // ---------------------------------------------------------------------------
 
-// Reply writes a reply to a request
+// Reply writes a reply to a request. The format is negotiated from the
+// Accept header of the request, see Encoding.
 func (ds *Dispatcher) Reply(w http.ResponseWriter, msg interface{}) int {
-	msgBytes, err := json.MarshalIndent(msg, "", "  ")
+	r := requestOf(w)
+	encoding := negotiateEncoding(r, msg)
+
+	msgBytes, err := encode(encoding, msg, prettyJSON(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return 0
+		_, contentLen, _ := ds.ReplyProblem(w, r, Internal(err))
+		return contentLen
+	}
+	if encoding != EncodingJSON || len(w.Header().Get("Content-Type")) == 0 {
+		w.Header().Set("Content-Type", string(encoding))
 	}
 	w.Write(msgBytes)
 	return len(msgBytes)
@@ -429,12 +640,12 @@ func (ds *Dispatcher) Reply(w http.ResponseWriter, msg interface{}) int {
 
 // ---------------------------------------------------------------------------
 
-// ReplyData writes a reply with additional data
+// ReplyData writes a reply with additional data. The reply is always JSON.
 func (ds *Dispatcher) ReplyData(w http.ResponseWriter, msg interface{}, payload []byte) int {
-	msgBytes, err := json.MarshalIndent(msg, "", "  ")
+	msgBytes, err := encode(EncodingJSON, msg, prettyJSON(requestOf(w)))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return 0
+		_, contentLen, _ := ds.ReplyProblem(w, requestOf(w), Internal(err))
+		return contentLen
 	}
 	w.Write(msgBytes)
 	if len(payload) > 0 {
@@ -446,8 +657,30 @@ func (ds *Dispatcher) ReplyData(w http.ResponseWriter, msg interface{}, payload
 // ---------------------------------------------------------------------------
 
 func (ds *Dispatcher) handler(handlers *HandlerGroup, w http.ResponseWriter, r *http.Request) (status int, contentLen int, msg string) {
+	rw := newResponseWriter(w, r)
+	defer rw.writeHeader()
+	w = rw
+
+	defer func() {
+		if p := recover(); p != nil {
+			status, contentLen, msg = ds.recoverPanic(rw, r, p)
+		}
+	}()
 
 	ds.prometheusOps.Inc()
+
+	var cancel context.CancelFunc
+	var err error
+
+	r, cancel, err = ds.limitRequest(handlers, w, r)
+	defer cancel()
+
+	if err != nil {
+		status, contentLen, msg = ds.ReplyProblem(w, r, err)
+		ds.logRequest(r, status, contentLen, msg)
+		return status, contentLen, msg
+	}
+
 	fps := r.Header.Get("X-FailurePercent")
 
 	if len(fps) > 0 {
@@ -463,10 +696,9 @@ func (ds *Dispatcher) handler(handlers *HandlerGroup, w http.ResponseWriter, r *
 			}
 
 			ds.prometheusOpsFailed.Inc()
-			msg = fmt.Sprintf("Forcing error %d.", fci)
-			ds.GetLogger().Printf("> %-6.6s | %3d | %6d | %-*.*s | %s\n", r.Method, fci, len(msg), ds.maxPathLen, ds.maxPathLen, r.URL.Path, msg)
-			http.Error(w, msg, fci)
-			return fci, 0, ""
+			status, contentLen, msg = ds.ReplyProblem(w, r, NewProblem(fci, fmt.Sprintf("Forcing error %d.", fci)))
+			ds.logRequest(r, status, contentLen, msg)
+			return status, contentLen, msg
 		}
 	}
 
@@ -489,33 +721,30 @@ func (ds *Dispatcher) handler(handlers *HandlerGroup, w http.ResponseWriter, r *
 		status, contentLen, msg = handlers.Any(w, r)
 	}
 
-	ds.GetLogger().Printf("> %-6.6s | %3d | %6d | %-*.*s | %s\n", r.Method, status, contentLen, ds.maxPathLen, ds.maxPathLen, r.URL.Path, msg)
+	// Handlers returning after the timeout without a reply get a 504
+	if timedOut(r) && !rw.written {
+		rw.status = 0
+		status, contentLen, _ = ds.ReplyProblem(w, r, NewProblem(http.StatusGatewayTimeout, "The request was not handled in time.").WithCause(r.Context().Err()))
+		msg = "Request timed out"
+	}
+
+	ds.logRequest(r, status, contentLen, msg)
 	return status, contentLen, msg
 }
 
 // ---------------------------------------------------------------------------
 
 func (ds *Dispatcher) PageNotFound(w http.ResponseWriter, r *http.Request) (status int, contentLen int, msg string) {
-	var response Response
 	ds.prometheusOps404.Inc()
-	status = http.StatusNotFound
-	InitResponseFromDispatcher(&response, ds, status, fmt.Sprintf("%d - Error: PageNotFound", status))
-	ds.SetResponseHeaders("application/json; charset=utf-8", w, r)
-	w.WriteHeader(status)
-	contentLen = ds.Reply(w, response)
+	status, contentLen, _ = ds.ReplyProblem(w, r, NotFound("No handler is registered for '%s %s'.", r.Method, r.URL.Path))
 	return status, contentLen, "Path not registered"
 }
 
 // ---------------------------------------------------------------------------
 
 func (ds *Dispatcher) PageNotAuthorized(w http.ResponseWriter, r *http.Request) (status int, contentLen int, msg string) {
-	var response Response
 	ds.prometheusOps401.Inc()
-	status = http.StatusUnauthorized
-	InitResponseFromDispatcher(&response, ds, status, fmt.Sprintf("%d - Error: PageNotAuthorized", status))
-	ds.SetResponseHeaders("application/json; charset=utf-8", w, r)
-	w.WriteHeader(status)
-	contentLen = ds.Reply(w, response)
+	status, contentLen, _ = ds.ReplyProblem(w, r, Unauthorized("Valid credentials are required."))
 	return status, contentLen, "Not authorized"
 }
 
@@ -525,10 +754,9 @@ func (ds *Dispatcher) defaultOptions(w http.ResponseWriter, r *http.Request) (st
 	var response Response
 	status = http.StatusOK
 	InitResponseFromDispatcher(&response, ds, status, fmt.Sprintf("%d - Ok - Sent default options", status))
+	InitResponseFromRequest(&response, r)
 	ds.SetResponseHeaders("application/json; charset=utf-8", w, r)
-	w.Header().Add("Access-Control-Allow-Methods", "*")
-	w.Header().Add("Access-Control-Allow-Headers", "Content-Type")
-	w.Header().Add("Access-Control-Allow-Headers", "X-Cid, X-Chost, X-Version, X-Namespace, X-Environment, x-session-id, x-correlation-id, x-sequence-nr, x-request-id, x-b3-traceid, x-b3-spanid, x-b3-parentspanid, x-b3-sampled, x-b3-flags, b3, x-ot-span-context")
+	ds.ViewConfiguration(func() { ds.setCORSPreflightHeaders(w, ds.routeMethods(r)) })
 	w.WriteHeader(status)
 	contentLen = ds.Reply(w, response)
 	return status, contentLen, "Sent default options."
@@ -539,3 +767,26 @@ func (ds *Dispatcher) defaultOptions(w http.ResponseWriter, r *http.Request) (st
 func (ds *Dispatcher) AddWrapper(wrapper WrapperFunc) {
 	ds.wrappers = append(ds.wrappers, wrapper)
 }
+
+// ---------------------------------------------------------------------------
+
+// AddAuthWrapper adds a wrapper that authenticates requests. It is applied
+// like any other wrapper and additionally protects the debug endpoints.
+func (ds *Dispatcher) AddAuthWrapper(wrapper WrapperFunc) {
+	ds.wrappers = append(ds.wrappers, wrapper)
+	ds.authWrappers = append(ds.authWrappers, wrapper)
+}
+
+// ---------------------------------------------------------------------------
+
+func wrapHandler(h http.Handler, wrapper WrapperFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		success := wrapper(w, r)
+
+		if !success {
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
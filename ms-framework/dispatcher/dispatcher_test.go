@@ -0,0 +1,236 @@
+package dispatcher_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher/dispatchertest"
+)
+
+// hello replies with a Response
+func hello(s *dispatchertest.Server) dispatcher.HTTPHandler {
+	return func(w http.ResponseWriter, r *http.Request) (int, int, string) {
+		var response dispatcher.Response
+		dispatcher.InitResponseFromDispatcher(&response, s.Dispatcher, http.StatusOK, "OK")
+		s.Dispatcher.SetResponseHeaders("application/json; charset=utf-8", w, r)
+		return http.StatusOK, s.Dispatcher.Reply(w, &response), "Said hello."
+	}
+}
+
+// newServer serves hello on /hello
+func newServer(t *testing.T, cfg *dispatcher.Configuration) *dispatchertest.Server {
+	s := dispatchertest.New(t, cfg, nil)
+	s.Dispatcher.AddHandler("/hello", &dispatcher.HandlerGroup{Get: hello(s)})
+	return s
+}
+
+// ###########################################################################
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		credentials bool
+		origin      string
+		allow       string
+	}{
+		{"wildcard", nil, false, "https://evil.example", "*"},
+		{"wildcard without origin", nil, false, "", "*"},
+		{"wildcard with credentials", nil, true, "https://evil.example", ""},
+		{"listed with credentials", []string{"*", "https://app.example"}, true, "https://app.example", "https://app.example"},
+		{"not listed", []string{"https://app.example"}, false, "https://evil.example", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := dispatcher.Configuration{}
+			cfg.CORSOrigins = tt.origins
+			cfg.CORSCredentials = tt.credentials
+			s := newServer(t, &cfg)
+
+			var header []string
+			if len(tt.origin) > 0 {
+				header = []string{"Origin", tt.origin}
+			}
+			result := s.Get("/hello", header...).AssertStatus(http.StatusOK)
+			preflight := s.Do(s.NewRequest(http.MethodOptions, "/hello", nil, append(header, "Access-Control-Request-Method", "GET")...))
+
+			if len(tt.allow) == 0 {
+				result.AssertNoHeader("Access-Control-Allow-Origin").AssertNoHeader("Access-Control-Allow-Credentials")
+				if len(tt.origin) > 0 {
+					preflight.AssertStatus(http.StatusForbidden)
+				}
+				return
+			}
+
+			result.AssertHeader("Access-Control-Allow-Origin", tt.allow)
+			if tt.credentials {
+				result.AssertHeader("Access-Control-Allow-Credentials", "true")
+			} else {
+				result.AssertNoHeader("Access-Control-Allow-Credentials")
+			}
+			if len(tt.origin) > 0 {
+				preflight.AssertStatus(http.StatusNoContent).AssertHeader("Access-Control-Allow-Methods", "GET")
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestHeaderRules(t *testing.T) {
+	cfg := dispatcher.Configuration{}
+	cfg.Name = "svc"
+	cfg.Namespace = "gw"
+	cfg.ResponseHeaderStrings = []string{
+		"X-Route: {{name}} {{method}} {{path}}",
+		"X-Echo: {{header.X-In}}/{{query.q}}",
+		"X-Unknown: {{bogus}}",
+		"[method=POST] X-Post: yes",
+		"[path=/hello] X-Hello: yes",
+		"[path=/other/*] X-Other: yes",
+		"X-Id?: {{uuid}}",
+		"X-Rename: a",
+		"X-Rename>X-Renamed",
+		"-X-Echo",
+	}
+	cfg.CopyHeaderStrings = []string{"X-Copy"}
+	s := newServer(t, &cfg)
+
+	s.Get("/gw/hello?q=1", "X-In", "in", "X-Copy", "copied").
+		AssertStatus(http.StatusOK).
+		AssertHeader("X-Route", "svc GET /gw/hello").
+		AssertHeader("X-Unknown", "{{bogus}}").
+		AssertHeader("X-Hello", "yes").
+		AssertHeader("X-Renamed", "a").
+		AssertHeader("X-Copy", "copied").
+		AssertHeader("X-Namespace", "gw").
+		AssertNoHeader("X-Echo").
+		AssertNoHeader("X-Post").
+		AssertNoHeader("X-Other").
+		AssertNoHeader("X-Rename")
+
+	result := s.Get("/gw/hello")
+	if id := result.Header.Get("X-Id"); len(id) != 36 {
+		t.Errorf("X-Id: '%s' is no UUID", id)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestReplyEncoding(t *testing.T) {
+	tests := []struct {
+		target      string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"/hello", "", "application/json", "\n  \""},
+		{"/hello?pretty=false", "", "application/json", "{\""},
+		{"/hello", "application/yaml", "application/yaml", "status: OK"},
+		{"/hello", "text/html, application/x-msgpack;q=0.8", "application/msgpack", "OK"},
+		{"/hello", "application/x-protobuf", "application/json", "\"OK\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target+" "+tt.accept, func(t *testing.T) {
+			s := newServer(t, &dispatcher.Configuration{})
+
+			var header []string
+			if len(tt.accept) > 0 {
+				header = []string{"Accept", tt.accept}
+			}
+			s.Get(tt.target, header...).
+				AssertStatus(http.StatusOK).
+				AssertHeader("Content-Type", tt.contentType).
+				AssertBody(tt.body)
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// data replies with size bytes of the content type given by the query, or
+// with the request body
+func data(w http.ResponseWriter, r *http.Request) (int, int, string) {
+	body := []byte(strings.Repeat("x", atoi(r.URL.Query().Get("size"))))
+	if r.Method == http.MethodPost {
+		body, _ = ioutil.ReadAll(r.Body)
+	}
+	w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+	w.Write(body)
+	return http.StatusOK, len(body), "Sent data."
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func TestCompression(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression []string
+		size        int
+		contentType string
+		accept      string
+		encoding    string
+	}{
+		{"compressed", nil, 2048, "application/json", "gzip, br", "gzip"},
+		{"preferred", nil, 2048, "text/plain", "gzip;q=0.5, zstd", "zstd"},
+		{"too small", nil, 100, "application/json", "gzip", ""},
+		{"type not allowed", nil, 2048, "image/png", "gzip", ""},
+		{"not accepted", nil, 2048, "application/json", "", ""},
+		{"disabled", []string{"none"}, 2048, "application/json", "gzip", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := dispatcher.Configuration{}
+			cfg.Compression = tt.compression
+			s := newServer(t, &cfg)
+			s.Dispatcher.AddHandler("/data", &dispatcher.HandlerGroup{Get: data, Post: data})
+
+			var header []string
+			if len(tt.accept) > 0 {
+				header = []string{"Accept-Encoding", tt.accept}
+			}
+			result := s.Get("/data?size="+strconv.Itoa(tt.size)+"&type="+tt.contentType, header...).AssertStatus(http.StatusOK)
+
+			if len(tt.encoding) == 0 {
+				result.AssertNoHeader("Content-Encoding")
+				if len(result.Body) != tt.size {
+					t.Errorf("body: %d bytes", len(result.Body))
+				}
+				return
+			}
+
+			result.AssertHeader("Content-Encoding", tt.encoding).AssertHeader("Vary", "Accept-Encoding")
+			if len(result.Body) >= tt.size {
+				t.Errorf("body: %d bytes are not compressed", len(result.Body))
+			}
+		})
+	}
+
+	t.Run("request body", func(t *testing.T) {
+		s := newServer(t, &dispatcher.Configuration{})
+		s.Dispatcher.AddHandler("/data", &dispatcher.HandlerGroup{Get: data, Post: data})
+
+		var body bytes.Buffer
+		writer := gzip.NewWriter(&body)
+		writer.Write([]byte("compressed request"))
+		writer.Close()
+
+		r := s.NewRequest(http.MethodPost, "/data?type=text/plain", &body, "Content-Encoding", "gzip")
+		s.Do(r).AssertStatus(http.StatusOK).AssertBody("compressed request")
+
+		r = s.NewRequest(http.MethodPost, "/data?type=text/plain", strings.NewReader("x"), "Content-Encoding", "deflate")
+		s.Do(r).AssertStatus(http.StatusUnsupportedMediaType)
+	})
+}
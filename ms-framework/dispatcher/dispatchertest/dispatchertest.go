@@ -0,0 +1,356 @@
+package dispatchertest
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/config"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/secret"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher test harness
+// ###########################################################################
+// ###########################################################################
+
+// A Server runs a Dispatcher inside a test, without a port, signals or the
+// command line:
+//
+//	cfg := dispatcher.Configuration{}
+//	cfg.Namespace = "gw"
+//	s := dispatchertest.New(t, &cfg, nil)
+//	s.Dispatcher.AddHandler("/hello", &dispatcher.HandlerGroup{Get: hello})
+//
+//	s.Get("/gw/hello").AssertStatus(http.StatusOK).AssertHeader("Content-Type", "application/json")
+//	s.AssertMetric("ops_total", 1)
+//	s.AssertLog("/gw/hello")
+//
+// Requests are served directly through ServeHTTP by Do, Get and Post, or
+// through a httptest.Server by Send, which streams, compresses and upgrades
+// like a real listener. Each Server has its own metrics registry and log,
+// so tests may run in parallel.
+//
+// Handlers and wrappers are registered before the first request. gRPC, the
+// debug endpoints, recording and the OnStart and OnShutdown functions are
+// only run by Dispatcher.Run.
+
+// Server serves a Dispatcher in process
+type Server struct {
+	Dispatcher *dispatcher.Dispatcher
+	Registry   *prometheus.Registry
+	Log        *Log
+
+	t            testing.TB
+	handlerOnce  sync.Once
+	handler      http.Handler
+	serverMutex  sync.Mutex
+	server       *httptest.Server
+	adminServer  *httptest.Server
+	closeServers sync.Once
+}
+
+// ###########################################################################
+
+// Configure fills the fields of cfg which are not set from their defaults,
+// without reading the command line, the environment or a configuration
+// file. The test fails if cfg is invalid.
+func Configure(t testing.TB, cfg *dispatcher.Configuration) {
+	t.Helper()
+
+	loader := config.NewLoader(flag.NewFlagSet("ds", flag.ContinueOnError), "MS_")
+	if err := loader.Add(cfg); err != nil {
+		t.Fatalf("configuration: %s", err.Error())
+	}
+	if err := loader.Defaults(); err != nil {
+		t.Fatalf("configuration: %s", err.Error())
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// New initializes a Dispatcher from cfg, completed by Configure, with its
+// own metrics registry and a logger writing to Log. The servers are closed
+// when the test ends.
+func New(t testing.TB, cfg *dispatcher.Configuration, defaultHandler *dispatcher.HandlerGroup) *Server {
+	t.Helper()
+
+	Configure(t, cfg)
+
+	output := &Log{}
+	logger := log.New(secret.NewWriter(output), fmt.Sprintf("[%-12.12s] ", "dispatcher"), log.Ldate|log.Ltime|log.LUTC|log.Lmsgprefix)
+
+	ds := &dispatcher.Dispatcher{Registry: prometheus.NewRegistry()}
+	dispatcher.Init(ds, cfg, defaultHandler, nil, logger)
+
+	return Wrap(t, ds, output)
+}
+
+// ---------------------------------------------------------------------------
+
+// Wrap serves a Dispatcher which is already initialized, like the one of a
+// MicroService. Its Registry must be set before Init, output should be the
+// output of its logger.
+func Wrap(t testing.TB, ds *dispatcher.Dispatcher, output *Log) *Server {
+	t.Helper()
+
+	if ds.Registry == nil {
+		t.Fatal("the dispatcher has no registry of its own")
+	}
+	if output == nil {
+		output = &Log{}
+	}
+
+	s := &Server{Dispatcher: ds, Registry: ds.Registry, Log: output, t: t}
+
+	t.Cleanup(func() {
+		s.Close()
+		if t.Failed() && len(s.Log.String()) > 0 {
+			t.Logf("log of the dispatcher:\n%s", s.Log.String())
+		}
+	})
+
+	return s
+}
+
+// ---------------------------------------------------------------------------
+
+// Close closes the servers started by URL and AdminURL
+func (s *Server) Close() {
+	s.closeServers.Do(func() {
+		s.serverMutex.Lock()
+		defer s.serverMutex.Unlock()
+		if s.server != nil {
+			s.server.Close()
+		}
+		if s.adminServer != nil {
+			s.adminServer.Close()
+		}
+	})
+}
+
+// ###########################################################################
+
+// Handler returns the handler of the dispatcher, see Dispatcher.Handler. It
+// is built on the first call.
+func (s *Server) Handler() http.Handler {
+	s.handlerOnce.Do(func() { s.handler = s.Dispatcher.Handler() })
+	return s.handler
+}
+
+// ---------------------------------------------------------------------------
+
+// ServeHTTP serves r like the listeners of the dispatcher
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Handler().ServeHTTP(w, r)
+}
+
+// ---------------------------------------------------------------------------
+
+// URL starts a httptest.Server for the dispatcher on the first call and
+// returns its URL
+func (s *Server) URL() string {
+	s.serverMutex.Lock()
+	defer s.serverMutex.Unlock()
+
+	if s.server == nil {
+		s.server = httptest.NewServer(s)
+	}
+	return s.server.URL
+}
+
+// ---------------------------------------------------------------------------
+
+// AdminURL starts a httptest.Server for the admin listener on the first
+// call and returns its URL. The test fails if no admin port is configured.
+func (s *Server) AdminURL() string {
+	s.t.Helper()
+
+	admin := s.Dispatcher.AdminHandler()
+	if admin == nil {
+		s.t.Fatal("the dispatcher has no admin port")
+	}
+
+	s.serverMutex.Lock()
+	defer s.serverMutex.Unlock()
+
+	if s.adminServer == nil {
+		s.adminServer = httptest.NewServer(admin)
+	}
+	return s.adminServer.URL
+}
+
+// ###########################################################################
+
+// Do serves r through ServeHTTP
+func (s *Server) Do(r *http.Request) *Result {
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, r)
+	return newResult(s.t, recorder.Result())
+}
+
+// ---------------------------------------------------------------------------
+
+// Get serves a GET of path through ServeHTTP. header are pairs of header
+// names and values.
+func (s *Server) Get(path string, header ...string) *Result {
+	s.t.Helper()
+	return s.Do(s.NewRequest(http.MethodGet, path, nil, header...))
+}
+
+// ---------------------------------------------------------------------------
+
+// Post serves a POST of body to path through ServeHTTP. header are pairs of
+// header names and values.
+func (s *Server) Post(path string, contentType string, body string, header ...string) *Result {
+	s.t.Helper()
+	r := s.NewRequest(http.MethodPost, path, strings.NewReader(body), header...)
+	r.Header.Set("Content-Type", contentType)
+	return s.Do(r)
+}
+
+// ---------------------------------------------------------------------------
+
+// Send sends r to the httptest.Server of the dispatcher. The scheme and
+// host of r are replaced by the ones of the server.
+func (s *Server) Send(r *http.Request) *Result {
+	s.t.Helper()
+
+	target := s.URL()
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Host = ""
+	out.URL.Scheme = "http"
+	out.URL.Host = strings.TrimPrefix(target, "http://")
+
+	response, err := s.Client().Do(out)
+	if err != nil {
+		s.t.Fatalf("%s %s: %s", r.Method, r.URL.Path, err.Error())
+	}
+	return newResult(s.t, response)
+}
+
+// ---------------------------------------------------------------------------
+
+// Client returns a client for the httptest.Server of the dispatcher
+func (s *Server) Client() *http.Client {
+	s.URL()
+	return s.server.Client()
+}
+
+// ---------------------------------------------------------------------------
+
+// NewRequest creates a request to path. header are pairs of header names
+// and values.
+func (s *Server) NewRequest(method string, path string, body io.Reader, header ...string) *http.Request {
+	s.t.Helper()
+
+	if len(header)%2 != 0 {
+		s.t.Fatalf("header '%s' has no value", header[len(header)-1])
+	}
+
+	r := httptest.NewRequest(method, path, body)
+	for i := 0; i < len(header); i += 2 {
+		r.Header.Add(header[i], header[i+1])
+	}
+	return r
+}
+
+// ###########################################################################
+
+// Metric returns the sum of the series of the metric name which have the
+// given labels, pairs of label names and values. Histograms and summaries
+// count their observations.
+func (s *Server) Metric(name string, labels ...string) float64 {
+	s.t.Helper()
+
+	if len(labels)%2 != 0 {
+		s.t.Fatalf("label '%s' has no value", labels[len(labels)-1])
+	}
+
+	families, err := s.Registry.Gather()
+	if err != nil {
+		s.t.Fatalf("gathering metrics: %s", err.Error())
+	}
+
+	var sum float64
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if hasLabels(metric, labels) {
+				sum += metricValue(metric)
+			}
+		}
+	}
+	return sum
+}
+
+// ---------------------------------------------------------------------------
+
+// AssertMetric checks the value of a metric, see Metric
+func (s *Server) AssertMetric(name string, value float64, labels ...string) {
+	s.t.Helper()
+
+	if actual := s.Metric(name, labels...); actual != value {
+		s.t.Errorf("metric %s%v: %g != %g", name, labels, actual, value)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// AssertLog checks that the log contains text
+func (s *Server) AssertLog(text string) {
+	s.t.Helper()
+
+	if !s.Log.Contains(text) {
+		s.t.Errorf("log does not contain '%s'", text)
+	}
+}
+
+// ###########################################################################
+
+// hasLabels reports if metric has all labels
+func hasLabels(metric *dto.Metric, labels []string) bool {
+	for i := 0; i < len(labels); i += 2 {
+		found := false
+		for _, pair := range metric.GetLabel() {
+			if pair.GetName() == labels[i] && pair.GetValue() == labels[i+1] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ---------------------------------------------------------------------------
+
+// metricValue returns the value of a series
+func metricValue(metric *dto.Metric) float64 {
+	switch {
+	case metric.Counter != nil:
+		return metric.GetCounter().GetValue()
+	case metric.Gauge != nil:
+		return metric.GetGauge().GetValue()
+	case metric.Histogram != nil:
+		return float64(metric.GetHistogram().GetSampleCount())
+	case metric.Summary != nil:
+		return float64(metric.GetSummary().GetSampleCount())
+	}
+	return metric.GetUntyped().GetValue()
+}
@@ -0,0 +1,196 @@
+package dispatchertest_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher/dispatchertest"
+)
+
+// recorder keeps the failures of assertions instead of failing the test
+type recorder struct {
+	testing.TB
+	mutex  sync.Mutex
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) failures() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	failures := r.errors
+	r.errors = nil
+	return failures
+}
+
+// newServer serves /echo, which replies with the request body and header,
+// and /fail, which replies with a problem
+func newServer(t testing.TB, cfg *dispatcher.Configuration) *dispatchertest.Server {
+	s := dispatchertest.New(t, cfg, nil)
+
+	echo := func(w http.ResponseWriter, r *http.Request) (int, int, string) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.Dispatcher.SetResponseHeaders(r.Header.Get("Content-Type"), w, r)
+		w.Header().Set("X-Echo", r.Header.Get("X-Echo"))
+		w.Write(body)
+		return http.StatusOK, len(body), "Echoed."
+	}
+	fail := func(w http.ResponseWriter, r *http.Request) (int, int, string) {
+		return s.Dispatcher.ReplyProblem(w, r, dispatcher.NewProblem(http.StatusConflict, "always fails"))
+	}
+
+	s.Dispatcher.AddHandler("/echo", &dispatcher.HandlerGroup{Get: echo, Post: echo})
+	s.Dispatcher.AddHandler("/fail", &dispatcher.HandlerGroup{Get: fail})
+	return s
+}
+
+// ###########################################################################
+
+func TestRequests(t *testing.T) {
+	cfg := dispatcher.Configuration{}
+	cfg.Name = "harness"
+	s := newServer(t, &cfg)
+
+	tests := []struct {
+		name   string
+		result func() *dispatchertest.Result
+		status int
+		header string
+		body   string
+	}{
+		{"get", func() *dispatchertest.Result { return s.Get("/echo", "X-Echo", "1") }, http.StatusOK, "1", ""},
+		{"post", func() *dispatchertest.Result { return s.Post("/echo", "text/plain", "hello", "X-Echo", "2") }, http.StatusOK, "2", "hello"},
+		{"do", func() *dispatchertest.Result {
+			return s.Do(s.NewRequest(http.MethodPost, "/echo", strings.NewReader("done"), "X-Echo", "3"))
+		}, http.StatusOK, "3", "done"},
+		{"send", func() *dispatchertest.Result {
+			return s.Send(s.NewRequest(http.MethodPost, "/echo", strings.NewReader("sent"), "X-Echo", "4"))
+		}, http.StatusOK, "4", "sent"},
+		{"not found", func() *dispatchertest.Result { return s.Get("/missing") }, http.StatusNotFound, "", "/missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.result().AssertStatus(tt.status).AssertBody(tt.body)
+			if len(tt.header) > 0 {
+				result.AssertHeader("X-Echo", tt.header)
+			}
+		})
+	}
+
+	problem := s.Get("/fail").AssertStatus(http.StatusConflict).AssertHeader("Content-Type", dispatcher.ProblemContentType).Problem()
+	if problem.Status != http.StatusConflict || problem.Detail != "always fails" {
+		t.Errorf("problem: %+v", problem)
+	}
+
+	s.AssertMetric("ops_total", 6)
+	s.AssertMetric("ops_not_found", 1)
+	s.AssertMetric("problems_total", 2)
+	s.AssertMetric("problems_total", 1, "status", "409")
+	s.AssertLog("Echoed.")
+	if lines := s.Log.Lines(); len(lines) != 6 {
+		t.Errorf("log: %d lines, want 6:\n%s", len(lines), s.Log.String())
+	}
+
+	s.Log.Reset()
+	if lines := s.Log.Lines(); lines != nil {
+		t.Errorf("log after Reset: %q", lines)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestAssertions(t *testing.T) {
+	r := &recorder{TB: t}
+	s := newServer(r, &dispatcher.Configuration{})
+
+	result := s.Get("/echo", "X-Echo", "value", "Content-Type", "application/json; charset=utf-8")
+
+	tests := []struct {
+		name   string
+		assert func()
+		fails  bool
+	}{
+		{"status", func() { result.AssertStatus(http.StatusOK) }, false},
+		{"wrong status", func() { result.AssertStatus(http.StatusCreated) }, true},
+		{"header prefix", func() { result.AssertHeader("Content-Type", "application/json") }, false},
+		{"wrong header", func() { result.AssertHeader("X-Echo", "other") }, true},
+		{"missing header", func() { result.AssertHeader("X-Missing", "") }, true},
+		{"no header", func() { result.AssertNoHeader("X-Missing") }, false},
+		{"unexpected header", func() { result.AssertNoHeader("X-Echo") }, true},
+		{"body", func() { result.AssertBody("") }, false},
+		{"wrong body", func() { result.AssertBody("other") }, true},
+		{"metric", func() { s.AssertMetric("ops_total", 1) }, false},
+		{"wrong metric", func() { s.AssertMetric("ops_total", 2) }, true},
+		{"unknown label", func() { s.AssertMetric("problems_total", 0, "status", "500") }, false},
+		{"log", func() { s.AssertLog("/echo") }, false},
+		{"missing log", func() { s.AssertLog("not logged") }, true},
+	}
+
+	for _, tt := range tests {
+		tt.assert()
+		if failures := r.failures(); (len(failures) > 0) != tt.fails {
+			t.Errorf("%s: failures %q", tt.name, failures)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestParallel(t *testing.T) {
+	for i := 0; i < 4; i++ {
+		i := i
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			t.Parallel()
+
+			s := newServer(t, &dispatcher.Configuration{})
+			for j := 0; j <= i; j++ {
+				s.Get("/echo").AssertStatus(http.StatusOK)
+			}
+
+			// Each server has its own registry and log
+			s.AssertMetric("ops_total", float64(i+1))
+			if lines := s.Log.Lines(); len(lines) != i+1 {
+				t.Errorf("log: %d lines, want %d", len(lines), i+1)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestAdmin(t *testing.T) {
+	cfg := dispatcher.Configuration{}
+	cfg.AdminPort = 9999
+	s := newServer(t, &cfg)
+
+	response, err := http.Get(s.AdminURL() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+
+	if response.StatusCode != http.StatusOK || !strings.Contains(string(body), "ops_total") {
+		t.Errorf("admin metrics: %d '%s'", response.StatusCode, body)
+	}
+	if s.AdminURL() != s.AdminURL() {
+		t.Error("the admin server is started twice")
+	}
+
+	// Built-in endpoints moved to the admin listener are not served by
+	// Handler
+	s.Get("/metrics").AssertStatus(http.StatusNotFound)
+}
@@ -0,0 +1,65 @@
+package dispatchertest
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Test log
+// ###########################################################################
+// ###########################################################################
+
+// Log keeps the log output of a dispatcher. It may be written and read
+// from several goroutines.
+type Log struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+// ###########################################################################
+
+// Write ...
+func (l *Log) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.buffer.Write(p)
+}
+
+// ---------------------------------------------------------------------------
+
+// String returns the output so far
+func (l *Log) String() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.buffer.String()
+}
+
+// ---------------------------------------------------------------------------
+
+// Lines returns the lines logged so far
+func (l *Log) Lines() []string {
+	output := strings.TrimSuffix(l.String(), "\n")
+	if len(output) == 0 {
+		return nil
+	}
+	return strings.Split(output, "\n")
+}
+
+// ---------------------------------------------------------------------------
+
+// Contains reports if the output contains text
+func (l *Log) Contains(text string) bool {
+	return strings.Contains(l.String(), text)
+}
+
+// ---------------------------------------------------------------------------
+
+// Reset drops the output so far
+func (l *Log) Reset() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.buffer.Reset()
+}
@@ -0,0 +1,125 @@
+package dispatchertest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Test results
+// ###########################################################################
+// ###########################################################################
+
+// Result is a reply served to a test. The Assert methods fail the test and
+// return the result, so they can be chained.
+type Result struct {
+	Status int
+	Header http.Header
+	Body   []byte
+
+	t testing.TB
+}
+
+// ###########################################################################
+
+// newResult reads the reply completely
+func newResult(t testing.TB, response *http.Response) *Result {
+	t.Helper()
+
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("reading the reply: %s", err.Error())
+	}
+
+	return &Result{Status: response.StatusCode, Header: response.Header, Body: body, t: t}
+}
+
+// ---------------------------------------------------------------------------
+
+// AssertStatus checks the status
+func (r *Result) AssertStatus(status int) *Result {
+	r.t.Helper()
+
+	if r.Status != status {
+		r.t.Errorf("status: %d != %d, body was '%s'", r.Status, status, r.Body)
+	}
+	return r
+}
+
+// ---------------------------------------------------------------------------
+
+// AssertHeader checks that the header key starts with value, which is
+// enough for content types with parameters
+func (r *Result) AssertHeader(key string, value string) *Result {
+	r.t.Helper()
+
+	if actual := r.Header.Get(key); len(actual) == 0 || !strings.HasPrefix(actual, value) {
+		r.t.Errorf("header %s: '%s' != '%s'", key, actual, value)
+	}
+	return r
+}
+
+// ---------------------------------------------------------------------------
+
+// AssertNoHeader checks that the header key is not set
+func (r *Result) AssertNoHeader(key string) *Result {
+	r.t.Helper()
+
+	if actual := r.Header.Values(key); len(actual) > 0 {
+		r.t.Errorf("header %s: unexpected '%s'", key, strings.Join(actual, ", "))
+	}
+	return r
+}
+
+// ---------------------------------------------------------------------------
+
+// AssertBody checks that the body contains text
+func (r *Result) AssertBody(text string) *Result {
+	r.t.Helper()
+
+	if !strings.Contains(string(r.Body), text) {
+		r.t.Errorf("body does not contain '%s', body was '%s'", text, r.Body)
+	}
+	return r
+}
+
+// ###########################################################################
+
+// Decode decodes the JSON body to v, the test fails if it is no valid JSON
+func (r *Result) Decode(v interface{}) *Result {
+	r.t.Helper()
+
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		r.t.Fatalf("decoding body '%s': %s", r.Body, err.Error())
+	}
+	return r
+}
+
+// ---------------------------------------------------------------------------
+
+// Response decodes the body as Response
+func (r *Result) Response() dispatcher.Response {
+	r.t.Helper()
+
+	var response dispatcher.Response
+	r.Decode(&response)
+	return response
+}
+
+// ---------------------------------------------------------------------------
+
+// Problem decodes the body as Problem
+func (r *Result) Problem() dispatcher.Problem {
+	r.t.Helper()
+
+	var problem dispatcher.Problem
+	r.Decode(&problem)
+	return problem
+}
@@ -0,0 +1,318 @@
+package dispatcher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher Reply encodings
+// ###########################################################################
+// ###########################################################################
+
+// Reply encodes messages in the format the client accepts:
+//
+//	application/json          indented JSON (default), compact with ?pretty=false
+//	application/yaml          YAML
+//	application/msgpack       MessagePack
+//	application/cbor          CBOR
+//	application/x-protobuf    protobuf, for types registered with RegisterProtobuf
+//
+// YAML, MessagePack and CBOR use the JSON field names.
+
+// Encoding names a reply format
+type Encoding string
+
+// Known reply formats
+const (
+	EncodingJSON     Encoding = "application/json"
+	EncodingYAML     Encoding = "application/yaml"
+	EncodingMsgpack  Encoding = "application/msgpack"
+	EncodingCBOR     Encoding = "application/cbor"
+	EncodingProtobuf Encoding = "application/x-protobuf"
+)
+
+// mediaTypes maps accepted media types to encodings
+var mediaTypes = map[string]Encoding{
+	"application/json":       EncodingJSON,
+	"text/json":              EncodingJSON,
+	"application/yaml":       EncodingYAML,
+	"application/x-yaml":     EncodingYAML,
+	"text/yaml":              EncodingYAML,
+	"application/msgpack":    EncodingMsgpack,
+	"application/x-msgpack":  EncodingMsgpack,
+	"application/cbor":       EncodingCBOR,
+	"application/protobuf":   EncodingProtobuf,
+	"application/x-protobuf": EncodingProtobuf,
+}
+
+// ProtobufFunc converts a reply to its protobuf message
+type ProtobufFunc func(msg interface{}) proto.Message
+
+var protobufTypes = struct {
+	sync.RWMutex
+	fns map[reflect.Type]ProtobufFunc
+}{fns: map[reflect.Type]ProtobufFunc{}}
+
+// ###########################################################################
+
+// RegisterProtobuf allows replies of the type of sample to be sent as
+// protobuf. fn converts them to their message. Replies which are a
+// proto.Message already need no registration.
+func RegisterProtobuf(sample interface{}, fn ProtobufFunc) {
+	protobufTypes.Lock()
+	defer protobufTypes.Unlock()
+	protobufTypes.fns[reflect.TypeOf(sample)] = fn
+}
+
+// ---------------------------------------------------------------------------
+
+// protobufMessage returns msg as protobuf message, or nil if it has none
+func protobufMessage(msg interface{}) proto.Message {
+	if m, ok := msg.(proto.Message); ok {
+		return m
+	}
+
+	protobufTypes.RLock()
+	fn, exists := protobufTypes.fns[reflect.TypeOf(msg)]
+	protobufTypes.RUnlock()
+
+	if !exists {
+		return nil
+	}
+	return fn(msg)
+}
+
+// ---------------------------------------------------------------------------
+
+// negotiateEncoding picks the encoding of msg for r from its Accept header.
+// Media ranges are tried by quality, JSON is used if none matches.
+func negotiateEncoding(r *http.Request, msg interface{}) Encoding {
+	if r == nil {
+		return EncodingJSON
+	}
+
+	type mediaRange struct {
+		name    string
+		quality float64
+	}
+
+	var ranges []mediaRange
+	for _, entry := range strings.Split(r.Header.Get("Accept"), ",") {
+		parts := strings.Split(entry, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if len(name) == 0 {
+			continue
+		}
+		quality := 1.0
+		for _, param := range parts[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && kv[0] == "q" {
+				quality, _ = strconv.ParseFloat(kv[1], 64)
+			}
+		}
+		if quality > 0 {
+			ranges = append(ranges, mediaRange{name, quality})
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].quality > ranges[j].quality })
+
+	for _, mr := range ranges {
+		if mr.name == "*/*" || mr.name == "application/*" || mr.name == "text/*" {
+			return EncodingJSON
+		}
+		encoding, exists := mediaTypes[mr.name]
+		if !exists {
+			continue
+		}
+		if encoding == EncodingProtobuf && protobufMessage(msg) == nil {
+			continue
+		}
+		return encoding
+	}
+
+	return EncodingJSON
+}
+
+// ---------------------------------------------------------------------------
+
+// prettyJSON reports if r wants indented JSON, which is the default
+func prettyJSON(r *http.Request) bool {
+	if r == nil {
+		return true
+	}
+	query := r.URL.Query()
+	if _, exists := query["compact"]; exists {
+		return false
+	}
+	if values, exists := query["pretty"]; exists && len(values) > 0 && len(values[0]) > 0 {
+		pretty, err := strconv.ParseBool(values[0])
+		return err != nil || pretty
+	}
+	return true
+}
+
+// ---------------------------------------------------------------------------
+
+// encode marshals msg in encoding
+func encode(encoding Encoding, msg interface{}, pretty bool) ([]byte, error) {
+	switch encoding {
+
+	case EncodingYAML, EncodingMsgpack, EncodingCBOR:
+		value, err := jsonValue(msg)
+		if err != nil {
+			return nil, err
+		}
+		switch encoding {
+		case EncodingYAML:
+			return yaml.Marshal(value)
+		case EncodingMsgpack:
+			var buf bytes.Buffer
+			encoder := msgpack.NewEncoder(&buf)
+			encoder.UseCompactInts(true)
+			err = encoder.Encode(value)
+			return buf.Bytes(), err
+		default:
+			return cbor.Marshal(value)
+		}
+
+	case EncodingProtobuf:
+		m := protobufMessage(msg)
+		if m == nil {
+			return nil, errors.New("no protobuf message registered")
+		}
+		return proto.Marshal(m)
+	}
+
+	if pretty {
+		return json.MarshalIndent(msg, "", "  ")
+	}
+	return json.Marshal(msg)
+}
+
+// ---------------------------------------------------------------------------
+
+// jsonValue converts msg to maps, lists and scalars as its JSON encoding
+// describes it, so other encodings use the same names
+func jsonValue(msg interface{}) (interface{}, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return numbers(value), nil
+}
+
+func numbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = numbers(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = numbers(v[k])
+		}
+	}
+	return value
+}
+
+// ###########################################################################
+
+// responseWriter is passed to the handlers. It keeps the request, so Reply
+// can negotiate its format, and delays the status until the first write, so
+// Reply can still set the content type.
+type responseWriter struct {
+	http.ResponseWriter
+	request *http.Request
+	status  int
+	bytes   int
+	written bool
+}
+
+func newResponseWriter(w http.ResponseWriter, r *http.Request) *responseWriter {
+	return &responseWriter{ResponseWriter: w, request: r}
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.written || rw.status != 0 {
+		return
+	}
+	rw.status = status
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	rw.writeHeader()
+	n, err := rw.ResponseWriter.Write(p)
+	rw.bytes += n
+	return n, err
+}
+
+// writeHeader sends the status, if it was not yet sent
+func (rw *responseWriter) writeHeader() {
+	if rw.written {
+		return
+	}
+	rw.written = true
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.ResponseWriter.WriteHeader(rw.status)
+}
+
+// Flush sends the status and flushes buffered data
+func (rw *responseWriter) Flush() {
+	rw.writeHeader()
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands the connection to the caller
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection can not be hijacked")
+	}
+	rw.written = true
+	return hijacker.Hijack()
+}
+
+// ---------------------------------------------------------------------------
+
+// requestOf returns the request w answers, if w was passed by the dispatcher
+func requestOf(w http.ResponseWriter) *http.Request {
+	if rw, ok := w.(*responseWriter); ok {
+		return rw.request
+	}
+	return nil
+}
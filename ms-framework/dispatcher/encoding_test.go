@@ -0,0 +1,136 @@
+package dispatcher
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	plain := struct{ Name string }{"x"}
+	message := wrapperspb.String("x")
+
+	tests := []struct {
+		name   string
+		accept string
+		msg    interface{}
+		want   Encoding
+	}{
+		{"no accept", "", plain, EncodingJSON},
+		{"json", "application/json", plain, EncodingJSON},
+		{"yaml", "application/yaml", plain, EncodingYAML},
+		{"alias", "application/x-yaml", plain, EncodingYAML},
+		{"case and parameters", "Application/MsgPack; charset=utf-8", plain, EncodingMsgpack},
+		{"quality", "application/yaml;q=0.5, application/cbor", plain, EncodingCBOR},
+		{"order of equal quality", "application/cbor, application/yaml", plain, EncodingCBOR},
+		{"wildcard first", "*/*, application/yaml;q=0.9", plain, EncodingJSON},
+		{"unknown skipped", "text/html, application/yaml;q=0.1", plain, EncodingYAML},
+		{"zero quality", "application/yaml;q=0", plain, EncodingJSON},
+		{"unknown only", "text/html", plain, EncodingJSON},
+		{"protobuf without message", "application/x-protobuf, application/yaml;q=0.5", plain, EncodingYAML},
+		{"protobuf message", "application/protobuf", message, EncodingProtobuf},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if len(tt.accept) > 0 {
+				r.Header.Set("Accept", tt.accept)
+			}
+			if got := negotiateEncoding(r, tt.msg); got != tt.want {
+				t.Errorf("'%s': %s != %s", tt.accept, got, tt.want)
+			}
+		})
+	}
+
+	if got := negotiateEncoding(nil, plain); got != EncodingJSON {
+		t.Errorf("without request: %s != %s", got, EncodingJSON)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestPrettyJSON(t *testing.T) {
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"/", true},
+		{"/?compact", false},
+		{"/?pretty=false", false},
+		{"/?pretty=0", false},
+		{"/?pretty=true", true},
+		{"/?pretty=", true},
+		{"/?pretty=bogus", true},
+	}
+
+	for _, tt := range tests {
+		if got := prettyJSON(httptest.NewRequest("GET", tt.target, nil)); got != tt.want {
+			t.Errorf("%s: %t != %t", tt.target, got, tt.want)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestEncode(t *testing.T) {
+	msg := struct {
+		Name  string  `json:"name"`
+		Count int     `json:"count"`
+		Ratio float64 `json:"ratio"`
+	}{"x", 3, 0.5}
+
+	tests := []struct {
+		encoding Encoding
+		pretty   bool
+		want     string
+	}{
+		{EncodingJSON, false, `{"name":"x","count":3,"ratio":0.5}`},
+		{EncodingJSON, true, "{\n  \"name\": \"x\",\n  \"count\": 3,\n  \"ratio\": 0.5\n}"},
+		{EncodingYAML, false, "count: 3\nname: x\nratio: 0.5\n"},
+	}
+
+	for _, tt := range tests {
+		data, err := encode(tt.encoding, msg, tt.pretty)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.encoding, err.Error())
+		}
+		if string(data) != tt.want {
+			t.Errorf("%s: %q != %q", tt.encoding, data, tt.want)
+		}
+	}
+
+	// Map keys are written in random order, the values are decoded
+	want := map[string]interface{}{"name": "x", "count": uint64(3), "ratio": 0.5}
+	data, err := encode(EncodingCBOR, msg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := cbor.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Errorf("%s: %v != %v", EncodingCBOR, decoded, want)
+	}
+
+	want["count"] = int8(3)
+	if data, err = encode(EncodingMsgpack, msg, false); err != nil {
+		t.Fatal(err)
+	}
+	decoded = nil
+	if err := msgpack.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Errorf("%s: %v != %v", EncodingMsgpack, decoded, want)
+	}
+
+	if _, err := encode(EncodingProtobuf, msg, false); err == nil {
+		t.Error("protobuf: a type without message is encoded")
+	}
+}
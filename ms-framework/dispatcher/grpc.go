@@ -0,0 +1,355 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher gRPC
+// ###########################################################################
+// ###########################################################################
+
+// Services registered with RegisterService are served if grpc is set, on
+// grpcport or, if it is not set, on the listeners of the service next to
+// the REST handlers. The latter requires HTTP/2, i.e. TLS with http2 or h2c.
+//
+// Calls pass the same stages as requests: the correlation and tracing ids
+// are taken from the metadata or generated, replied and propagated by
+// SetRequestHeaders and GRPCDialOptions, calls are counted, limited by the
+// request timeout, logged and panics are recovered. Interceptors added by
+// AddGRPCInterceptor run after these, like the auth wrappers of REST.
+
+// ContentTypeGRPC is the content type of gRPC requests
+const ContentTypeGRPC = "application/grpc"
+
+// grpcService is a service registered before the server is created
+type grpcService struct {
+	desc *grpc.ServiceDesc
+	impl interface{}
+}
+
+// grpcServerStream replaces the context of a server stream
+type grpcServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context ...
+func (s *grpcServerStream) Context() context.Context { return s.ctx }
+
+// ###########################################################################
+
+// RegisterService registers a gRPC service, so Dispatcher is a
+// grpc.ServiceRegistrar for the generated Register functions. Services must
+// be registered before Run.
+func (ds *Dispatcher) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
+	ds.grpcServices = append(ds.grpcServices, grpcService{desc: desc, impl: impl})
+}
+
+// ---------------------------------------------------------------------------
+
+// AddGRPCInterceptor adds interceptors of unary and streaming calls, either
+// may be nil. They run in the order they were added, after the built-in
+// ones.
+func (ds *Dispatcher) AddGRPCInterceptor(unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) {
+	if unary != nil {
+		ds.grpcUnaryInterceptors = append(ds.grpcUnaryInterceptors, unary)
+	}
+	if stream != nil {
+		ds.grpcStreamInterceptors = append(ds.grpcStreamInterceptors, stream)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// GetGRPCServices returns the names of the registered gRPC services
+func (ds *Dispatcher) GetGRPCServices() []string {
+	var names []string
+	for _, service := range ds.grpcServices {
+		names = append(names, service.desc.ServiceName)
+	}
+	return names
+}
+
+// ---------------------------------------------------------------------------
+
+// GRPCDialOptions returns the options to call other services over gRPC. The
+// client uses the TLS configuration of the HTTP client and the metadata of
+// its calls is set like the headers of outgoing requests by
+// SetRequestHeaders, from the context of the call.
+func (ds *Dispatcher) GRPCDialOptions() []grpc.DialOption {
+	options := []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(ds.outgoingGRPCContext(ctx, method), method, req, reply, cc, opts...)
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return streamer(ds.outgoingGRPCContext(ctx, method), desc, cc, method, opts...)
+		}),
+	}
+
+	if ds.tlsInfo != nil {
+		options = append(options, grpc.WithTransportCredentials(credentials.NewTLS(ds.tlsInfo.tlsConfig.Clone())))
+	} else {
+		options = append(options, grpc.WithInsecure())
+	}
+
+	return options
+}
+
+// ###########################################################################
+
+// newGRPCServer creates the server of the registered services. It handles
+// TLS itself on its own port, on the listeners of the service they do.
+func (ds *Dispatcher) newGRPCServer() (*grpc.Server, error) {
+	if ds.GetGRPCPort() == 0 && !(ds.hasServerTLS() && ds.GetHTTP2()) && !ds.GetH2C() {
+		return nil, errors.New("gRPC on the listeners of the service requires TLS with http2 or h2c")
+	}
+
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(append([]grpc.UnaryServerInterceptor{ds.grpcUnaryInterceptor}, ds.grpcUnaryInterceptors...)...),
+		grpc.ChainStreamInterceptor(append([]grpc.StreamServerInterceptor{ds.grpcStreamInterceptor}, ds.grpcStreamInterceptors...)...),
+		grpc.MaxConcurrentStreams(uint32(ds.GetMaxConcurrentStreams())),
+	}
+
+	// The server can not change its limit, reloads of maxbodysize only
+	// apply to HTTP routes
+	if ds.GetMaxBodySize() > 0 {
+		options = append(options, grpc.MaxRecvMsgSize(ds.GetMaxBodySize()))
+	}
+
+	if ds.GetGRPCPort() > 0 && ds.hasServerTLS() {
+		options = append(options, grpc.Creds(credentials.NewTLS(ds.tlsInfo.tlsConfig.Clone())))
+	}
+
+	server := grpc.NewServer(options...)
+
+	// The log fits the methods of the services, not the long ones of
+	// reflection
+	for _, service := range ds.grpcServices {
+		server.RegisterService(service.desc, service.impl)
+		for _, method := range service.desc.Methods {
+			ds.fitPathLen(fmt.Sprintf("/%s/%s", service.desc.ServiceName, method.MethodName))
+		}
+		for _, stream := range service.desc.Streams {
+			ds.fitPathLen(fmt.Sprintf("/%s/%s", service.desc.ServiceName, stream.StreamName))
+		}
+	}
+
+	if ds.GetGRPCReflection() {
+		reflection.Register(server)
+	}
+
+	return server, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// listenGRPC opens the listener of grpcport. The server handles TLS.
+func (ds *Dispatcher) listenGRPC() (net.Listener, *listenAddress, error) {
+	la := &listenAddress{
+		network: "tcp",
+		address: net.JoinHostPort(ds.GetHost(), strconv.Itoa(ds.GetGRPCPort())),
+		tls:     ds.hasServerTLS(),
+	}
+
+	listeners, err := ds.listen(&listenAddress{network: la.network, address: la.address}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return listeners[0], la, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// grpcHandler passes gRPC requests to server and all others to h
+func grpcHandler(server *grpc.Server, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), ContentTypeGRPC) {
+			server.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+}
+
+// ###########################################################################
+
+func (ds *Dispatcher) grpcUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	ctx = ds.incomingGRPCContext(ctx)
+
+	var timeout int
+	ds.ViewConfiguration(func() { timeout = ds.GetRequestTimeout() })
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+		defer cancel()
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = ds.recoverGRPCPanic(ctx, info.FullMethod, p)
+		}
+		ds.logGRPC(ctx, info.FullMethod, err)
+	}()
+
+	return handler(ctx, req)
+}
+
+// ---------------------------------------------------------------------------
+
+func (ds *Dispatcher) grpcStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	ctx := ds.incomingGRPCContext(ss.Context())
+
+	ds.prometheusGRPCStreams.Inc()
+	defer ds.prometheusGRPCStreams.Dec()
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = ds.recoverGRPCPanic(ctx, info.FullMethod, p)
+		}
+		ds.logGRPC(ctx, info.FullMethod, err)
+	}()
+
+	return handler(srv, &grpcServerStream{ServerStream: ss, ctx: ctx})
+}
+
+// ---------------------------------------------------------------------------
+
+// incomingGRPCContext takes the ids of a call from its metadata or
+// generates them and replies them with the copied headers. The context
+// carries the ids and the metadata as headers for outgoing requests.
+func (ds *Dispatcher) incomingGRPCContext(ctx context.Context) context.Context {
+	ds.prometheusOps.Inc()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := http.Header{}
+	for key, values := range md {
+		if !strings.HasSuffix(key, "-bin") {
+			header[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+
+	ids := RequestIDs{
+		CorrelationID: header.Get(HeaderCorrelationID),
+		RequestID:     header.Get(HeaderRequestID),
+	}
+	if len(ids.CorrelationID) == 0 {
+		ids.CorrelationID = newUUID()
+		header.Set(HeaderCorrelationID, ids.CorrelationID)
+	}
+	if len(ids.RequestID) == 0 {
+		ids.RequestID = newUUID()
+		header.Set(HeaderRequestID, ids.RequestID)
+	}
+
+	method, _ := grpc.Method(ctx)
+	reply := http.Header{}
+	ds.ViewConfiguration(func() {
+		for _, h := range fixedCopyHeaders {
+			h.apply(reply, header)
+		}
+		for _, h := range ds.GetCopyHeaderOperations() {
+			if h.matches(http.MethodPost, method) {
+				h.apply(reply, header)
+			}
+		}
+	})
+	grpc.SetHeader(ctx, headerMetadata(reply))
+
+	ctx = WithRequestIDs(ctx, ids)
+	return context.WithValue(ctx, incomingHeaderKey, header)
+}
+
+// ---------------------------------------------------------------------------
+
+// outgoingGRPCContext adds the headers SetRequestHeaders sets on outgoing
+// requests to the metadata of a call. Metadata set by the caller is kept.
+func (ds *Dispatcher) outgoingGRPCContext(ctx context.Context, method string) context.Context {
+	out := (&http.Request{Method: http.MethodPost, URL: &url.URL{Path: method}, Header: http.Header{}}).WithContext(ctx)
+	ds.SetRequestHeaders("", out, nil)
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	for key, values := range headerMetadata(out.Header) {
+		if len(md.Get(key)) == 0 {
+			md.Set(key, values...)
+		}
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// ---------------------------------------------------------------------------
+
+// incomingHeader returns the metadata of the gRPC call of ctx as headers,
+// nil if ctx is not the one of a call
+func incomingHeader(ctx context.Context) http.Header {
+	header, _ := ctx.Value(incomingHeaderKey).(http.Header)
+	return header
+}
+
+// ---------------------------------------------------------------------------
+
+// headerMetadata converts headers to metadata, whose keys are lower case
+func headerMetadata(header http.Header) metadata.MD {
+	md := metadata.MD{}
+	for key, values := range header {
+		md.Append(key, values...)
+	}
+	return md
+}
+
+// ---------------------------------------------------------------------------
+
+// recoverGRPCPanic handles a panic p of a gRPC handler like recoverPanic
+// does for requests. The panic is logged, the client only gets a generic
+// error, as p may contain secrets.
+func (ds *Dispatcher) recoverGRPCPanic(ctx context.Context, method string, p interface{}) error {
+	ds.prometheusPanics.Inc()
+	ids := GetRequestIDs(ctx)
+
+	ds.GetLogger().Println(fmt.Sprintf("Recovered from panic '%v' in handler of 'GRPC %s', correlation id '%s', request id '%s':\n%s", p, method, ids.CorrelationID, ids.RequestID, debug.Stack()))
+
+	if ds.GetRepanic() {
+		panic(p)
+	}
+
+	return status.Error(codes.Internal, "The service failed to handle the call.")
+}
+
+// ---------------------------------------------------------------------------
+
+// logGRPC counts a call by its status and writes its log line. The status
+// column holds the gRPC code.
+func (ds *Dispatcher) logGRPC(ctx context.Context, method string, err error) {
+	st := status.Convert(err)
+	ids := GetRequestIDs(ctx)
+
+	ds.prometheusGRPCCalls.WithLabelValues(method, st.Code().String()).Inc()
+	if st.Code() == codes.Unauthenticated {
+		ds.prometheusOps401.Inc()
+	}
+
+	msg := st.Code().String()
+	if err != nil {
+		msg = fmt.Sprintf("%s: %s", msg, st.Message())
+	}
+
+	ds.GetLogger().Printf("> %-6.6s | %3d | %6d | %-*.*s | %-36.36s | %-36.36s | %s\n", "GRPC", st.Code(), 0, ds.maxPathLen, ds.maxPathLen, method, ids.CorrelationID, ids.RequestID, msg)
+}
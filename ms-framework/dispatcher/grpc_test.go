@@ -0,0 +1,47 @@
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCPanic(t *testing.T) {
+	var cfg Configuration
+	loader := config.NewLoader(flag.NewFlagSet("ds", flag.ContinueOnError), "MS_")
+	if err := loader.Add(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Defaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	ds := &Dispatcher{Registry: prometheus.NewRegistry()}
+	Init(ds, &cfg, nil, nil, log.New(&output, "", 0))
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Panic"}
+	_, err := ds.grpcUnaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("password=hunter2")
+	})
+
+	st := status.Convert(err)
+	if st.Code() != codes.Internal {
+		t.Errorf("code: %s", st.Code())
+	}
+	if strings.Contains(st.Message(), "hunter2") {
+		t.Errorf("the panic was sent to the client: '%s'", st.Message())
+	}
+	if !strings.Contains(output.String(), "Recovered from panic 'password=hunter2'") {
+		t.Errorf("the panic was not logged:\n%s", output.String())
+	}
+}
@@ -2,6 +2,7 @@ package dispatcher
 
 import (
 	"net/http"
+	"time"
 )
 
 // ###########################################################################
@@ -23,4 +24,45 @@ type HandlerGroup struct {
 	Connect HTTPHandler
 	Options HTTPHandler
 	Any     HTTPHandler
+
+	// MaxBodySize limits the request bodies of the route. The configured
+	// maxbodysize applies if it is 0, no limit if it is negative.
+	MaxBodySize int64
+
+	// Timeout cancels the context of requests to the route. The configured
+	// requesttimeout applies if it is 0, none if it is negative.
+	Timeout time.Duration
+
+	// methods are the ones handled by the service, before missing handlers
+	// are filled in
+	methods []string
+}
+
+// ---------------------------------------------------------------------------
+
+// handledMethods lists the methods with a handler, or all methods if Any is
+// set
+func (hg *HandlerGroup) handledMethods() []string {
+	if hg.Any != nil {
+		return allMethods
+	}
+
+	var methods []string
+	for _, entry := range []struct {
+		method  string
+		handler HTTPHandler
+	}{
+		{http.MethodGet, hg.Get},
+		{http.MethodHead, hg.Head},
+		{http.MethodPost, hg.Post},
+		{http.MethodPut, hg.Put},
+		{http.MethodDelete, hg.Delete},
+		{http.MethodConnect, hg.Connect},
+		{http.MethodOptions, hg.Options},
+	} {
+		if entry.handler != nil {
+			methods = append(methods, entry.method)
+		}
+	}
+	return methods
 }
@@ -1,7 +1,10 @@
 package dispatcher
 
 import (
+	"crypto/rand"
+	"fmt"
 	"net/http"
+	"regexp"
 	"strings"
 )
 
@@ -11,36 +14,172 @@ import (
 // ----------------------------------------------------------------------------
 // ----------------------------------------------------------------------------
 
-type Header struct {
-	Key   string
-	Value string
-}
+// Header rules are configured as strings, optionally preceded by conditions
+// in brackets:
+//
+//	X-Env: prod                      set the header
+//	X-Request-Id?: {{uuid}}          set the header if it is missing
+//	-X-Powered-By                    remove the header
+//	X-Old>X-New                      rename the header
+//	[method=GET|HEAD path=/api/*] Cache-Control: max-age=60
+//
+// Values may contain templates, which are expanded for each request:
+//
+//	{{name}} {{hostname}} {{version}} {{namespace}}   service configuration
+//	{{method}} {{path}} {{host}} {{remoteaddr}}       request data
+//	{{header.X-Name}} {{query.name}}                  request header or query
+//	{{uuid}}                                          a random UUID
+//
+// Conditions and request data refer to the request served, or to the
+// outgoing request if it is not made while serving one. Paths are matched
+// without the namespace, a trailing '*' matches any suffix.
 
-func (h *Header) appendRequest(out *http.Request) {
-	out.Header.Add(h.Key, h.Value)
-}
+const (
+	HA_Set = iota
+	HA_Default
+	HA_Remove
+	HA_Rename
+)
 
-func (h *Header) appendResponse(out http.ResponseWriter) {
-	out.Header().Add(h.Key, h.Value)
+// HeaderCondition restricts a header rule to some requests. Empty lists match
+// all requests.
+type HeaderCondition struct {
+	Methods []string
+	Paths   []string
 }
 
-func (h *Header) setRequest(out *http.Request) {
-	out.Header.Set(h.Key, h.Value)
+type Header struct {
+	HeaderCondition
+	Key    string
+	Value  string
+	Action int
+	NewKey string
 }
 
-func (h *Header) setResponse(out http.ResponseWriter) {
-	out.Header().Set(h.Key, h.Value)
+var reHeaderTemplate = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// apply changes header according to the rule. Set appends to the existing
+// values if add is true.
+func (h *Header) apply(header http.Header, value func() string, add bool) {
+	switch h.Action {
+	case HA_Set:
+		if add {
+			header.Add(h.Key, value())
+		} else {
+			header.Set(h.Key, value())
+		}
+	case HA_Default:
+		if len(header.Values(h.Key)) == 0 {
+			header.Set(h.Key, value())
+		}
+	case HA_Remove:
+		header.Del(h.Key)
+	case HA_Rename:
+		values := header.Values(h.Key)
+		header.Del(h.Key)
+		for _, v := range values {
+			header.Add(h.NewKey, v)
+		}
+	}
 }
 
 // HeaderFromString ...
 func HeaderFromString(line string) *Header {
 	var header Header
+	line = header.HeaderCondition.parse(line)
+
+	if strings.HasPrefix(line, "-") {
+		header.Action = HA_Remove
+		header.Key = strings.TrimSpace(line[1:])
+		return &header
+	}
+
 	pairs := strings.SplitN(line, ":", 2)
-	header.Key = pairs[0]
-	header.Value = strings.Trim(pairs[1], " ")
+
+	if len(pairs) == 1 && strings.Contains(line, ">") {
+		names := strings.SplitN(line, ">", 2)
+		header.Action = HA_Rename
+		header.Key = strings.TrimSpace(names[0])
+		header.NewKey = strings.TrimSpace(names[1])
+		return &header
+	}
+
+	header.Key = strings.TrimSpace(pairs[0])
+	if len(pairs) > 1 {
+		header.Value = strings.Trim(pairs[1], " ")
+	}
+
+	if strings.HasSuffix(header.Key, "?") {
+		header.Action = HA_Default
+		header.Key = strings.TrimSuffix(header.Key, "?")
+	}
+
 	return &header
 }
 
+// ---------------------------------------------------------------------------
+
+// parse reads conditions like '[method=GET|POST path=/api/*]' from the start
+// of line and returns the rest of it
+func (c *HeaderCondition) parse(line string) string {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "[") {
+		return line
+	}
+
+	end := strings.Index(line, "]")
+	if end < 0 {
+		return line
+	}
+
+	for _, term := range strings.Fields(line[1:end]) {
+		kv := strings.SplitN(term, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		values := strings.Split(kv[1], "|")
+		switch strings.ToLower(kv[0]) {
+		case "method":
+			for _, v := range values {
+				c.Methods = append(c.Methods, strings.ToUpper(v))
+			}
+		case "path", "route":
+			c.Paths = append(c.Paths, values...)
+		}
+	}
+
+	return strings.TrimSpace(line[end+1:])
+}
+
+// ---------------------------------------------------------------------------
+
+// matches reports if the condition holds for a request of method to path
+func (c *HeaderCondition) matches(method string, path string) bool {
+	if len(c.Methods) > 0 {
+		found := false
+		for _, m := range c.Methods {
+			if m == method {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(c.Paths) > 0 {
+		for _, p := range c.Paths {
+			if p == path || (strings.HasSuffix(p, "*") && strings.HasPrefix(path, strings.TrimSuffix(p, "*"))) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
 // ----------------------------------------------------------------------------
 // ----------------------------------------------------------------------------
 // ----------------------------------------------------------------------------
@@ -54,44 +193,49 @@ const (
 )
 
 type HeaderOperation struct {
+	HeaderCondition
 	Key string
 	Op  int
 }
 
-func (h *HeaderOperation) setToResponse(out http.ResponseWriter, in *http.Request) {
-	values := in.Header.Values(h.Key)
-
-	if h.Op == HO_Force {
-		out.Header().Del(h.Key)
-	}
-
-	if len(values) > 0 {
-
-		if h.Op == HO_Copy {
-			out.Header().Del(h.Key)
-		}
-
-		for _, value := range values {
-			out.Header().Add(h.Key, value)
+// HeaderOperationFromString parses copy operations like 'X-Name',
+// 'append:X-Name' or 'force:X-Name', optionally preceded by conditions.
+func HeaderOperationFromString(line string) *HeaderOperation {
+	var op HeaderOperation
+	line = op.HeaderCondition.parse(line)
+	op.Key = line
+	op.Op = HO_Copy
+
+	if pairs := strings.SplitN(line, ":", 2); len(pairs) == 2 {
+		switch strings.ToLower(pairs[0]) {
+		case "copy":
+			op.Op = HO_Copy
+		case "append":
+			op.Op = HO_Append
+		case "force":
+			op.Op = HO_Force
 		}
+		op.Key = strings.TrimSpace(pairs[1])
 	}
+
+	return &op
 }
 
-func (h *HeaderOperation) setToRequest(out *http.Request, in *http.Request) {
-	values := in.Header.Values(h.Key)
+func (h *HeaderOperation) apply(out http.Header, in http.Header) {
+	values := in.Values(h.Key)
 
 	if h.Op == HO_Force {
-		out.Header.Del(h.Key)
+		out.Del(h.Key)
 	}
 
 	if len(values) > 0 {
 
 		if h.Op == HO_Copy {
-			out.Header.Del(h.Key)
+			out.Del(h.Key)
 		}
 
 		for _, value := range values {
-			out.Header.Add(h.Key, value)
+			out.Add(h.Key, value)
 		}
 	}
 }
@@ -120,8 +264,10 @@ var fixedCopyHeaders = []HeaderOperation{
 // ----------------------------------------------------------------------------
 // ----------------------------------------------------------------------------
 
+// SetResponseHeaders sets the headers of a reply. The header functions run
+// before the configured headers are applied, outside of the configuration
+// lock, so they may use ViewConfiguration.
 func (ds *Dispatcher) SetResponseHeaders(contentType string, out http.ResponseWriter, in *http.Request) {
-
 	if len(contentType) != 0 {
 		out.Header().Set("Content-Type", contentType)
 	}
@@ -130,29 +276,37 @@ func (ds *Dispatcher) SetResponseHeaders(contentType string, out http.ResponseWr
 		fn(out, in)
 	}
 
+	ds.configMutex.RLock()
+	defer ds.configMutex.RUnlock()
+
 	if len(ds.GetNamespace()) > 0 {
 		out.Header().Set("X-Namespace", ds.GetNamespace())
 	}
 
+	method, path := ds.headerRoute(in)
+
 	if in != nil {
 		for _, h := range fixedCopyHeaders {
-			h.setToResponse(out, in)
+			h.apply(out.Header(), in.Header)
 		}
 		for _, h := range ds.GetCopyHeaderOperations() {
-			h.setToResponse(out, in)
+			if h.matches(method, path) {
+				h.apply(out.Header(), in.Header)
+			}
 		}
 	}
 
-	if len(ds.GetResponseHeaders()) > 0 {
-		for _, h := range ds.GetResponseHeaders() {
-			h.setResponse(out)
+	for _, h := range ds.GetResponseHeaders() {
+		if h.matches(method, path) {
+			h.apply(out.Header(), func() string { return ds.expandHeaderValue(h.Value, in) }, false)
 		}
 	}
 
 }
 
+// SetRequestHeaders sets the headers of an outgoing request, like
+// SetResponseHeaders does for replies
 func (ds *Dispatcher) SetRequestHeaders(contentType string, out *http.Request, in *http.Request) {
-
 	if len(contentType) != 0 {
 		out.Header.Set("Content-Type", contentType)
 	}
@@ -161,22 +315,141 @@ func (ds *Dispatcher) SetRequestHeaders(contentType string, out *http.Request, i
 		fn(out, in)
 	}
 
+	ds.configMutex.RLock()
+	defer ds.configMutex.RUnlock()
+
 	if len(ds.GetNamespace()) > 0 {
 		out.Header.Set("X-Namespace", ds.GetNamespace())
 	}
 
+	source := in
+	if source == nil {
+		source = out
+	}
+	method, path := ds.headerRoute(source)
+
+	// Without an incoming request the metadata of a gRPC call is copied
+	incoming := incomingHeader(out.Context())
 	if in != nil {
+		incoming = in.Header
+	}
+
+	if incoming != nil {
 		for _, h := range fixedCopyHeaders {
-			h.setToRequest(out, in)
+			h.apply(out.Header, incoming)
 		}
 		for _, h := range ds.GetCopyHeaderOperations() {
-			h.setToRequest(out, in)
+			if h.matches(method, path) {
+				h.apply(out.Header, incoming)
+			}
 		}
 	}
 
-	if len(ds.GetRequestHeaders()) > 0 {
-		for _, h := range ds.GetRequestHeaders() {
-			h.appendRequest(out)
+	if in == nil {
+		ids := GetRequestIDs(out.Context())
+		if len(ids.CorrelationID) > 0 && len(out.Header.Get(HeaderCorrelationID)) == 0 {
+			out.Header.Set(HeaderCorrelationID, ids.CorrelationID)
 		}
+		if len(ids.RequestID) > 0 && len(out.Header.Get(HeaderRequestID)) == 0 {
+			out.Header.Set(HeaderRequestID, ids.RequestID)
+		}
+	}
+
+	for _, h := range ds.GetRequestHeaders() {
+		if h.matches(method, path) {
+			h.apply(out.Header, func() string { return ds.expandHeaderValue(h.Value, source) }, true)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// headerRoute returns the method and the path without namespace of r, which
+// header conditions are matched against
+func (ds *Dispatcher) headerRoute(r *http.Request) (string, string) {
+	if r == nil || r.URL == nil {
+		return "", ""
+	}
+
+	path := r.URL.Path
+	if len(ds.GetNamespace()) > 0 {
+		path = strings.TrimPrefix(path, "/"+ds.GetNamespace())
+	}
+	return r.Method, path
+}
+
+// ----------------------------------------------------------------------------
+
+// expandHeaderValue replaces the templates in value. Unknown templates are
+// kept as they are.
+func (ds *Dispatcher) expandHeaderValue(value string, r *http.Request) string {
+	if !strings.Contains(value, "{{") {
+		return value
+	}
+
+	return reHeaderTemplate.ReplaceAllStringFunc(value, func(m string) string {
+		name := reHeaderTemplate.FindStringSubmatch(m)[1]
+
+		switch name {
+		case "name":
+			return ds.GetName()
+		case "hostname":
+			return ds.GetHostname()
+		case "version":
+			return ds.GetVersion()
+		case "namespace":
+			return ds.GetNamespace()
+		case "uuid":
+			return newUUID()
+		}
+
+		if value, ok := requestTemplateValue(name, r); ok {
+			return value
+		}
+		return m
+	})
+}
+
+// ----------------------------------------------------------------------------
+
+// requestTemplateValue returns the value of a template of request data, which
+// is empty without request, and whether name is such a template
+func requestTemplateValue(name string, r *http.Request) (string, bool) {
+	switch {
+	case name == "method", name == "path", name == "host", name == "remoteaddr":
+	case strings.HasPrefix(name, "header."), strings.HasPrefix(name, "query."):
+	default:
+		return "", false
+	}
+
+	if r == nil {
+		return "", true
+	}
+
+	switch {
+	case name == "method":
+		return r.Method, true
+	case name == "path":
+		return r.URL.Path, true
+	case name == "host":
+		return r.Host, true
+	case name == "remoteaddr":
+		return r.RemoteAddr, true
+	case strings.HasPrefix(name, "header."):
+		return r.Header.Get(strings.TrimPrefix(name, "header.")), true
+	}
+	return r.URL.Query().Get(strings.TrimPrefix(name, "query.")), true
+}
+
+// ----------------------------------------------------------------------------
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
 	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
 }
@@ -0,0 +1,149 @@
+package dispatcher
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestHeaderFromString(t *testing.T) {
+	tests := []struct {
+		line string
+		want Header
+	}{
+		{"X-Env: prod", Header{Key: "X-Env", Value: "prod", Action: HA_Set}},
+		{"X-Empty:", Header{Key: "X-Empty", Action: HA_Set}},
+		{"X-Url: http://host:8080/", Header{Key: "X-Url", Value: "http://host:8080/", Action: HA_Set}},
+		{"X-Request-Id?: {{uuid}}", Header{Key: "X-Request-Id", Value: "{{uuid}}", Action: HA_Default}},
+		{"-X-Powered-By", Header{Key: "X-Powered-By", Action: HA_Remove}},
+		{"X-Old > X-New", Header{Key: "X-Old", NewKey: "X-New", Action: HA_Rename}},
+		{"X-Arrow: a>b", Header{Key: "X-Arrow", Value: "a>b", Action: HA_Set}},
+		{
+			"[method=get|HEAD path=/api/*] Cache-Control: max-age=60",
+			Header{HeaderCondition: HeaderCondition{Methods: []string{"GET", "HEAD"}, Paths: []string{"/api/*"}}, Key: "Cache-Control", Value: "max-age=60"},
+		},
+		{"[route=/a|/b] -X-Debug", Header{HeaderCondition: HeaderCondition{Paths: []string{"/a", "/b"}}, Key: "X-Debug", Action: HA_Remove}},
+		{"[unclosed X-Key: value", Header{Key: "[unclosed X-Key", Value: "value"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := HeaderFromString(tt.line); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("%+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestHeaderOperationFromString(t *testing.T) {
+	tests := []struct {
+		line string
+		want HeaderOperation
+	}{
+		{"X-Name", HeaderOperation{Key: "X-Name", Op: HO_Copy}},
+		{"copy:X-Name", HeaderOperation{Key: "X-Name", Op: HO_Copy}},
+		{"append:X-Name", HeaderOperation{Key: "X-Name", Op: HO_Append}},
+		{"Force: X-Name", HeaderOperation{Key: "X-Name", Op: HO_Force}},
+		{"[method=POST] X-Name", HeaderOperation{HeaderCondition: HeaderCondition{Methods: []string{"POST"}}, Key: "X-Name"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := HeaderOperationFromString(tt.line); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("%+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestHeaderConditionMatches(t *testing.T) {
+	condition := HeaderCondition{Methods: []string{"GET", "HEAD"}, Paths: []string{"/api/*", "/status"}}
+
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{"GET", "/api/items", true},
+		{"HEAD", "/api/", true},
+		{"GET", "/status", true},
+		{"GET", "/status/x", false},
+		{"GET", "/apis", false},
+		{"POST", "/api/items", false},
+	}
+
+	for _, tt := range tests {
+		if got := condition.matches(tt.method, tt.path); got != tt.want {
+			t.Errorf("%s %s: %t != %t", tt.method, tt.path, got, tt.want)
+		}
+	}
+
+	if empty := (HeaderCondition{}); !empty.matches("PUT", "/any") {
+		t.Error("an empty condition does not match")
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestHeaderApply(t *testing.T) {
+	value := func() string { return "new" }
+
+	tests := []struct {
+		line string
+		add  bool
+		want http.Header
+	}{
+		{"X-A: new", false, http.Header{"X-A": {"new"}, "X-B": {"b"}}},
+		{"X-A: new", true, http.Header{"X-A": {"a", "new"}, "X-B": {"b"}}},
+		{"X-A?: new", false, http.Header{"X-A": {"a"}, "X-B": {"b"}}},
+		{"X-C?: new", false, http.Header{"X-A": {"a"}, "X-B": {"b"}, "X-C": {"new"}}},
+		{"-X-A", false, http.Header{"X-B": {"b"}}},
+		{"X-A>X-B", false, http.Header{"X-B": {"b", "a"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			header := http.Header{"X-A": {"a"}, "X-B": {"b"}}
+			HeaderFromString(tt.line).apply(header, value, tt.add)
+			if !reflect.DeepEqual(header, tt.want) {
+				t.Errorf("%v, want %v", header, tt.want)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestExpandHeaderValue(t *testing.T) {
+	cfg := Configuration{}
+	cfg.Name = "svc"
+	cfg.Namespace = "ns"
+	ds := &Dispatcher{IConfiguration: &cfg}
+
+	r, _ := http.NewRequest(http.MethodPost, "http://example.com/ns/a?q=1", nil)
+	r.Header.Set("X-In", "in")
+
+	tests := []struct {
+		value string
+		r     *http.Request
+		want  string
+	}{
+		{"plain", r, "plain"},
+		{"{{name}}/{{namespace}}", r, "svc/ns"},
+		{"{{method}} {{path}} {{host}}", r, "POST /ns/a example.com"},
+		{"{{header.X-In}}-{{query.q}}", r, "in-1"},
+		{"{{foo}} {{ name }}", r, "{{foo}} svc"},
+		{"{{name}} {{method}}{{header.X-In}}", nil, "svc "},
+		{"{{foo}}{{query.q}}", nil, "{{foo}}"},
+	}
+
+	for _, tt := range tests {
+		if got := ds.expandHeaderValue(tt.value, tt.r); got != tt.want {
+			t.Errorf("'%s': '%s' != '%s'", tt.value, got, tt.want)
+		}
+	}
+}
@@ -12,25 +12,24 @@ type LimitedTcpListener struct {
 	id  int
 }
 
-func InitLimitedTcpListener(count int, l net.Listener) LimitedTcpListener {
+func InitLimitedTcpListener(count int, l net.Listener) *LimitedTcpListener {
 	sem := make(chan bool, count)
 	for i := 0; i < count; i++ {
 		sem <- true
 	}
 
-	return LimitedTcpListener{
+	return &LimitedTcpListener{
 		Listener: l,
-		Mutex:    sync.Mutex{},
 		sem:      sem,
 		id:       123,
 	}
 }
 
-func (l LimitedTcpListener) Addr() net.Addr { return l.Listener.Addr() }
+func (l *LimitedTcpListener) Addr() net.Addr { return l.Listener.Addr() }
 
-func (l LimitedTcpListener) Close() error { return l.Listener.Close() }
+func (l *LimitedTcpListener) Close() error { return l.Listener.Close() }
 
-func (l LimitedTcpListener) Accept() (net.Conn, error) {
+func (l *LimitedTcpListener) Accept() (net.Conn, error) {
 	<-l.sem
 	c, err := l.Listener.Accept()
 
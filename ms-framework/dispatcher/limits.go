@@ -0,0 +1,86 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher Request limits
+// ###########################################################################
+// ###########################################################################
+
+// routeLimits returns the body size limit and the timeout of requests to the
+// route of handlers, 0 if there is none
+func (ds *Dispatcher) routeLimits(handlers *HandlerGroup) (maxBodySize int64, timeout time.Duration) {
+	ds.ViewConfiguration(func() {
+		maxBodySize = int64(ds.GetMaxBodySize())
+		timeout = time.Duration(ds.GetRequestTimeout()) * time.Millisecond
+	})
+
+	if handlers.MaxBodySize != 0 {
+		maxBodySize = handlers.MaxBodySize
+	}
+	if handlers.Timeout != 0 {
+		timeout = handlers.Timeout
+	}
+
+	if maxBodySize < 0 {
+		maxBodySize = 0
+	}
+	if timeout < 0 {
+		timeout = 0
+	}
+	return maxBodySize, timeout
+}
+
+// ---------------------------------------------------------------------------
+
+// limitRequest applies the limits of the route of handlers to r. It returns
+// the request to pass to the handler and the function releasing its context.
+// Requests announcing a too large body fail with a 413 problem, larger
+// bodies fail while they are read.
+func (ds *Dispatcher) limitRequest(handlers *HandlerGroup, w http.ResponseWriter, r *http.Request) (*http.Request, context.CancelFunc, error) {
+	maxBodySize, timeout := ds.routeLimits(handlers)
+	cancel := func() {}
+
+	if maxBodySize > 0 {
+		if r.ContentLength > maxBodySize {
+			return r, cancel, bodyTooLarge(maxBodySize)
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	}
+
+	if timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(r.Context(), timeout)
+		r = r.WithContext(ctx)
+	}
+
+	return r, cancel, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// timedOut reports if the context of r was cancelled by the request timeout
+func timedOut(r *http.Request) bool {
+	return r.Context().Err() == context.DeadlineExceeded
+}
+
+// ---------------------------------------------------------------------------
+
+// bodyTooLarge is the problem of a body exceeding maxBodySize
+func bodyTooLarge(maxBodySize int64) *Problem {
+	return NewProblem(http.StatusRequestEntityTooLarge, fmt.Sprintf("The body must not exceed %d bytes.", maxBodySize))
+}
+
+// ---------------------------------------------------------------------------
+
+// isBodyTooLarge reports if err was returned reading a body limited by
+// http.MaxBytesReader
+func isBodyTooLarge(err error) bool {
+	return err != nil && err.Error() == "http: request body too large"
+}
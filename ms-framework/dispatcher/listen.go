@@ -0,0 +1,360 @@
+package dispatcher
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/netutil"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher Listeners
+// ###########################################################################
+// ###########################################################################
+
+// The service listens on host and port, or on the addresses configured with
+// listen:
+//
+//	http://[::1]:8080                                  plain TCP
+//	https://0.0.0.0:8443                               TLS with the certificate
+//	:8080                                              TLS if a certificate is set
+//	unix:///run/ms.sock?mode=0660&owner=app:app        unix domain socket
+//	unix:///run/ms.sock?tls=true                       TLS on a unix socket
+//	systemd://                                         all sockets passed by systemd
+//	systemd://web?tls=false                            the socket named 'web'
+//
+// Unix sockets are plain unless tls is set, systemd sockets use TLS if a
+// certificate is set, like addresses without a scheme.
+//
+// Sockets passed by systemd are the ones of socket activation (LISTEN_FDS),
+// named by FileDescriptorName= of the socket unit (LISTEN_FDNAMES).
+
+// listenAddress is a parsed listen address
+type listenAddress struct {
+	network string
+	address string
+	tls     bool
+	mode    os.FileMode
+	owner   string
+	group   string
+	systemd bool
+}
+
+// ---------------------------------------------------------------------------
+
+// String returns the address as it is logged
+func (la *listenAddress) String() string {
+	scheme := "http"
+	if la.tls {
+		scheme = "https"
+	}
+
+	switch {
+	case la.systemd:
+		if len(la.address) == 0 {
+			return fmt.Sprintf("%s (systemd sockets)", scheme)
+		}
+		return fmt.Sprintf("%s (systemd socket '%s')", scheme, la.address)
+	case la.network == "unix":
+		return fmt.Sprintf("%s+unix://%s", scheme, la.address)
+	}
+	return fmt.Sprintf("%s://%s", scheme, la.address)
+}
+
+// ---------------------------------------------------------------------------
+
+// listenAddresses parses the configured listen addresses, or returns host
+// and port if none are configured.
+func (ds *Dispatcher) listenAddresses() ([]*listenAddress, error) {
+	if len(ds.GetListen()) == 0 {
+		return []*listenAddress{{
+			network: "tcp",
+			address: net.JoinHostPort(ds.GetHost(), strconv.Itoa(ds.GetPort())),
+			tls:     ds.hasServerTLS(),
+		}}, nil
+	}
+
+	var addresses []*listenAddress
+	for _, raw := range ds.GetListen() {
+		la, err := ds.parseListenAddress(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen address '%s': %s", raw, err.Error())
+		}
+		addresses = append(addresses, la)
+	}
+	return addresses, nil
+}
+
+// ---------------------------------------------------------------------------
+
+func (ds *Dispatcher) parseListenAddress(raw string) (*listenAddress, error) {
+	la := &listenAddress{network: "tcp", tls: ds.hasServerTLS()}
+
+	if !strings.Contains(raw, "://") {
+		la.address = raw
+		return la, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+
+	switch u.Scheme {
+	case "http", "https":
+		if len(u.Host) == 0 {
+			return nil, errors.New("the port is missing")
+		}
+		la.address = u.Host
+		la.tls = u.Scheme == "https"
+	case "unix":
+		la.network = "unix"
+		la.address = u.Host + u.Path
+		la.tls = false
+		if len(la.address) == 0 {
+			return nil, errors.New("the path is missing")
+		}
+	case "systemd":
+		la.systemd = true
+		la.address = u.Host
+	default:
+		return nil, fmt.Errorf("unknown scheme '%s'", u.Scheme)
+	}
+
+	if v := query.Get("tls"); len(v) > 0 {
+		if la.tls, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("tls must be true or false")
+		}
+	}
+
+	if v := query.Get("mode"); len(v) > 0 {
+		mode, err := strconv.ParseUint(v, 8, 32)
+		if err != nil || la.network != "unix" {
+			return nil, fmt.Errorf("mode must be an octal file mode of a unix socket")
+		}
+		la.mode = os.FileMode(mode)
+	}
+
+	if v := query.Get("owner"); len(v) > 0 {
+		if la.network != "unix" {
+			return nil, fmt.Errorf("only unix sockets have an owner")
+		}
+		owner := strings.SplitN(v, ":", 2)
+		la.owner = owner[0]
+		if len(owner) > 1 {
+			la.group = owner[1]
+		}
+	}
+
+	if la.tls && !ds.hasServerTLS() {
+		return nil, errors.New("TLS requires a certificate and key")
+	}
+
+	return la, nil
+}
+
+// ###########################################################################
+
+// listen opens the listeners of la, several ones for all sockets passed by
+// systemd. The connection limit applies to each listener on its own, TLS is
+// layered above it.
+func (ds *Dispatcher) listen(la *listenAddress, tlsConfig *tls.Config) ([]net.Listener, error) {
+	var listeners []net.Listener
+
+	switch {
+	case la.systemd:
+		listeners = systemdListeners(la.address)
+		if len(listeners) == 0 {
+			return nil, fmt.Errorf("systemd passed no socket '%s'", la.address)
+		}
+	case la.network == "unix":
+		listener, err := listenUnix(la)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	default:
+		listener, err := net.Listen(la.network, la.address)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+
+	for i := range listeners {
+		if ds.GetMaxConnections() > 0 {
+			listeners[i] = netutil.LimitListener(listeners[i], ds.GetMaxConnections())
+		}
+		if la.tls {
+			listeners[i] = tls.NewListener(listeners[i], tlsConfig)
+		}
+	}
+
+	return listeners, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// listenUnix creates a unix domain socket, replacing a stale one, and sets
+// its mode and owner
+func listenUnix(la *listenAddress) (net.Listener, error) {
+	if fi, err := os.Stat(la.address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", la.address); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket '%s' is in use", la.address)
+		}
+		os.Remove(la.address)
+	}
+
+	listener, err := net.Listen("unix", la.address)
+	if err != nil {
+		return nil, err
+	}
+
+	if la.mode != 0 {
+		if err = os.Chmod(la.address, la.mode); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	if len(la.owner) > 0 || len(la.group) > 0 {
+		uid, gid, err := lookupOwner(la.owner, la.group)
+		if err == nil {
+			err = os.Chown(la.address, uid, gid)
+		}
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	return listener, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// lookupOwner resolves user and group names or ids, -1 keeps them unchanged
+func lookupOwner(owner string, group string) (uid int, gid int, err error) {
+	uid, gid = -1, -1
+
+	if len(owner) > 0 {
+		if uid, err = strconv.Atoi(owner); err != nil {
+			u, err := user.Lookup(owner)
+			if err != nil {
+				return -1, -1, err
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+
+	if len(group) > 0 {
+		if gid, err = strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return -1, -1, err
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+
+	return uid, gid, nil
+}
+
+// ###########################################################################
+
+// systemdFirstFD is the first file descriptor passed by systemd
+const systemdFirstFD = 3
+
+// systemdSocket is a socket passed by systemd
+type systemdSocket struct {
+	name     string
+	listener net.Listener
+}
+
+var systemdOnce sync.Once
+var systemdSockets []*systemdSocket
+
+// systemdListeners takes the sockets named name passed by systemd, or all of
+// them if name is empty. Each socket is returned once.
+func systemdListeners(name string) []net.Listener {
+	systemdOnce.Do(func() { systemdSockets = passedSockets() })
+
+	var listeners []net.Listener
+	for _, socket := range systemdSockets {
+		if socket.listener == nil || (len(name) > 0 && socket.name != name) {
+			continue
+		}
+		listeners = append(listeners, socket.listener)
+		socket.listener = nil
+	}
+	return listeners
+}
+
+// ---------------------------------------------------------------------------
+
+// passedSockets collects the sockets passed by systemd
+func passedSockets() []*systemdSocket {
+	return openSockets(systemdFirstFD, passedSocketNames())
+}
+
+// ---------------------------------------------------------------------------
+
+// passedSocketNames returns the names of the sockets passed by systemd,
+// 'unknown' for sockets without a name. They are only used if they were
+// passed to this process, not to its parent.
+func passedSocketNames() []string {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	var passed []string
+	for i := 0; i < count; i++ {
+		name := "unknown"
+		if i < len(names) && len(names[i]) > 0 {
+			name = names[i]
+		}
+		passed = append(passed, name)
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	return passed
+}
+
+// ---------------------------------------------------------------------------
+
+// openSockets creates a listener for each name on the file descriptors from
+// firstFD on. Descriptors which are no listening sockets are skipped.
+func openSockets(firstFD int, names []string) []*systemdSocket {
+	var sockets []*systemdSocket
+	for i, name := range names {
+		file := os.NewFile(uintptr(firstFD+i), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			continue
+		}
+		sockets = append(sockets, &systemdSocket{name: name, listener: listener})
+	}
+	return sockets
+}
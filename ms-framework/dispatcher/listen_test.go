@@ -0,0 +1,173 @@
+package dispatcher
+
+import (
+	"crypto/tls"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// setenv sets an environment variable for the test
+func setenv(t *testing.T, key string, value string) {
+	t.Helper()
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Unsetenv(key) })
+}
+
+// ###########################################################################
+
+func TestParseListenAddress(t *testing.T) {
+	tests := []struct {
+		raw  string
+		cert bool
+		want *listenAddress
+	}{
+		{":8080", false, &listenAddress{network: "tcp", address: ":8080"}},
+		{":8443", true, &listenAddress{network: "tcp", address: ":8443", tls: true}},
+		{"http://[::1]:8080", true, &listenAddress{network: "tcp", address: "[::1]:8080"}},
+		{"https://0.0.0.0:8443", true, &listenAddress{network: "tcp", address: "0.0.0.0:8443", tls: true}},
+		{"https://0.0.0.0:8443", false, nil},
+		{"http://:8080?tls=true", true, &listenAddress{network: "tcp", address: ":8080", tls: true}},
+		{"http://", false, nil},
+		{"http://:8080?tls=maybe", true, nil},
+		{"http://:8080?mode=0660", false, nil},
+		{"http://:8080?owner=app", false, nil},
+		{"unix:///run/ms.sock", true, &listenAddress{network: "unix", address: "/run/ms.sock"}},
+		{"unix://ms.sock", false, &listenAddress{network: "unix", address: "ms.sock"}},
+		{"unix:///run/ms.sock?mode=0660&owner=app:staff", false, &listenAddress{network: "unix", address: "/run/ms.sock", mode: 0660, owner: "app", group: "staff"}},
+		{"unix:///run/ms.sock?owner=1000", false, &listenAddress{network: "unix", address: "/run/ms.sock", owner: "1000"}},
+		{"unix:///run/ms.sock?owner=:staff", false, &listenAddress{network: "unix", address: "/run/ms.sock", group: "staff"}},
+		{"unix:///run/ms.sock?tls=true", true, &listenAddress{network: "unix", address: "/run/ms.sock", tls: true}},
+		{"unix:///run/ms.sock?tls=true", false, nil},
+		{"unix:///run/ms.sock?mode=rw", false, nil},
+		{"unix:///run/ms.sock?mode=0980", false, nil},
+		{"unix://", false, nil},
+		{"systemd://", false, &listenAddress{network: "tcp", systemd: true}},
+		{"systemd://", true, &listenAddress{network: "tcp", systemd: true, tls: true}},
+		{"systemd://web?tls=false", true, &listenAddress{network: "tcp", address: "web", systemd: true}},
+		{"ftp://host:21", false, nil},
+		{"http://%zz:8080", false, nil},
+	}
+
+	for _, tt := range tests {
+		ds := &Dispatcher{}
+		if tt.cert {
+			ds.tlsInfo = &TLSInfo{certificate: &tls.Certificate{}}
+		}
+
+		got, err := ds.parseListenAddress(tt.raw)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s (certificate %v): accepted as %+v", tt.raw, tt.cert, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s (certificate %v): %s", tt.raw, tt.cert, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s (certificate %v): %+v != %+v", tt.raw, tt.cert, got, tt.want)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestListenAddresses(t *testing.T) {
+	cfg := &Configuration{}
+	cfg.Host = "127.0.0.1"
+	cfg.Port = 8080
+	ds := &Dispatcher{IConfiguration: cfg}
+
+	addresses, err := ds.listenAddresses()
+	if err != nil || len(addresses) != 1 || addresses[0].String() != "http://127.0.0.1:8080" {
+		t.Errorf("host and port: %v, %v", addresses, err)
+	}
+
+	cfg.Listen = []string{"http://:8081", "unix:///run/ms.sock", "systemd://web"}
+	addresses, err = ds.listenAddresses()
+	if err != nil || len(addresses) != 3 {
+		t.Fatalf("listen: %v, %v", addresses, err)
+	}
+	for i, want := range []string{"http://:8081", "http+unix:///run/ms.sock", "http (systemd socket 'web')"} {
+		if got := addresses[i].String(); got != want {
+			t.Errorf("%s: '%s' != '%s'", cfg.Listen[i], got, want)
+		}
+	}
+
+	cfg.Listen = []string{"http://:8081", "https://:8443"}
+	if _, err := ds.listenAddresses(); err == nil {
+		t.Error("TLS without certificate was accepted")
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestLookupOwner(t *testing.T) {
+	tests := []struct {
+		owner string
+		group string
+		uid   int
+		gid   int
+		err   bool
+	}{
+		{"", "", -1, -1, false},
+		{"1000", "", 1000, -1, false},
+		{"", "1000", -1, 1000, false},
+		{"0", "0", 0, 0, false},
+		{"no-such-user-of-the-test", "", -1, -1, true},
+		{"", "no-such-group-of-the-test", -1, -1, true},
+	}
+
+	for _, tt := range tests {
+		uid, gid, err := lookupOwner(tt.owner, tt.group)
+		if (err != nil) != tt.err || uid != tt.uid || gid != tt.gid {
+			t.Errorf("'%s:%s': %d:%d, %v", tt.owner, tt.group, uid, gid, err)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestPassedSocketNames(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+
+	tests := []struct {
+		name  string
+		pid   string
+		fds   string
+		names string
+		want  []string
+	}{
+		{"named", pid, "2", "web:admin", []string{"web", "admin"}},
+		{"unnamed", pid, "3", "web::", []string{"web", "unknown", "unknown"}},
+		{"without names", pid, "1", "", []string{"unknown"}},
+		{"no sockets", pid, "0", "", nil},
+		{"invalid count", pid, "two", "web:admin", nil},
+		{"parent", strconv.Itoa(os.Getpid() + 1), "2", "web:admin", nil},
+		{"no pid", "", "2", "web:admin", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setenv(t, "LISTEN_PID", tt.pid)
+			setenv(t, "LISTEN_FDS", tt.fds)
+			setenv(t, "LISTEN_FDNAMES", tt.names)
+
+			got := passedSocketNames()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%v != %v", got, tt.want)
+			}
+
+			// Children of the service must not take the sockets
+			_, exists := os.LookupEnv("LISTEN_FDS")
+			if consumed := tt.want != nil || tt.fds == "0"; exists == consumed {
+				t.Errorf("LISTEN_FDS is set: %v", exists)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// +build !windows
+
+package dispatcher
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// passedFD returns a descriptor of listener like systemd passes it, it is
+// closed by openSockets
+func passedFD(t *testing.T, listener net.Listener) int {
+	t.Helper()
+	file, err := listener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	fd, err := syscall.Dup(int(file.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd
+}
+
+// ###########################################################################
+
+func TestOpenSockets(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sockets := openSockets(passedFD(t, listener), []string{"web"})
+	if len(sockets) != 1 || sockets[0].name != "web" {
+		t.Fatalf("sockets: %v", sockets)
+	}
+	defer sockets[0].listener.Close()
+	if got := sockets[0].listener.Addr().String(); got != listener.Addr().String() {
+		t.Errorf("address: %s != %s", got, listener.Addr().String())
+	}
+
+	// A descriptor which is no socket is skipped
+	file, err := ioutil.TempFile(t.TempDir(), "fd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	fd, err := syscall.Dup(int(file.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sockets := openSockets(fd, []string{"file"}); len(sockets) != 0 {
+		t.Errorf("file was taken as socket: %v", sockets)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestSystemdListeners(t *testing.T) {
+	systemdOnce.Do(func() {})
+	defer func() { systemdSockets = nil }()
+
+	var listeners []net.Listener
+	for i := 0; i < 3; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		listeners = append(listeners, listener)
+	}
+	systemdSockets = []*systemdSocket{
+		{name: "web", listener: listeners[0]},
+		{name: "admin", listener: listeners[1]},
+		{name: "web", listener: listeners[2]},
+	}
+
+	if got := systemdListeners("web"); len(got) != 2 || got[0] != listeners[0] || got[1] != listeners[2] {
+		t.Errorf("web: %v", got)
+	}
+	if got := systemdListeners("web"); len(got) != 0 {
+		t.Errorf("web was taken twice: %v", got)
+	}
+	if got := systemdListeners("grpc"); len(got) != 0 {
+		t.Errorf("grpc: %v", got)
+	}
+	if got := systemdListeners(""); len(got) != 1 || got[0] != listeners[1] {
+		t.Errorf("all: %v", got)
+	}
+
+	ds := &Dispatcher{IConfiguration: &Configuration{}}
+	if _, err := ds.listen(&listenAddress{network: "tcp", address: "web", systemd: true}, nil); err == nil {
+		t.Error("listened without passed socket")
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestListenUnix(t *testing.T) {
+	address := filepath.Join(t.TempDir(), "ms.sock")
+	la := &listenAddress{network: "unix", address: address, mode: 0600}
+
+	listener, err := listenUnix(la)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(address)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0600 {
+		t.Errorf("socket: %v, %v", fi, err)
+	}
+
+	if _, err := listenUnix(la); err == nil {
+		t.Error("socket in use was replaced")
+	}
+
+	// A stale socket is replaced
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	if _, err := os.Stat(address); err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	listener, err = listenUnix(la)
+	if err != nil {
+		t.Fatalf("stale socket was not replaced: %s", err.Error())
+	}
+	listener.Close()
+
+	la.owner = "no-such-user-of-the-test"
+	if _, err := listenUnix(la); err == nil {
+		t.Error("unknown owner was accepted")
+	}
+}
@@ -2,6 +2,9 @@ package dispatcher
 
 import (
 	"io"
+	"os"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/secret"
 )
 
 type logFlushWriter struct {
@@ -21,3 +24,20 @@ func (m *logFlushWriter) Write(p []byte) (n int, err error) {
 	}
 	return
 }
+
+// openLogfile opens the writer for a logfile setting. The closer is nil for
+// stdout and stderr.
+func openLogfile(logfile string) (io.Writer, io.Closer, error) {
+	switch logfile {
+	case "", "-", ":stdout":
+		return secret.NewWriter(os.Stdout), nil, nil
+	case ":stderr":
+		return secret.NewWriter(os.Stderr), nil, nil
+	}
+
+	file, err := os.OpenFile(logfile, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, nil, err
+	}
+	return secret.NewWriter(&logFlushWriter{Writer: file}), file, nil
+}
@@ -0,0 +1,212 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/validate"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher Problems
+// ###########################################################################
+// ###########################################################################
+
+// ProblemContentType is the content type of problem replies
+const ProblemContentType = "application/problem+json"
+
+// Problem is an error reply as described by RFC 7807. It is an error, so
+// handlers may return it, see HandleErrors. Name, Hostname and Version
+// identify the service like they do in Response.
+type Problem struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	Name          string               `json:"name,omitempty"`
+	Hostname      string               `json:"hostname,omitempty"`
+	Version       string               `json:"version,omitempty"`
+	CorrelationID string               `json:"correlationid,omitempty"`
+	RequestID     string               `json:"requestid,omitempty"`
+	Errors        validate.FieldErrors `json:"errors,omitempty"`
+
+	cause error
+}
+
+// ErrorHandler is a handler which returns its errors instead of replying
+// them
+type ErrorHandler func(http.ResponseWriter, *http.Request) error
+
+// ###########################################################################
+
+// NewProblem creates a problem with the standard title of status
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// BadRequest ...
+func BadRequest(format string, args ...interface{}) *Problem {
+	return NewProblem(http.StatusBadRequest, fmt.Sprintf(format, args...))
+}
+
+// Unauthorized ...
+func Unauthorized(format string, args ...interface{}) *Problem {
+	return NewProblem(http.StatusUnauthorized, fmt.Sprintf(format, args...))
+}
+
+// Forbidden ...
+func Forbidden(format string, args ...interface{}) *Problem {
+	return NewProblem(http.StatusForbidden, fmt.Sprintf(format, args...))
+}
+
+// NotFound ...
+func NotFound(format string, args ...interface{}) *Problem {
+	return NewProblem(http.StatusNotFound, fmt.Sprintf(format, args...))
+}
+
+// Conflict ...
+func Conflict(format string, args ...interface{}) *Problem {
+	return NewProblem(http.StatusConflict, fmt.Sprintf(format, args...))
+}
+
+// Internal wraps an unexpected error. Its message is logged, but not sent.
+func Internal(err error) *Problem {
+	p := NewProblem(http.StatusInternalServerError, "")
+	p.cause = err
+	return p
+}
+
+// ---------------------------------------------------------------------------
+
+// WithType sets the URI identifying the kind of problem
+func (p *Problem) WithType(uri string) *Problem {
+	p.Type = uri
+	return p
+}
+
+// ---------------------------------------------------------------------------
+
+// WithCause records the error which caused the problem
+func (p *Problem) WithCause(err error) *Problem {
+	p.cause = err
+	return p
+}
+
+// ---------------------------------------------------------------------------
+
+// Error ...
+func (p *Problem) Error() string {
+	msg := p.Title
+	if len(p.Detail) > 0 {
+		msg = fmt.Sprintf("%s: %s", msg, p.Detail)
+	}
+	if p.cause != nil {
+		msg = fmt.Sprintf("%s (%s)", msg, p.cause.Error())
+	}
+	return msg
+}
+
+// Unwrap ...
+func (p *Problem) Unwrap() error { return p.cause }
+
+// ###########################################################################
+
+// ProblemFromError maps err to a problem:
+//
+//	*Problem                   as it is
+//	validate.FieldErrors       400, with the field errors
+//	context.DeadlineExceeded   504
+//	context.Canceled           503
+//	anything else              500, without details
+func ProblemFromError(err error) *Problem {
+	var problem *Problem
+	var fieldErrors validate.FieldErrors
+	var fieldError validate.FieldError
+
+	switch {
+	case errors.As(err, &problem):
+		dup := *problem
+		return &dup
+	case errors.As(err, &fieldErrors):
+		p := BadRequest("The request is invalid.")
+		p.Errors = fieldErrors
+		return p.WithCause(err)
+	case errors.As(err, &fieldError):
+		p := BadRequest("The request is invalid.")
+		p.Errors = validate.FieldErrors{fieldError}
+		return p.WithCause(err)
+	case isBodyTooLarge(err):
+		return NewProblem(http.StatusRequestEntityTooLarge, "").WithCause(err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return NewProblem(http.StatusGatewayTimeout, "").WithCause(err)
+	case errors.Is(err, context.Canceled):
+		return NewProblem(http.StatusServiceUnavailable, "").WithCause(err)
+	}
+
+	return Internal(err)
+}
+
+// ---------------------------------------------------------------------------
+
+// HandleErrors adapts fn to an HTTPHandler. Errors returned by fn are
+// replied as problems, see ReplyProblem.
+func (ds *Dispatcher) HandleErrors(fn ErrorHandler) HTTPHandler {
+	return func(w http.ResponseWriter, r *http.Request) (int, int, string) {
+		err := fn(w, r)
+		if err != nil {
+			return ds.ReplyProblem(w, r, err)
+		}
+
+		if rw, ok := w.(*responseWriter); ok {
+			status := rw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			return status, rw.bytes, http.StatusText(status)
+		}
+		return http.StatusOK, 0, http.StatusText(http.StatusOK)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// ReplyProblem replies err as application/problem+json and counts it. The
+// results are those of an HTTPHandler, msg is the full error for the log.
+func (ds *Dispatcher) ReplyProblem(w http.ResponseWriter, r *http.Request, err error) (status int, contentLen int, msg string) {
+	p := ProblemFromError(err)
+
+	p.Name = ds.GetName()
+	p.Hostname = ds.GetHostname()
+	p.Version = ds.GetVersion()
+
+	if r != nil {
+		ids := requestIDs(r)
+		p.CorrelationID = ids.CorrelationID
+		p.RequestID = ids.RequestID
+		if len(p.Instance) == 0 {
+			p.Instance = r.URL.Path
+		}
+	}
+
+	ds.prometheusProblems.WithLabelValues(strconv.Itoa(p.Status), p.Type).Inc()
+
+	msgBytes, merr := json.MarshalIndent(p, "", "  ")
+	if merr != nil {
+		msgBytes = []byte(fmt.Sprintf(`{"title": %q, "status": %d}`, p.Title, p.Status))
+	}
+
+	ds.SetResponseHeaders(ProblemContentType, w, r)
+	w.Header().Del("Content-Length")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	w.Write(msgBytes)
+
+	return p.Status, len(msgBytes), p.Error()
+}
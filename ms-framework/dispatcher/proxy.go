@@ -0,0 +1,358 @@
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher Reverse Proxy
+// ###########################################################################
+// ###########################################################################
+
+// A proxy route forwards the requests below a prefix to an upstream. The
+// namespace and the prefix are replaced by the upstream URL:
+//
+//	/devices/=http://devices:8080/devices/   /ns/devices/a -> /devices/a
+//	/api/=service://thermometer/             /ns/api/a     -> <endpoint>/a
+//
+// Upstreams with the scheme 'service' are resolved by the transport of
+// HTTPClient, see package balancer. Their endpoints include the namespace
+// of the service. Bodies are streamed in both directions and WebSocket
+// upgrades are passed through.
+//
+// Outgoing requests get the request header rules like SetRequestHeaders
+// and X-Forwarded-For, -Host, -Proto and -Prefix, which replace the ones
+// of the caller, as any client could send them. Replies get the response
+// header rules, headers set by the dispatcher replace the ones of the
+// upstream. The trace of JSON replies is merged into the trace of the
+// dispatcher, so the reply shows the way it took.
+
+// ProxyRoute is a prefix forwarded to an upstream
+type ProxyRoute struct {
+	Prefix   string
+	Upstream *url.URL
+}
+
+// ---------------------------------------------------------------------------
+
+// ProxyRouteFromString parses routes like '/prefix/=http://host:port/path'
+func ProxyRouteFromString(line string) (*ProxyRoute, error) {
+	pairs := strings.SplitN(strings.TrimSpace(line), "=", 2)
+	if len(pairs) != 2 || !strings.HasPrefix(pairs[0], "/") {
+		return nil, fmt.Errorf("proxy route '%s' is not like '/prefix/=http://host:port/path'", line)
+	}
+
+	upstream, err := url.Parse(strings.TrimSpace(pairs[1]))
+	if err != nil {
+		return nil, err
+	}
+	if len(upstream.Scheme) == 0 || len(upstream.Host) == 0 {
+		return nil, fmt.Errorf("upstream '%s' of proxy route '%s' is not an absolute URL", pairs[1], line)
+	}
+
+	return &ProxyRoute{Prefix: strings.TrimSpace(pairs[0]), Upstream: upstream}, nil
+}
+
+// ###########################################################################
+
+// HandleProxy adapts route to an HTTPHandler forwarding the requests.
+// Requests to upstreams which can not be reached are answered with 502,
+// timed out ones with 504. The request timeout is applied here, except for
+// WebSocket upgrades and event streams, so the route itself should have no
+// timeout, see AddProxyHandler.
+func (ds *Dispatcher) HandleProxy(route *ProxyRoute) HTTPHandler {
+	prefix := route.Prefix
+	if len(ds.GetNamespace()) > 0 {
+		prefix = fmt.Sprintf("/%s%s", ds.GetNamespace(), prefix)
+	}
+	upstream := route.Upstream.String()
+
+	return func(w http.ResponseWriter, r *http.Request) (int, int, string) {
+		var proxyErr error
+
+		if !isStreamRequest(r) {
+			var timeout int
+			ds.ViewConfiguration(func() { timeout = ds.GetRequestTimeout() })
+			if timeout > 0 {
+				ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Millisecond)
+				defer cancel()
+				r = r.WithContext(ctx)
+			}
+		}
+
+		transport := ds.HTTPClient.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+
+		proxy := &httputil.ReverseProxy{
+			Transport:     transport,
+			FlushInterval: 100 * time.Millisecond,
+			ErrorLog:      ds.GetLogger(),
+			Director: func(out *http.Request) {
+				out.URL = proxyURL(route.Upstream, strings.TrimPrefix(r.URL.Path, prefix), r.URL.RawQuery)
+				out.Host = ""
+
+				// Compressed replies are decoded by the transport, so their
+				// traces can be merged. The dispatcher compresses them again.
+				out.Header.Del("Accept-Encoding")
+
+				setForwardedHeaders(out, r, strings.TrimSuffix(prefix, "/"))
+				ds.SetRequestHeaders("", out, r)
+			},
+			ModifyResponse: func(response *http.Response) error {
+				ds.SetResponseHeaders("", headerWriter(response.Header), r)
+				for key := range w.Header() {
+					response.Header.Del(key)
+				}
+				return ds.mergeTrace(response)
+			},
+			ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+				proxyErr = err
+				status := http.StatusBadGateway
+				if errors.Is(err, context.DeadlineExceeded) {
+					status = http.StatusGatewayTimeout
+				}
+				ds.ReplyProblem(w, r, NewProblem(status, fmt.Sprintf("The upstream '%s' did not reply.", upstream)).WithCause(err))
+			},
+		}
+
+		proxy.ServeHTTP(w, r)
+
+		status, contentLen := http.StatusOK, 0
+		if rw, ok := w.(*responseWriter); ok {
+			status, contentLen = rw.status, rw.bytes
+		}
+		// Upgraded connections are hijacked without a status
+		if status == 0 {
+			status = http.StatusSwitchingProtocols
+		}
+		ds.prometheusProxyRequests.WithLabelValues(route.Prefix, fmt.Sprintf("%d", status)).Inc()
+
+		if proxyErr != nil {
+			return status, contentLen, fmt.Sprintf("Forwarding to '%s' failed: %s", upstream, proxyErr.Error())
+		}
+		return status, contentLen, fmt.Sprintf("Forwarded to '%s'.", upstream)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// AddProxyHandler forwards all requests below route.Prefix, which should end
+// with '/'. The body limit applies like to other routes, the request timeout
+// to all requests but WebSocket upgrades and event streams, which would be
+// cut off otherwise.
+func (ds *Dispatcher) AddProxyHandler(route *ProxyRoute) {
+	handler := ds.HandleProxy(route)
+	ds.AddHandler(route.Prefix, &HandlerGroup{
+		Get:     handler,
+		Put:     handler,
+		Post:    handler,
+		Delete:  handler,
+		Head:    handler,
+		Connect: handler,
+		Options: handler,
+		Any:     handler,
+		Timeout: -1,
+	})
+}
+
+// ---------------------------------------------------------------------------
+
+// addConfiguredProxies adds the routes of the proxy configuration
+func (ds *Dispatcher) addConfiguredProxies() {
+	for _, line := range ds.GetProxy() {
+		route, err := ProxyRouteFromString(line)
+		if err != nil {
+			ds.GetLogger().Fatal(fmt.Sprintf("Could not add proxy route, error was '%s'!", err.Error()))
+		}
+		ds.AddProxyHandler(route)
+		ds.GetLogger().Println(fmt.Sprintf("Forwarding '%s' to '%s'.", route.Prefix, route.Upstream.String()))
+	}
+}
+
+// ###########################################################################
+
+// mergeTrace nests the trace of a JSON reply into the trace of the
+// dispatcher. Other replies, replies without body or trace, and ones larger
+// than maxbodysize, are passed as they are.
+func (ds *Dispatcher) mergeTrace(response *http.Response) error {
+	if !hasResponseBody(response) {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if mediaType != "application/json" || len(response.Header.Get("Content-Encoding")) > 0 {
+		return nil
+	}
+
+	var limit int
+	ds.ViewConfiguration(func() { limit = ds.GetMaxBodySize() })
+
+	var body []byte
+	var err error
+	if limit > 0 {
+		body, err = ioutil.ReadAll(io.LimitReader(response.Body, int64(limit)+1))
+	} else {
+		body, err = ioutil.ReadAll(response.Body)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Too large to merge, pass on what was read and the rest
+	if limit > 0 && len(body) > limit {
+		response.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), response.Body), response.Body}
+		return nil
+	}
+	response.Body.Close()
+
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var fields map[string]json.RawMessage
+	var upstream Trace
+	if json.Unmarshal(body, &fields) != nil || len(fields["trace"]) == 0 || json.Unmarshal(fields["trace"], &upstream) != nil {
+		return nil
+	}
+
+	var trace Trace
+	InitTraceFromDispatcher(&trace, ds, response.StatusCode, fmt.Sprintf("%d - %s", response.StatusCode, http.StatusText(response.StatusCode)))
+	trace.Traces = []Trace{upstream}
+
+	merged, err := json.Marshal(trace)
+	if err != nil {
+		return nil
+	}
+	body, ok := replaceField(body, "trace", merged)
+	if !ok {
+		return nil
+	}
+
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	response.ContentLength = int64(len(body))
+	response.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+// hasResponseBody reports if a reply may have a body, which replies to HEAD
+// requests and with the status 1xx, 204 or 304 have not
+func hasResponseBody(response *http.Response) bool {
+	if response.Request != nil && response.Request.Method == http.MethodHead {
+		return false
+	}
+	status := response.StatusCode
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// ---------------------------------------------------------------------------
+
+// replaceField replaces the value of a field of the JSON object in body.
+// The other fields keep their order and formatting.
+func replaceField(body []byte, name string, value []byte) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, false
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, false
+		}
+		start := int(decoder.InputOffset())
+
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, false
+		}
+		end := int(decoder.InputOffset())
+
+		if key, _ := token.(string); key != name {
+			continue
+		}
+
+		// The value follows the colon after the key
+		start += bytes.IndexByte(body[start:end], ':') + 1
+
+		result := make([]byte, 0, len(body)-(end-start)+len(value))
+		result = append(result, body[:start]...)
+		result = append(result, value...)
+		return append(result, body[end:]...), true
+	}
+	return nil, false
+}
+
+// ---------------------------------------------------------------------------
+
+// proxyURL returns the upstream URL of path below the prefix
+func proxyURL(upstream *url.URL, path string, query string) *url.URL {
+	target := *upstream
+	if len(path) > 0 {
+		target.Path = fmt.Sprintf("%s/%s", strings.TrimSuffix(upstream.Path, "/"), strings.TrimPrefix(path, "/"))
+	}
+	target.RawPath = ""
+	if len(upstream.RawQuery) == 0 {
+		target.RawQuery = query
+	} else if len(query) > 0 {
+		target.RawQuery = fmt.Sprintf("%s&%s", upstream.RawQuery, query)
+	}
+	return &target
+}
+
+// ---------------------------------------------------------------------------
+
+// setForwardedHeaders tells the upstream where the request came from. The
+// headers sent by the caller are replaced, X-Forwarded-For is set to the
+// address of the caller by the reverse proxy itself.
+func setForwardedHeaders(out *http.Request, in *http.Request, prefix string) {
+	proto := "http"
+	if in.TLS != nil {
+		proto = "https"
+	}
+
+	out.Header.Del("X-Forwarded-For")
+	out.Header.Set("X-Forwarded-Host", in.Host)
+	out.Header.Set("X-Forwarded-Proto", proto)
+	out.Header.Set("X-Forwarded-Prefix", prefix)
+}
+
+// ---------------------------------------------------------------------------
+
+// isStreamRequest reports if r asks for a WebSocket upgrade or an event
+// stream, which stay open as long as the client wants
+func isStreamRequest(r *http.Request) bool {
+	return len(r.Header.Get("Upgrade")) > 0 || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// ---------------------------------------------------------------------------
+
+// headerWriter applies the response header rules to the header of an
+// upstream reply
+type headerWriter http.Header
+
+// Header ...
+func (h headerWriter) Header() http.Header { return http.Header(h) }
+
+// Write ...
+func (h headerWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+// WriteHeader ...
+func (h headerWriter) WriteHeader(int) {}
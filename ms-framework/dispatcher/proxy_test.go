@@ -0,0 +1,199 @@
+package dispatcher_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher/dispatchertest"
+)
+
+const upstreamJSON = `{"b":1,"trace":{"name":"up","version":"1","hostname":"h","code":200,"status":"OK"},"a":2}`
+
+// upstream records the last request it got and replies by path
+type upstream struct {
+	*httptest.Server
+	last *http.Request
+}
+
+func newUpstream(t *testing.T) *upstream {
+	u := &upstream{}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.last = r
+		switch strings.TrimPrefix(r.URL.Path, "/base") {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(upstreamJSON)))
+			w.Write([]byte(upstreamJSON))
+		case "/notrace":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"b":1, "a":2}`))
+		case "/empty":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNoContent)
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	t.Cleanup(u.Close)
+	return u
+}
+
+// newProxy forwards /gw/api/ to target
+func newProxy(t *testing.T, target string) *dispatchertest.Server {
+	cfg := dispatcher.Configuration{}
+	cfg.Namespace = "gw"
+	cfg.RequestTimeout = 100
+	s := dispatchertest.New(t, &cfg, nil)
+
+	route, err := dispatcher.ProxyRouteFromString("/api/=" + target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Dispatcher.AddProxyHandler(route)
+	return s
+}
+
+// ###########################################################################
+
+func TestProxyURL(t *testing.T) {
+	u := newUpstream(t)
+
+	tests := []struct {
+		target string
+		path   string
+		want   string
+	}{
+		{u.URL + "/base/", "/gw/api/a/b?x=1", "/base/a/b?x=1"},
+		{u.URL + "/base", "/gw/api/a", "/base/a"},
+		{u.URL + "/base/?k=v", "/gw/api/a?x=1", "/base/a?k=v&x=1"},
+		{u.URL + "/base/?k=v", "/gw/api/a", "/base/a?k=v"},
+		{u.URL + "/", "/gw/api/", "/"},
+	}
+
+	for _, tt := range tests {
+		s := newProxy(t, tt.target)
+		s.Get(tt.path).AssertStatus(http.StatusOK)
+		if u.last == nil || u.last.URL.RequestURI() != tt.want {
+			t.Errorf("%s %s: upstream got '%v', want '%s'", tt.target, tt.path, u.last.URL, tt.want)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestProxyForwardedHeaders(t *testing.T) {
+	u := newUpstream(t)
+	s := newProxy(t, u.URL+"/base/")
+
+	s.Get("/gw/api/a",
+		"X-Forwarded-For", "203.0.113.9",
+		"X-Forwarded-Host", "evil.example",
+		"X-Forwarded-Proto", "https",
+		"X-Forwarded-Prefix", "/evil",
+	).AssertStatus(http.StatusOK)
+
+	want := map[string]string{
+		"X-Forwarded-For":    "192.0.2.1",
+		"X-Forwarded-Host":   "example.com",
+		"X-Forwarded-Proto":  "http",
+		"X-Forwarded-Prefix": "/gw/api",
+	}
+	for key, value := range want {
+		if got := u.last.Header.Values(key); len(got) != 1 || got[0] != value {
+			t.Errorf("%s: %v != '%s'", key, got, value)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestProxyTrace(t *testing.T) {
+	u := newUpstream(t)
+	s := newProxy(t, u.URL+"/base/")
+
+	result := s.Get("/gw/api/json").AssertStatus(http.StatusOK)
+	body := string(result.Body)
+	if !strings.HasPrefix(body, `{"b":1,"trace":{`) || !strings.HasSuffix(body, `,"a":2}`) {
+		t.Errorf("fields were reordered: %s", body)
+	}
+	result.AssertHeader("Content-Length", fmt.Sprintf("%d", len(body)))
+
+	var reply struct {
+		Trace dispatcher.Trace `json:"trace"`
+	}
+	result.Decode(&reply)
+	if reply.Trace.Name != s.Dispatcher.GetName() || len(reply.Trace.Traces) != 1 || reply.Trace.Traces[0].Name != "up" {
+		t.Errorf("trace was not merged: %+v", reply.Trace)
+	}
+
+	s.Get("/gw/api/notrace").AssertStatus(http.StatusOK).AssertBody(`{"b":1, "a":2}`)
+	s.Get("/gw/api/empty").AssertStatus(http.StatusNoContent).AssertBody("")
+}
+
+// ---------------------------------------------------------------------------
+
+func TestProxyHead(t *testing.T) {
+	u := newUpstream(t)
+	s := newProxy(t, u.URL+"/base/")
+
+	s.Do(s.NewRequest(http.MethodHead, "/gw/api/json", nil)).
+		AssertStatus(http.StatusOK).
+		AssertHeader("Content-Length", fmt.Sprintf("%d", len(upstreamJSON))).
+		AssertBody("")
+
+	// The upstream still got the request
+	if u.last == nil || u.last.Method != http.MethodHead {
+		t.Errorf("upstream got %v", u.last)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestProxyErrors(t *testing.T) {
+	u := newUpstream(t)
+	s := newProxy(t, u.URL+"/base/")
+
+	problem := s.Get("/gw/api/slow").AssertStatus(http.StatusGatewayTimeout).Problem()
+	if !strings.Contains(problem.Detail, u.URL) {
+		t.Errorf("detail: '%s'", problem.Detail)
+	}
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	s = newProxy(t, closed.URL+"/")
+	s.Get("/gw/api/a").AssertStatus(http.StatusBadGateway)
+	s.AssertMetric("proxy_requests_total", 1, "status", "502")
+	s.AssertLog("Forwarding to '" + closed.URL + "/' failed")
+}
+
+// ---------------------------------------------------------------------------
+
+// The merged reply is valid JSON whatever the upstream formatting was
+func TestProxyTraceFormatting(t *testing.T) {
+	u := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte("{\n  \"trace\" :\t{\"name\": \"up\"},\n  \"x\": \"trace\"\n}\n"))
+	}))
+	defer u.Close()
+	s := newProxy(t, u.URL+"/")
+
+	body := s.Get("/gw/api/a").AssertStatus(http.StatusOK).Body
+	var reply map[string]json.RawMessage
+	if err := json.Unmarshal(body, &reply); err != nil || string(reply["x"]) != `"trace"` {
+		t.Errorf("reply: %s (%v)", body, err)
+	}
+	if !strings.HasPrefix(string(body), "{\n  \"trace\" :{") {
+		t.Errorf("formatting was changed: %s", body)
+	}
+}
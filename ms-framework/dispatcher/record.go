@@ -0,0 +1,200 @@
+package dispatcher
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/recorder"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher Recording
+// ###########################################################################
+// ###########################################################################
+
+// Requests to the routes in recordroutes are recorded with their replies
+// to the file in record, see package recorder. Bodies are recorded as the
+// handlers read and write them, without compression, up to recordmaxbody
+// bytes. Credentials in the headers of recordredact, the query parameters
+// of recordredactquery and all registered secrets are redacted.
+
+// ---------------------------------------------------------------------------
+
+// openRecording opens the recording file, if one is configured
+func (ds *Dispatcher) openRecording() error {
+	if len(ds.GetRecord()) == 0 {
+		return nil
+	}
+
+	w, err := recorder.Create(ds.GetRecord(), ds.GetRecordFormat())
+	if err != nil {
+		return err
+	}
+	ds.recording = w
+	ds.GetLogger().Println(fmt.Sprintf("Recording requests to '%s' (%s).", ds.GetRecord(), ds.GetRecordFormat()))
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+// closeRecording completes the recording file
+func (ds *Dispatcher) closeRecording() {
+	if ds.recording == nil {
+		return
+	}
+	if err := ds.recording.Close(); err != nil {
+		ds.GetLogger().Println(fmt.Sprintf("Could not close recording '%s', error was '%s'!", ds.GetRecord(), err.Error()))
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// recordHandler records the requests to the configured routes
+func (ds *Dispatcher) recordHandler(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ds.recording == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		var routes, redact, redactQuery []string
+		var maxBody int
+		ds.ViewConfiguration(func() {
+			routes = ds.GetRecordRoutes()
+			redact = ds.GetRecordRedact()
+			redactQuery = ds.GetRecordRedactQuery()
+			maxBody = ds.GetRecordMaxBody()
+		})
+
+		method, path := ds.headerRoute(r)
+		if !(&HeaderCondition{Paths: routes}).matches(method, path) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+
+		entry := &recorder.Entry{
+			Started: time.Now().UTC(),
+			Request: recorder.Request{
+				Method: r.Method,
+				URL:    fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.RequestURI()),
+				Header: r.Header.Clone(),
+			},
+		}
+
+		body := &recordedBody{limit: maxBody}
+		if r.Body != nil && r.Body != http.NoBody {
+			body.ReadCloser = r.Body
+			r.Body = body
+		}
+
+		rw := &recordWriter{ResponseWriter: w, limit: maxBody}
+		h.ServeHTTP(rw, r)
+
+		entry.Duration = float64(time.Since(entry.Started).Microseconds()) / 1000
+		entry.Request.SetBody(body.data, body.truncated)
+
+		rw.snapshot(http.StatusOK)
+		entry.Response.Status = rw.status
+		entry.Response.Header = rw.header
+		entry.Response.SetBody(rw.data, rw.truncated)
+
+		entry.Redact(redact, redactQuery)
+		if err := ds.recording.Write(entry); err != nil && !errors.Is(err, os.ErrClosed) {
+			ds.GetLogger().Println(fmt.Sprintf("Could not record '%s %s', error was '%s'!", r.Method, r.URL.Path, err.Error()))
+		}
+	}
+}
+
+// ###########################################################################
+
+// recordedBody keeps the start of a request body as it is read
+type recordedBody struct {
+	io.ReadCloser
+	limit     int
+	data      []byte
+	truncated bool
+}
+
+func (b *recordedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.data, b.truncated = appendLimited(b.data, p[:n], b.limit, b.truncated)
+	return n, err
+}
+
+// ---------------------------------------------------------------------------
+
+// recordWriter keeps the status, header and the start of a reply
+type recordWriter struct {
+	http.ResponseWriter
+	limit     int
+	status    int
+	header    http.Header
+	data      []byte
+	truncated bool
+}
+
+// snapshot keeps the status and header when the reply starts
+func (rw *recordWriter) snapshot(status int) {
+	if rw.header == nil {
+		rw.status = status
+		rw.header = rw.Header().Clone()
+	}
+}
+
+func (rw *recordWriter) WriteHeader(status int) {
+	rw.snapshot(status)
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordWriter) Write(p []byte) (int, error) {
+	rw.snapshot(http.StatusOK)
+	rw.data, rw.truncated = appendLimited(rw.data, p, rw.limit, rw.truncated)
+	return rw.ResponseWriter.Write(p)
+}
+
+// Flush passes streamed replies on
+func (rw *recordWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands the connection to the caller, the reply is recorded as
+// switching protocols
+func (rw *recordWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection can not be hijacked")
+	}
+	rw.snapshot(http.StatusSwitchingProtocols)
+	return hijacker.Hijack()
+}
+
+// ---------------------------------------------------------------------------
+
+// appendLimited appends p to data up to limit bytes, and tells if data is
+// truncated
+func appendLimited(data []byte, p []byte, limit int, truncated bool) ([]byte, bool) {
+	if len(p) == 0 {
+		return data, truncated
+	}
+	if free := limit - len(data); free < len(p) {
+		if free > 0 {
+			data = append(data, p[:free]...)
+		}
+		return data, true
+	}
+	return append(data, p...), truncated
+}
@@ -0,0 +1,43 @@
+package dispatcher
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher Panic recovery
+// ###########################################################################
+// ###########################################################################
+
+// recoverPanic handles a panic p of the handler answering r. It logs the
+// stack with the ids of the request, counts it and replies 500 if nothing
+// was written yet. http.ErrAbortHandler is passed on, as net/http uses it
+// to abort replies silently.
+func (ds *Dispatcher) recoverPanic(rw *responseWriter, r *http.Request, p interface{}) (status int, contentLen int, msg string) {
+	if p == http.ErrAbortHandler {
+		panic(p)
+	}
+
+	ds.prometheusPanics.Inc()
+	ids := requestIDs(r)
+	msg = fmt.Sprintf("Panic: %v", p)
+
+	ds.GetLogger().Println(fmt.Sprintf("Recovered from panic '%v' in handler of '%s %s', correlation id '%s', request id '%s':\n%s", p, r.Method, r.URL.Path, ids.CorrelationID, ids.RequestID, debug.Stack()))
+
+	status = http.StatusInternalServerError
+	if !rw.written {
+		rw.status = 0
+		status, contentLen, _ = ds.ReplyProblem(rw, r, Internal(fmt.Errorf("panic: %v", p)))
+	}
+
+	ds.logRequest(r, status, contentLen, msg)
+
+	if ds.GetRepanic() {
+		panic(p)
+	}
+
+	return status, contentLen, msg
+}
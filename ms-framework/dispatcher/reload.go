@@ -0,0 +1,91 @@
+package dispatcher
+
+import (
+	"fmt"
+	"log"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher configuration updates
+// ###########################################################################
+// ###########################################################################
+
+// UpdateConfiguration runs fn while no request reads the reloadable settings,
+// so all changes fn makes are seen by requests at once.
+func (ds *Dispatcher) UpdateConfiguration(fn func()) {
+	ds.configMutex.Lock()
+	defer ds.configMutex.Unlock()
+	fn()
+}
+
+// ---------------------------------------------------------------------------
+
+// ViewConfiguration runs fn while the reloadable settings are not updated
+func (ds *Dispatcher) ViewConfiguration(fn func()) {
+	ds.configMutex.RLock()
+	defer ds.configMutex.RUnlock()
+	fn()
+}
+
+// ---------------------------------------------------------------------------
+
+// ApplyHeaderStrings replaces the headers created from the configured header
+// strings. Headers added by the service itself are kept. Call it from
+// UpdateConfiguration once the service runs.
+func (ds *Dispatcher) ApplyHeaderStrings() {
+
+	for _, h := range ds.configuredRequestHeaders {
+		ds.RemoveRequestHeader(h)
+	}
+	for _, h := range ds.configuredResponseHeaders {
+		ds.RemoveResponseHeader(h)
+	}
+	for _, op := range ds.configuredCopyHeaders {
+		ds.RemoveCopyHeaderOperation(op)
+	}
+
+	ds.configuredRequestHeaders = nil
+	ds.configuredResponseHeaders = nil
+	ds.configuredCopyHeaders = nil
+
+	for _, line := range ds.GetRequestHeaderStrings() {
+		h := HeaderFromString(line)
+		ds.AddRequestHeader(h)
+		ds.configuredRequestHeaders = append(ds.configuredRequestHeaders, h)
+	}
+
+	for _, line := range ds.GetResponseHeaderStrings() {
+		h := HeaderFromString(line)
+		ds.AddResponseHeader(h)
+		ds.configuredResponseHeaders = append(ds.configuredResponseHeaders, h)
+	}
+
+	for _, line := range ds.GetCopyHeaderStrings() {
+		op := HeaderOperationFromString(line)
+		ds.AddCopyHeaderOperation(op)
+		ds.configuredCopyHeaders = append(ds.configuredCopyHeaders, op)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// ReopenLogfile opens the configured logfile again and closes the previous
+// one. It is used after the logfile setting changed or was rotated.
+func (ds *Dispatcher) ReopenLogfile() error {
+	writer, closer, err := openLogfile(ds.GetLogfile())
+	if err != nil {
+		return fmt.Errorf("could not open logfile '%s', error was '%s'", ds.GetLogfile(), err.Error())
+	}
+
+	previous := ds.logCloser
+	ds.logger.SetOutput(writer)
+	ds.logCloser = closer
+
+	if previous != nil {
+		if err := previous.Close(); err != nil {
+			log.Printf("Could not close previous logfile, error was '%s'!", err.Error())
+		}
+	}
+	return nil
+}
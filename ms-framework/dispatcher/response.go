@@ -1,5 +1,9 @@
 package dispatcher
 
+import (
+	"net/http"
+)
+
 // ###########################################################################
 // ###########################################################################
 // Dispatcher Response
@@ -16,6 +20,9 @@ type BasicResponse struct {
 	Name      string `json:"name"`
 	Hostname  string `json:"hostname"`
 	Version   string `json:"version"`
+
+	CorrelationID string `json:"correlationid,omitempty"`
+	RequestID     string `json:"requestid,omitempty"`
 }
 
 type Trace struct {
@@ -69,3 +76,11 @@ func InitResponseFromDispatcher(r *Response, ds IConfiguration, code int, status
 func InitTraceFromDispatcher(t *Trace, ds IConfiguration, code int, status string) {
 	InitTrace(t, ds.GetNamespace(), ds.GetName(), ds.GetHostname(), ds.GetVersion(), code, status)
 }
+
+// InitResponseFromRequest adds the correlation and request id of the request
+// being answered
+func InitResponseFromRequest(r *Response, in *http.Request) {
+	ids := requestIDs(in)
+	r.CorrelationID = ids.CorrelationID
+	r.RequestID = ids.RequestID
+}
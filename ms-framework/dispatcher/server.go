@@ -0,0 +1,93 @@
+package dispatcher
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// ###########################################################################
+// ###########################################################################
+// HTTP server
+// ###########################################################################
+// ###########################################################################
+
+// newServer creates the server of the public listeners. HTTP/2 is offered on
+// TLS listeners unless disabled, and accepted without TLS (h2c) on the others
+// if enabled. Its TLS configuration is a copy of the dispatcher's, the HTTP
+// client shares the original one.
+func (ds *Dispatcher) newServer(handler http.Handler) (*http.Server, error) {
+	server := ds.newHTTPServer(handler)
+
+	h2s := &http2.Server{
+		MaxConcurrentStreams: uint32(ds.GetMaxConcurrentStreams()),
+	}
+
+	if ds.GetH2C() {
+		h2cHandler := h2c.NewHandler(handler, h2s)
+		server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil {
+				handler.ServeHTTP(w, r)
+				return
+			}
+			h2cHandler.ServeHTTP(w, r)
+		})
+	}
+
+	if !ds.hasServerTLS() {
+		return server, nil
+	}
+
+	server.TLSConfig = ds.tlsInfo.tlsConfig.Clone()
+
+	if !ds.GetHTTP2() {
+		// A non-nil map keeps net/http from configuring HTTP/2 itself
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		return server, nil
+	}
+
+	if err := http2.ConfigureServer(server, h2s); err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// newHTTPServer creates a server with the configured timeouts and limits,
+// which apply to the public and the admin listeners
+func (ds *Dispatcher) newHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(ds.GetReadHeaderTimeout()) * time.Millisecond,
+		ReadTimeout:       time.Duration(ds.GetReadTimeout()) * time.Millisecond,
+		WriteTimeout:      time.Duration(ds.GetWriteTimeout()) * time.Millisecond,
+		IdleTimeout:       time.Duration(ds.GetIdleTimeout()) * time.Millisecond,
+		MaxHeaderBytes:    ds.GetMaxHeaderBytes(),
+		ErrorLog:          ds.GetLogger(),
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// hasServerTLS reports if the public listeners can use TLS
+func (ds *Dispatcher) hasServerTLS() bool {
+	return ds.tlsInfo != nil && ds.tlsInfo.certificate != nil
+}
+
+// ---------------------------------------------------------------------------
+
+// protocols describes the protocols a listener accepts for the log
+func (ds *Dispatcher) protocols(withTLS bool) string {
+	switch {
+	case withTLS && ds.GetHTTP2():
+		return "HTTP/1.1, HTTP/2"
+	case !withTLS && ds.GetH2C():
+		return "HTTP/1.1, h2c"
+	}
+	return "HTTP/1.1"
+}
@@ -0,0 +1,130 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher startup and shutdown
+// ###########################################################################
+// ###########################################################################
+
+// StartFunc is called once all listeners are open
+type StartFunc func()
+
+// ShutdownFunc is called when the service shuts down, before it stops
+// accepting requests. ctx ends with the shutdown timeout.
+type ShutdownFunc func(ctx context.Context)
+
+// ###########################################################################
+
+// OnStart registers fn to be called once the service accepts requests
+func (ds *Dispatcher) OnStart(fn StartFunc) {
+	ds.startFuncs = append(ds.startFuncs, fn)
+}
+
+// ---------------------------------------------------------------------------
+
+// OnShutdown registers fn to be called when the service shuts down. The
+// functions are called in reverse order of registration.
+func (ds *Dispatcher) OnShutdown(fn ShutdownFunc) {
+	ds.shutdownFuncs = append(ds.shutdownFuncs, fn)
+}
+
+// ---------------------------------------------------------------------------
+
+// Shutdown makes Run shut the service down like on SIGTERM. It returns at
+// once, Run returns when the shutdown is done.
+func (ds *Dispatcher) Shutdown() {
+	ds.shutdownOnce.Do(func() { close(ds.shutdown) })
+}
+
+// ###########################################################################
+
+// waitForShutdown blocks until a server fails, which is returned, or until
+// the service is asked to shut down by SIGINT, SIGTERM or Shutdown
+func (ds *Dispatcher) waitForShutdown(errs chan error) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-errs:
+		return err
+	case s := <-signals:
+		ds.GetLogger().Println(fmt.Sprintf("Shutting down on %s.", s))
+	case <-ds.shutdown:
+		ds.GetLogger().Println("Shutting down.")
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+// stop runs the shutdown functions and lets the servers finish the requests
+// in progress. Requests still running after the shutdown timeout, like
+// event streams, are ended. The admin listener stops accepting together with
+// the public ones.
+func (ds *Dispatcher) stop(server *http.Server, grpcServer *grpc.Server, adminServer *http.Server) {
+	ctx := context.Background()
+	if ds.GetShutdownTimeout() > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(ds.GetShutdownTimeout())*time.Millisecond)
+		defer cancel()
+	}
+
+	for i := len(ds.shutdownFuncs) - 1; i >= 0; i-- {
+		ds.shutdownFuncs[i](ctx)
+	}
+
+	// GracefulStop does not support calls served on the listeners of the
+	// service, server.Shutdown waits for them
+	if grpcServer != nil {
+		defer grpcServer.Stop()
+	}
+
+	if grpcServer != nil && ds.GetGRPCPort() > 0 {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		defer func() {
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	if adminServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			ds.shutdownServer(ctx, adminServer)
+			close(stopped)
+		}()
+		defer func() { <-stopped }()
+	}
+
+	ds.shutdownServer(ctx, server)
+}
+
+// ---------------------------------------------------------------------------
+
+// shutdownServer lets server finish its requests until ctx ends and closes
+// the remaining ones
+func (ds *Dispatcher) shutdownServer(ctx context.Context, server *http.Server) {
+	if err := server.Shutdown(ctx); err != nil {
+		ds.GetLogger().Println(fmt.Sprintf("Ending the remaining requests, error was '%s'.", err.Error()))
+		server.Close()
+	}
+}
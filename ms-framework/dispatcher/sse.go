@@ -0,0 +1,283 @@
+package dispatcher
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher Server-Sent Events
+// ###########################################################################
+// ###########################################################################
+
+// EventStreamContentType is the content type of Server-Sent Events
+const EventStreamContentType = "text/event-stream"
+
+var errEventStreamClosed = errors.New("the event stream is closed")
+
+// Event is a Server-Sent Event. Data is sent as it is if it is a string or
+// []byte, as JSON otherwise. Events read by ReadEvents have string data.
+type Event struct {
+	ID    string
+	Event string
+	Data  interface{}
+	Retry time.Duration
+}
+
+// ---------------------------------------------------------------------------
+
+// EventHandler streams events to a client until the client disconnects,
+// which cancels the context of r, or until it has nothing more to send.
+type EventHandler func(stream *EventStream, r *http.Request) error
+
+// ---------------------------------------------------------------------------
+
+// EventStream sends events to a client. Each event is flushed at once and
+// idle streams get heartbeat comments, so that proxies keep them open.
+// Send may be called from several goroutines.
+type EventStream struct {
+	// LastEventID is the id of the last event the client received before it
+	// reconnected, from the Last-Event-ID header or the lastEventId query
+	// parameter. Handlers resume after it.
+	LastEventID string
+
+	w       http.ResponseWriter
+	flusher http.Flusher
+	mutex   sync.Mutex
+	events  int
+	bytes   int
+	err     error
+	closed  bool
+}
+
+// ---------------------------------------------------------------------------
+
+// Send writes and flushes an event. It fails once the client is gone.
+func (s *EventStream) Send(event *Event) error {
+	data, err := eventData(event.Data)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	if len(event.ID) > 0 {
+		fmt.Fprintf(&b, "id: %s\n", singleLine(event.ID))
+	}
+	if len(event.Event) > 0 {
+		fmt.Fprintf(&b, "event: %s\n", singleLine(event.Event))
+	}
+	if event.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", event.Retry.Milliseconds())
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", strings.TrimSuffix(line, "\r"))
+	}
+	b.WriteString("\n")
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err = s.write(b.String()); err == nil {
+		s.events++
+	}
+	return err
+}
+
+// ---------------------------------------------------------------------------
+
+// Comment writes a comment, which clients ignore
+func (s *EventStream) Comment(text string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.write(fmt.Sprintf(": %s\n\n", singleLine(text)))
+}
+
+// ---------------------------------------------------------------------------
+
+// write sends and flushes data, the mutex must be held
+func (s *EventStream) write(data string) error {
+	if s.closed {
+		return errEventStreamClosed
+	}
+	if s.err != nil {
+		return s.err
+	}
+	n, err := io.WriteString(s.w, data)
+	s.bytes += n
+	if err != nil {
+		s.err = err
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+// heartbeat writes a comment every interval until ctx is done
+func (s *EventStream) heartbeat(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.Comment("heartbeat") != nil {
+				return
+			}
+		}
+	}
+}
+
+// ###########################################################################
+
+// HandleEvents adapts fn to an HTTPHandler replying an event stream. Routes
+// of event streams should not have a request timeout, see AddEventHandler.
+func (ds *Dispatcher) HandleEvents(fn EventHandler) HTTPHandler {
+	return func(w http.ResponseWriter, r *http.Request) (int, int, string) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			return ds.ReplyProblem(w, r, Internal(errors.New("the connection does not support streaming")))
+		}
+
+		stream := &EventStream{
+			LastEventID: r.Header.Get("Last-Event-ID"),
+			w:           w,
+			flusher:     flusher,
+		}
+		if len(stream.LastEventID) == 0 {
+			stream.LastEventID = r.URL.Query().Get("lastEventId")
+		}
+
+		ds.SetResponseHeaders(EventStreamContentType, w, r)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		ds.prometheusEventStreams.Inc()
+		defer ds.prometheusEventStreams.Dec()
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		var interval int
+		ds.ViewConfiguration(func() { interval = ds.GetEventHeartbeat() })
+		if interval > 0 {
+			go stream.heartbeat(ctx, time.Duration(interval)*time.Millisecond)
+		}
+
+		err := fn(stream, r.WithContext(ctx))
+		cancel()
+
+		stream.mutex.Lock()
+		defer stream.mutex.Unlock()
+		stream.closed = true
+		ds.prometheusEvents.Add(float64(stream.events))
+
+		if err != nil && !errors.Is(err, context.Canceled) && stream.err == nil {
+			return http.StatusOK, stream.bytes, fmt.Sprintf("Event stream failed after %d events: %s", stream.events, err.Error())
+		}
+		return http.StatusOK, stream.bytes, fmt.Sprintf("Streamed %d events.", stream.events)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// AddEventHandler adds an event stream at path. Its requests are not ended
+// by the request timeout.
+func (ds *Dispatcher) AddEventHandler(path string, fn EventHandler) {
+	ds.AddHandler(path, &HandlerGroup{Get: ds.HandleEvents(fn), Timeout: -1})
+}
+
+// ###########################################################################
+
+// ReadEvents parses an event stream from r and calls fn for each event until
+// the stream ends or fn fails. Events without data are skipped, like
+// browsers do.
+func ReadEvents(r io.Reader, fn func(*Event) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), DefaultBindBodySize)
+
+	var event Event
+	var data []string
+
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+
+		if len(line) == 0 {
+			if len(data) > 0 {
+				event.Data = strings.Join(data, "\n")
+				if err := fn(&event); err != nil {
+					return err
+				}
+			}
+			event = Event{ID: event.ID}
+			data = nil
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field := strings.SplitN(line, ":", 2)
+		value := ""
+		if len(field) > 1 {
+			value = strings.TrimPrefix(field[1], " ")
+		}
+
+		switch field[0] {
+		case "id":
+			event.ID = value
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				event.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// ---------------------------------------------------------------------------
+
+// eventData returns the data of an event as text
+func eventData(data interface{}) (string, error) {
+	switch v := data.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ---------------------------------------------------------------------------
+
+// singleLine removes line breaks, which would end a field
+func singleLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", " ").Replace(s)
+}
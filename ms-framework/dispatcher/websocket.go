@@ -0,0 +1,212 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Dispatcher WebSockets
+// ###########################################################################
+// ###########################################################################
+
+// WebSocketHandler serves an upgraded connection. The connection is closed
+// when it returns.
+type WebSocketHandler func(conn *WebSocket, r *http.Request) error
+
+// ---------------------------------------------------------------------------
+
+// WebSocket is an upgraded connection. It pings the client and closes the
+// connection if no pong arrives in time, see websocketping. Messages are
+// counted and limited to maxbodysize. Writes may be made from several
+// goroutines, reads from one at a time.
+type WebSocket struct {
+	*websocket.Conn
+
+	ds          *Dispatcher
+	writeMutex  sync.Mutex
+	messagesIn  int
+	messagesOut int
+	bytesIn     int
+	bytesOut    int
+}
+
+// ---------------------------------------------------------------------------
+
+// ReadMessage reads the next data message
+func (ws *WebSocket) ReadMessage() (messageType int, data []byte, err error) {
+	messageType, data, err = ws.Conn.ReadMessage()
+	if err == nil {
+		ws.messagesIn++
+		ws.bytesIn += len(data)
+		ws.ds.prometheusWebSocketMessages.WithLabelValues("in").Inc()
+		ws.ds.prometheusWebSocketBytes.WithLabelValues("in").Add(float64(len(data)))
+	}
+	return messageType, data, err
+}
+
+// ---------------------------------------------------------------------------
+
+// WriteMessage writes a data message
+func (ws *WebSocket) WriteMessage(messageType int, data []byte) error {
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+
+	err := ws.Conn.WriteMessage(messageType, data)
+	if err == nil {
+		ws.messagesOut++
+		ws.bytesOut += len(data)
+		ws.ds.prometheusWebSocketMessages.WithLabelValues("out").Inc()
+		ws.ds.prometheusWebSocketBytes.WithLabelValues("out").Add(float64(len(data)))
+	}
+	return err
+}
+
+// ---------------------------------------------------------------------------
+
+// ReadJSON reads the next message and decodes it into v
+func (ws *WebSocket) ReadJSON(v interface{}) error {
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// ---------------------------------------------------------------------------
+
+// WriteJSON writes v as a text message
+func (ws *WebSocket) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.WriteMessage(websocket.TextMessage, data)
+}
+
+// ---------------------------------------------------------------------------
+
+// keepalive pings the client every interval until done is closed. Each pong
+// extends the read deadline by two intervals.
+func (ws *WebSocket) keepalive(interval time.Duration, done chan struct{}) {
+	ws.SetReadDeadline(time.Now().Add(2 * interval))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(2 * interval))
+	})
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(interval)) != nil {
+				return
+			}
+		}
+	}
+}
+
+// ###########################################################################
+
+// HandleWebSocket adapts fn to an HTTPHandler upgrading the request to a
+// WebSocket. The request passes all wrappers and handlers of the dispatcher
+// like any other. Browsers may connect from the allowed CORS origins.
+// Routes of WebSockets should not have a request timeout, see
+// AddWebSocketHandler.
+func (ds *Dispatcher) HandleWebSocket(fn WebSocketHandler) HTTPHandler {
+	return func(w http.ResponseWriter, r *http.Request) (int, int, string) {
+		if !websocket.IsWebSocketUpgrade(r) {
+			return ds.ReplyProblem(w, r, NewProblem(http.StatusUpgradeRequired, "The route requires a WebSocket connection."))
+		}
+
+		var ping, maxMessageSize int
+		var origins []string
+		var credentials bool
+		ds.ViewConfiguration(func() {
+			ping = ds.GetWebSocketPing()
+			maxMessageSize = ds.GetMaxBodySize()
+			origins = ds.GetCORSOrigins()
+			credentials = ds.GetCORSCredentials()
+		})
+
+		upgrader := websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				return len(origin) == 0 || matchesOrigin(origins, origin, credentials)
+			},
+		}
+
+		ds.SetResponseHeaders("", w, r)
+		w.Header().Del("Content-Type")
+
+		conn, err := upgrader.Upgrade(w, r, w.Header())
+		if err != nil {
+			// The upgrader replied already
+			status := http.StatusBadRequest
+			if rw, ok := w.(*responseWriter); ok && rw.status != 0 {
+				status = rw.status
+			}
+			return status, 0, fmt.Sprintf("WebSocket upgrade failed: %s", err.Error())
+		}
+
+		ws := &WebSocket{Conn: conn, ds: ds}
+		if maxMessageSize > 0 {
+			ws.SetReadLimit(int64(maxMessageSize))
+		}
+
+		ds.prometheusWebSockets.Inc()
+		defer ds.prometheusWebSockets.Dec()
+
+		done := make(chan struct{})
+		if ping > 0 {
+			go ws.keepalive(time.Duration(ping)*time.Millisecond, done)
+		}
+
+		started := time.Now()
+		err = fn(ws, r)
+		close(done)
+
+		closeCode := websocket.CloseNormalClosure
+		if err != nil && !isWebSocketClosed(err) {
+			closeCode = websocket.CloseInternalServerErr
+		}
+		ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, ""), time.Now().Add(time.Second))
+		conn.Close()
+
+		msg := fmt.Sprintf("WebSocket closed after %s, %d messages (%d bytes) in, %d messages (%d bytes) out.", time.Since(started).Round(time.Millisecond), ws.messagesIn, ws.bytesIn, ws.messagesOut, ws.bytesOut)
+		if closeCode != websocket.CloseNormalClosure {
+			msg = fmt.Sprintf("%s Failed: %s", msg, err.Error())
+		}
+		return http.StatusSwitchingProtocols, ws.bytesOut, msg
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// AddWebSocketHandler adds a WebSocket endpoint at path. Its connections are
+// not ended by the request timeout.
+func (ds *Dispatcher) AddWebSocketHandler(path string, fn WebSocketHandler) {
+	ds.AddHandler(path, &HandlerGroup{Get: ds.HandleWebSocket(fn), Timeout: -1})
+}
+
+// ---------------------------------------------------------------------------
+
+// isWebSocketClosed reports if err tells that the client closed the
+// connection or went away
+func isWebSocketClosed(err error) bool {
+	var closeError *websocket.CloseError
+	if errors.As(err, &closeError) {
+		return closeError.Code == websocket.CloseNormalClosure || closeError.Code == websocket.CloseGoingAway || closeError.Code == websocket.CloseNoStatusReceived
+	}
+	return false
+}
@@ -6,15 +6,19 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
-	"strconv"
+	"reflect"
 	"time"
 
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/config"
 	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher"
 )
 
+// DefaultPort is used if no port is configured
+const DefaultPort = 8080
+
 // DBConfiguration ...
 type DBConfiguration struct {
-	DBName string `json:"db"`
+	DBName string `json:"db" env:"MS_DATABASE" secret:"true" help:"Database connection"`
 }
 
 // IDBConfiguration ...
@@ -38,12 +42,48 @@ type IServiceConfiguration interface {
 
 // FileConfiguration ...
 type FileConfiguration struct {
-	ConfigurationFile string
+	ConfigurationFile  string `json:"-" flag:"config" env:"MS_CONFIG" help:"Configuration file (.json, .yaml, .yml or .toml)."`
+	ConfigurationWatch int    `json:"configwatch" default:"5000" validate:"min=0" help:"Check the configuration file for changes every n ms, 0 disables it."`
 }
 
 // IFileConfiguration ...
 type IFileConfiguration interface {
 	GetConfigurationFile() string
+	GetConfigurationWatch() int
+}
+
+// DiscoveryConfiguration ...
+type DiscoveryConfiguration struct {
+	Discovery string `json:"discovery" env:"MS_DISCOVERY" validate:"regex=^((dns|memory)://.*|[^:]*)$" help:"Resolve other services from a file like '/etc/ms/services.yaml', 'dns://svc.cluster.local?port=http' (SRV records) or 'memory://' (in process)."`
+	Advertise string `json:"advertise" env:"MS_ADVERTISE" validate:"regex=^(https?://.*)?$" help:"URL other services reach this one at, without namespace (default the hostname and port)."`
+	Register  bool   `json:"register" help:"Register the advertised URL with the discovery on startup and deregister it on shutdown."`
+}
+
+// IDiscoveryConfiguration ...
+type IDiscoveryConfiguration interface {
+	GetDiscovery() string
+	GetAdvertise() string
+	GetRegister() bool
+}
+
+// BalancerConfiguration ...
+type BalancerConfiguration struct {
+	BalancerPolicy        string `json:"balancerpolicy" default:"roundrobin" validate:"enum=roundrobin|leastrequests|hash" help:"Pick the endpoint of a discovered service by roundrobin, leastrequests or hash (consistent hash of a header)."`
+	BalancerHashHeader    string `json:"balancerhashheader" default:"X-Session-Id" help:"Header the hash policy keys on, requests without it are keyed on their path."`
+	BalancerMaxFailures   int    `json:"balancermaxfailures" default:"5" validate:"min=1" help:"Eject an endpoint after this many failed requests in a row."`
+	BalancerEjectTime     int    `json:"balancerejecttime" default:"30000" validate:"min=1" help:"Eject a failing endpoint for ms, unless it answers a probe earlier."`
+	BalancerProbeInterval int    `json:"balancerprobeinterval" default:"5000" validate:"min=1" help:"Probe ejected endpoints every ms."`
+	BalancerProbePath     string `json:"balancerprobepath" default:"/status" help:"Path probed at ejected endpoints."`
+}
+
+// IBalancerConfiguration ...
+type IBalancerConfiguration interface {
+	GetBalancerPolicy() string
+	GetBalancerHashHeader() string
+	GetBalancerMaxFailures() int
+	GetBalancerEjectTime() int
+	GetBalancerProbeInterval() int
+	GetBalancerProbePath() string
 }
 
 // Configuration ...
@@ -52,6 +92,25 @@ type Configuration struct {
 	DBConfiguration
 	ServiceConfiguration
 	FileConfiguration
+	DiscoveryConfiguration
+	BalancerConfiguration
+	extensions []configurationExtension
+	source     *configurationSource
+}
+
+// configurationExtension is a configuration struct registered by a service
+type configurationExtension struct {
+	section string
+	target  interface{}
+	preset  reflect.Value
+}
+
+// configurationSource remembers how a configuration was loaded, so it can be
+// loaded again by MicroService.Reload
+type configurationSource struct {
+	args    []string
+	preset  Configuration
+	foreign []*flag.Flag
 }
 
 // IConfiguration ...
@@ -60,6 +119,8 @@ type IConfiguration interface {
 	IDBConfiguration
 	IServiceConfiguration
 	IFileConfiguration
+	IDiscoveryConfiguration
+	IBalancerConfiguration
 }
 
 // GetDBName ...
@@ -77,278 +138,168 @@ func (cfg DBConfiguration) GetDBName() string { return cfg.DBName }
 // GetConfigurationFile ...
 func (cfg FileConfiguration) GetConfigurationFile() string { return cfg.ConfigurationFile }
 
-// ---------------------------------------------------------------------------
+// GetConfigurationWatch ...
+func (cfg FileConfiguration) GetConfigurationWatch() int { return cfg.ConfigurationWatch }
 
-// InitConfigurationFromArgs ...
-func InitConfigurationFromArgs(cfg *Configuration, args []string, flagset *flag.FlagSet) {
-	var requestHeaders dispatcher.HeaderList
-	var responseHeaders dispatcher.HeaderList
-	var copyHeaders dispatcher.HeaderList
-	var configurationFile string
+// GetDiscovery ...
+func (cfg DiscoveryConfiguration) GetDiscovery() string { return cfg.Discovery }
 
-	DefaultPort := 8080
-	DefaultHost := "0.0.0.0"
+// GetAdvertise ...
+func (cfg DiscoveryConfiguration) GetAdvertise() string { return cfg.Advertise }
 
-	if flagset == nil {
-		flagset = flag.NewFlagSet("ms", flag.PanicOnError)
-	}
+// GetRegister ...
+func (cfg DiscoveryConfiguration) GetRegister() bool { return cfg.Register }
 
-	flagset.Var(&requestHeaders, "requestheader", "Add these headers for outgoing requests.")
-	flagset.Var(&responseHeaders, "responseheader", "Add these headers for outgoing replies.")
-	flagset.Var(&copyHeaders, "copyheader", "Add these headers for outgoing replies.")
-	phost := flagset.String("host", "", "Ip address to listen on.")
-	pport := flagset.Int("port", -1, "Listen port.")
-	pname := flagset.String("name", "", "Name of the service.")
-	phostname := flagset.String("hostname", "", "Hostname of the service.")
-	pversion := flagset.String("version", "", "Version of the service.")
-	pnamespace := flagset.String("namespace", "", "Prefix for all urls.")
-	pdb := flagset.String("db", "", "Database connection")
-	pcertchainfile := flagset.String("cert", "", "Certificate chain (host cert + all sigining CAs)")
-	pkeyfile := flagset.String("key", "", "Private key file.")
-	pcafile := flagset.String("ca", "", "CA chains.")
-	pconfig := flagset.String("config", "", "Configuration file.")
-	// pmaxTcpConnections := flagset.Int("maxtcpconnections", -1, "Maximum of parallel connections to accept on TCP level.")
-	pmaxConnections := flagset.Int("maxconnections", -1, "Maximum of parallel connections to accept.")
-	pdelayReply := flagset.Int("delayreply", -1, "Slow down replying by this amount of ms.")
-	pclientTimeout := flagset.Int("clienttimeout", 1500, "Timeout of HTTP client in ms.")
-	plogfile := flagset.String("logfile", "", "Logfile (empty=stdout).")
-	pnometrics := flagset.Bool("nometrics", false, "Don't report metrics..")
-	ppasswordfile := flagset.String("passwordfile", "", "User/password list.")
-
-	flagset.Parse(os.Args[1:])
-
-	if len(responseHeaders) > 0 {
-		cfg.ResponseHeaderStrings = responseHeaders
-	}
+// GetBalancerPolicy ...
+func (cfg BalancerConfiguration) GetBalancerPolicy() string { return cfg.BalancerPolicy }
 
-	if len(requestHeaders) > 0 {
-		cfg.RequestHeaderStrings = requestHeaders
-	}
+// GetBalancerHashHeader ...
+func (cfg BalancerConfiguration) GetBalancerHashHeader() string { return cfg.BalancerHashHeader }
 
-	if len(copyHeaders) > 0 {
-		cfg.CopyHeaderStrings = copyHeaders
-	}
+// GetBalancerMaxFailures ...
+func (cfg BalancerConfiguration) GetBalancerMaxFailures() int { return cfg.BalancerMaxFailures }
 
-	if *pport >= 0 {
-		cfg.Port = *pport
-	} else {
-		ev := os.Getenv("MS_PORT")
-		if len(ev) > 0 {
-			cfg.Port, _ = strconv.Atoi(ev)
-		}
-	}
+// GetBalancerEjectTime ...
+func (cfg BalancerConfiguration) GetBalancerEjectTime() int { return cfg.BalancerEjectTime }
 
-	if len(*phost) > 0 {
-		cfg.Host = *phost
-	}
-	if len(cfg.Host) == 0 {
-		cfg.Host = os.Getenv("MS_HOST")
-	}
+// GetBalancerProbeInterval ...
+func (cfg BalancerConfiguration) GetBalancerProbeInterval() int { return cfg.BalancerProbeInterval }
 
-	if len(*pname) > 0 {
-		cfg.Name = *pname
-	}
-	if len(cfg.Name) == 0 {
-		cfg.Name = os.Getenv("MS_NAME")
-	}
+// GetBalancerProbePath ...
+func (cfg BalancerConfiguration) GetBalancerProbePath() string { return cfg.BalancerProbePath }
 
-	if len(*phostname) > 0 {
-		cfg.Hostname = *phostname
-	}
-	if len(cfg.Hostname) == 0 {
-		cfg.Hostname = os.Getenv("MS_HOSTNAME")
-	}
-
-	if len(*pversion) > 0 {
-		cfg.Version = *pversion
-	}
-	if len(cfg.Version) == 0 {
-		cfg.Version = os.Getenv("MS_VERSION")
-	}
-
-	if len(*pnamespace) > 0 {
-		cfg.Namespace = *pnamespace
-	}
-	if len(cfg.Namespace) == 0 {
-		cfg.Namespace = os.Getenv("MS_NAMESPACE")
-	}
+// ---------------------------------------------------------------------------
 
-	if len(*pdb) > 0 {
-		cfg.DBName = *pdb
-	}
-	if len(cfg.DBName) == 0 {
-		cfg.DBName = os.Getenv("MS_DATABASE")
-	}
+// RegisterConfiguration declares an additional configuration struct of a
+// service embedding MicroService. target must point to a struct, its fields
+// are described by the tags of package config and are loaded together with
+// cfg under the same precedence. Flags, MS_* environment variables and file
+// keys are derived from the field names unless the tags set them. If section
+// is not empty, the fields are read from the object 'section' of the
+// configuration file, and their flags and environment variables are prefixed
+// with 'section-' and 'MS_SECTION_'.
+//
+//	type ThermometerConfiguration struct {
+//		Interval int `json:"interval" default:"1000" help:"Measure interval in ms."`
+//	}
+//
+//	var tcfg ThermometerConfiguration
+//	cfg.RegisterConfiguration("thermometer", &tcfg)
+//	microservice.InitConfigurationFromArgs(&cfg, os.Args, nil)
+func (cfg *Configuration) RegisterConfiguration(section string, target interface{}) {
+	cfg.extensions = append(cfg.extensions, configurationExtension{section: section, target: target})
+}
 
-	if len(*pcertchainfile) > 0 {
-		cfg.CertChainFile = *pcertchainfile
-	}
-	if len(cfg.CertChainFile) == 0 {
-		cfg.CertChainFile = os.Getenv("MS_CERTCHAINFILE")
-	}
+// ---------------------------------------------------------------------------
 
-	if len(*pkeyfile) > 0 {
-		cfg.KeyFile = *pkeyfile
-	}
-	if len(cfg.KeyFile) == 0 {
-		cfg.KeyFile = os.Getenv("MS_KEYFILE")
-	}
+// Redacted returns a copy of cfg which is safe to log or serve: secret fields
+// like the database connection are masked and resolved secret references are
+// scrubbed from all other values. The registered configurations are not
+// part of it, see RegisterConfiguration.
+func (cfg *Configuration) Redacted() Configuration {
+	redacted := *cfg
+	redacted.extensions = nil
+	redacted.source = nil
+	config.Redact(&redacted)
+	return redacted
+}
 
-	if len(*pcafile) > 0 {
-		cfg.CAFile = *pcafile
-	}
-	if len(cfg.CAFile) == 0 {
-		cfg.CAFile = os.Getenv("MS_CAFILE")
-	}
+// ---------------------------------------------------------------------------
 
-	if len(*pconfig) > 0 {
-		configurationFile = *pconfig
-	}
-	if len(configurationFile) == 0 {
-		configurationFile = os.Getenv("MS_CONFIG")
+// redactedValues returns the values of Redacted together with the redacted
+// registered configurations, below their section if they have one. This is
+// what the debug endpoint '/configuration' serves.
+func (cfg *Configuration) redactedValues() (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if err := mergeValues(values, cfg.Redacted()); err != nil {
+		return nil, err
 	}
 
-	// if *pmaxTcpConnections > 0 {
-	// 	cfg.MaxTcpConnections = *pmaxTcpConnections
-	// } else {
-	// 	ev := os.Getenv("MS_MAXTCPCONNECTIONS")
-	// 	if len(ev) > 0 {
-	// 		cfg.MaxTcpConnections, _ = strconv.Atoi(ev)
-	// 	}
-	// }
-
-	if *pmaxConnections > 0 {
-		cfg.MaxConnections = *pmaxConnections
-	} else {
-		ev := os.Getenv("MS_MAXCONNECTIONS")
-		if len(ev) > 0 {
-			cfg.MaxConnections, _ = strconv.Atoi(ev)
-		}
-	}
+	for _, extension := range cfg.extensions {
+		redacted := copyStruct(extension.target)
+		config.Redact(redacted.Interface())
 
-	if *pdelayReply > 0 {
-		cfg.DelayReply = *pdelayReply
-	} else {
-		ev := os.Getenv("MS_DELAYREPLY")
-		if len(ev) > 0 {
-			cfg.DelayReply, _ = strconv.Atoi(ev)
+		target := values
+		if len(extension.section) > 0 {
+			target = map[string]interface{}{}
+			values[extension.section] = target
 		}
-	}
-
-	if *pclientTimeout > 0 {
-		cfg.ClientTimeout = *pclientTimeout
-	} else {
-		ev := os.Getenv("MS_CLIENTTIMEOUT")
-		if len(ev) > 0 {
-			cfg.ClientTimeout, _ = strconv.Atoi(ev)
+		if err := mergeValues(target, redacted.Interface()); err != nil {
+			return nil, err
 		}
 	}
+	return values, nil
+}
 
-	if len(*plogfile) > 0 {
-		cfg.Logfile = *plogfile
-	}
-	if len(cfg.Logfile) == 0 {
-		cfg.Logfile = os.Getenv("MS_LOGFILE")
-	}
-
-	if *pnometrics {
-		cfg.NoMetrics = true
-	} else {
-		ev := os.Getenv("MS_NO_METRICS")
-		if len(ev) > 0 {
-			cfg.NoMetrics = true
-		}
-	}
+// ---------------------------------------------------------------------------
 
-	if len(*ppasswordfile) > 0 {
-		cfg.Passwordfile = *ppasswordfile
-	}
-	if len(cfg.Passwordfile) == 0 {
-		cfg.Passwordfile = os.Getenv("MS_PASSWORDFILE")
+// mergeValues adds the JSON fields of v to values
+func mergeValues(values map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
 	}
+	return json.Unmarshal(data, &values)
+}
 
-	if len(configurationFile) > 0 {
-
-		cfg.ConfigurationFile = configurationFile
-		file, err := os.Open(configurationFile)
-
-		if err != nil {
-			flagset.Usage()
-			panic(fmt.Sprintf(fmt.Sprintf("Error: Failed to open onfiguration file '%s'. Error was %s!\n", configurationFile, err.Error())))
-		}
-
-		defer file.Close()
-		decoder := json.NewDecoder(file)
-		cfgFile := Configuration{}
-		err = decoder.Decode(&cfgFile)
-		if err != nil {
-			flagset.Usage()
-			panic(fmt.Sprintf(fmt.Sprintf("Error: Failed to parse onfiguration file '%s'. Error was %s!\n", configurationFile, err.Error())))
-		}
-
-		if cfg.Port < 0 {
-			cfg.Port = cfgFile.Port
-		}
-
-		if len(cfg.Host) == 0 {
-			cfg.Host = cfgFile.Host
-		}
-
-		if len(cfg.Name) == 0 {
-			cfg.Name = cfgFile.Name
-		}
-
-		if len(cfg.Hostname) == 0 {
-			cfg.Hostname = cfgFile.Hostname
-		}
-
-		if len(cfg.Version) == 0 {
-			cfg.Version = cfgFile.Version
-		}
+// ---------------------------------------------------------------------------
 
-		if len(cfg.Namespace) == 0 {
-			cfg.Namespace = cfgFile.Namespace
-		}
+// LoadConfigurationFromArgs fills cfg from its defaults, the configuration
+// file, the MS_* environment variables and the command line flags, where
+// later sources override earlier ones. args are the command line arguments
+// without the program name; os.Args is accepted as well. Invalid values and
+// unknown keys in the configuration file are returned as error.
+func LoadConfigurationFromArgs(cfg *Configuration, args []string, flagset *flag.FlagSet) error {
 
-		if len(cfg.DBName) == 0 {
-			cfg.DBName = cfgFile.DBName
-		}
+	if flagset == nil {
+		flagset = flag.NewFlagSet("ms", flag.ContinueOnError)
+	}
 
-		if len(cfg.CertChainFile) == 0 {
-			cfg.CertChainFile = cfgFile.CertChainFile
-		}
+	args = commandLineArgs(args)
+	cfg.source = &configurationSource{
+		args:    args,
+		preset:  *cfg,
+		foreign: definedFlags(flagset),
+	}
+	cfg.source.preset.extensions = nil
+	cfg.source.preset.source = nil
 
-		if len(cfg.KeyFile) == 0 {
-			cfg.KeyFile = cfgFile.KeyFile
-		}
+	for i := range cfg.extensions {
+		cfg.extensions[i].preset = copyStruct(cfg.extensions[i].target)
+	}
 
-		if len(cfg.CAFile) == 0 {
-			cfg.CAFile = cfgFile.CAFile
-		}
+	if err := cfg.load(flagset, args); err != nil {
+		return err
+	}
 
-		// if cfg.MaxTcpConnections < 0 {
-		// 	cfg.MaxTcpConnections = cfgFile.MaxConnections
-		// }
+	cfg.complete()
+	return nil
+}
 
-		if cfg.MaxConnections < 0 {
-			cfg.MaxConnections = cfgFile.MaxConnections
-		}
+// ---------------------------------------------------------------------------
 
-		if cfg.DelayReply < 0 {
-			cfg.DelayReply = cfgFile.DelayReply
-		}
+// LoadConfigurationDefaults fills the fields of cfg and its extensions which
+// are not set from their defaults, without reading the command line, the
+// environment or a configuration file. Tests build configurations like
+// this, they can not be reloaded.
+func LoadConfigurationDefaults(cfg *Configuration) error {
+	loader, err := cfg.loader(flag.NewFlagSet("ms", flag.ContinueOnError))
+	if err != nil {
+		return err
+	}
 
-		if cfg.ClientTimeout < 0 {
-			cfg.ClientTimeout = cfgFile.ClientTimeout
-		}
+	if err := loader.Defaults(); err != nil {
+		return err
+	}
 
-		if len(cfg.Logfile) == 0 {
-			cfg.Logfile = cfgFile.Logfile
-		}
+	cfg.complete()
+	return nil
+}
 
-		cfg.NoMetrics = cfgFile.NoMetrics
-	}
+// ---------------------------------------------------------------------------
 
+// complete fills the name, hostname and port if they are not configured
+func (cfg *Configuration) complete() {
 	if len(cfg.Name) == 0 {
 		cfg.Name = os.Getenv("HOSTNAME")
 	}
@@ -372,11 +323,91 @@ func InitConfigurationFromArgs(cfg *Configuration, args []string, flagset *flag.
 		cfg.Hostname = cfg.Name
 	}
 
-	if len(cfg.Host) == 0 {
-		cfg.Host = DefaultHost
+	if cfg.Port == 0 {
+		cfg.Port = DefaultPort
 	}
+}
 
-	if cfg.Port <= 0 {
-		cfg.Port = DefaultPort
+// ---------------------------------------------------------------------------
+
+// InitConfigurationFromArgs loads the configuration like
+// LoadConfigurationFromArgs does and terminates the process if that fails.
+func InitConfigurationFromArgs(cfg *Configuration, args []string, flagset *flag.FlagSet) {
+	err := LoadConfigurationFromArgs(cfg, args, flagset)
+
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s!\n", err.Error())
+		os.Exit(2)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// load runs the config.Loader on cfg and its extensions
+func (cfg *Configuration) load(flagset *flag.FlagSet, args []string) error {
+	loader, err := cfg.loader(flagset)
+	if err != nil {
+		return err
+	}
+
+	return loader.Load(args)
+}
+
+// ---------------------------------------------------------------------------
+
+// loader creates a config.Loader for cfg and its extensions
+func (cfg *Configuration) loader(flagset *flag.FlagSet) (*config.Loader, error) {
+	loader := config.NewLoader(flagset, "MS_")
+	loader.FileFlag = "config"
+
+	if err := loader.Add(cfg); err != nil {
+		return nil, err
+	}
+
+	for _, extension := range cfg.extensions {
+		if err := loader.AddSection(extension.section, extension.target); err != nil {
+			return nil, err
+		}
+	}
+
+	return loader, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// definedFlags lists the flags the service defined on flagset itself
+func definedFlags(flagset *flag.FlagSet) []*flag.Flag {
+	var flags []*flag.Flag
+	flagset.VisitAll(func(f *flag.Flag) { flags = append(flags, f) })
+	return flags
+}
+
+// ---------------------------------------------------------------------------
+
+// copyStruct returns a pointer to a copy of the struct target points to
+func copyStruct(target interface{}) reflect.Value {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return rv
+	}
+	dup := reflect.New(rv.Elem().Type())
+	dup.Elem().Set(rv.Elem())
+	return dup
+}
+
+// ---------------------------------------------------------------------------
+
+// commandLineArgs strips the program name if args is os.Args
+func commandLineArgs(args []string) []string {
+	if args == nil {
+		return os.Args[1:]
+	}
+	if len(args) > 0 && len(os.Args) > 0 && args[0] == os.Args[0] {
+		return args[1:]
 	}
+	return args
 }
@@ -0,0 +1,59 @@
+package microservice
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// redactedExtension is a configuration with a secret registered by a service
+type redactedExtension struct {
+	Token  string `json:"token" secret:"true"`
+	Device string `json:"device"`
+}
+
+// ###########################################################################
+
+func TestDebugConfiguration(t *testing.T) {
+	cfg := Configuration{}
+	cfg.DBName = "pg://user:Sup3rS3cret@db-host:5432/devices"
+	cfg.Name = "thermometer"
+	sectioned := &redactedExtension{Token: "token-value", Device: "sensor"}
+	cfg.RegisterConfiguration("thermometer", sectioned)
+	cfg.RegisterConfiguration("", &redactedExtension{Token: "other-token", Device: "probe"})
+	if err := LoadConfigurationDefaults(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	ms := &MicroService{}
+	ms.Registry = prometheus.NewRegistry()
+	Init(ms, &cfg, nil)
+
+	v, err := ms.debugConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := v.(map[string]interface{})
+
+	want := map[string]interface{}{
+		"db":     "pg://user:*****@db-host:5432/devices",
+		"name":   "thermometer",
+		"token":  "*****",
+		"device": "probe",
+	}
+	for key, value := range want {
+		if values[key] != value {
+			t.Errorf("%s: '%v' != '%v'", key, values[key], value)
+		}
+	}
+
+	section, _ := values["thermometer"].(map[string]interface{})
+	if section["token"] != "*****" || section["device"] != "sensor" {
+		t.Errorf("section: %v", values["thermometer"])
+	}
+
+	// The live configuration is not changed
+	if cfg.DBName != "pg://user:Sup3rS3cret@db-host:5432/devices" || sectioned.Token != "token-value" {
+		t.Errorf("configuration was redacted: '%s', '%s'", cfg.DBName, sectioned.Token)
+	}
+}
@@ -0,0 +1,192 @@
+package microservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/balancer"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/discovery"
+)
+
+// ###########################################################################
+// ###########################################################################
+// MicroService Discovery
+// ###########################################################################
+// ###########################################################################
+
+// SetServiceDiscovery replaces the discovery opened from the configuration,
+// e.g. by a registry shared by the services of a test. Call it before Run.
+// HTTPClient balances requests to 'service://name/path' across the
+// endpoints of the discovery, see ServiceURL.
+func (ms *MicroService) SetServiceDiscovery(d discovery.Discovery) {
+	ms.discovery = d
+
+	transport := ms.HTTPClient.Transport
+	if ms.balancer != nil {
+		ms.balancer.Close()
+		transport = ms.balancer.Transport()
+		ms.balancer = nil
+	}
+	ms.HTTPClient.Transport = transport
+
+	if d == nil {
+		return
+	}
+
+	ms.balancer = balancer.New(d, transport, balancer.Options{
+		Policy:        ms.GetBalancerPolicy(),
+		HashHeader:    ms.GetBalancerHashHeader(),
+		MaxFailures:   ms.GetBalancerMaxFailures(),
+		EjectTime:     time.Duration(ms.GetBalancerEjectTime()) * time.Millisecond,
+		ProbeInterval: time.Duration(ms.GetBalancerProbeInterval()) * time.Millisecond,
+		ProbePath:     ms.GetBalancerProbePath(),
+		Logger:        ms.GetLogger(),
+	})
+	ms.HTTPClient.Transport = ms.balancer
+}
+
+// ---------------------------------------------------------------------------
+
+// GetServiceDiscovery returns the discovery, nil if none is configured
+func (ms *MicroService) GetServiceDiscovery() discovery.Discovery {
+	return ms.discovery
+}
+
+// ---------------------------------------------------------------------------
+
+// GetAdvertisedURL returns the URL other services reach this one at: the
+// advertised URL if it is configured, otherwise the base URL with the
+// hostname instead of an unspecified listen address like 0.0.0.0.
+func (ms *MicroService) GetAdvertisedURL() string {
+	if len(ms.GetAdvertise()) > 0 {
+		advertised := strings.TrimSuffix(ms.GetAdvertise(), "/")
+		if len(ms.GetNamespace()) > 0 {
+			advertised = fmt.Sprintf("%s/%s", advertised, ms.GetNamespace())
+		}
+		return advertised
+	}
+
+	u, err := url.Parse(ms.GetBaseURL())
+	if err != nil {
+		return ms.GetBaseURL()
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); len(host) == 0 || (ip != nil && ip.IsUnspecified()) {
+		u.Host = net.JoinHostPort(ms.GetHostname(), u.Port())
+	}
+	return u.String()
+}
+
+// ---------------------------------------------------------------------------
+
+// Resolve returns the endpoints of a service from the discovery
+func (ms *MicroService) Resolve(ctx context.Context, service string) ([]discovery.Endpoint, error) {
+	if ms.discovery == nil {
+		return nil, errors.New("no discovery is configured")
+	}
+	return ms.discovery.Resolve(ctx, service)
+}
+
+// ---------------------------------------------------------------------------
+
+// ServiceURL returns the balanced URL of path at a service, requests to it
+// with HTTPClient go to one of its endpoints
+func (ms *MicroService) ServiceURL(service string, path string) string {
+	return balancer.URL(service, path)
+}
+
+// ---------------------------------------------------------------------------
+
+// GetServiceURL returns the URL of path at the first endpoint of a service
+func (ms *MicroService) GetServiceURL(ctx context.Context, service string, path string) (string, error) {
+	endpoints, err := ms.Resolve(ctx, service)
+	if err != nil {
+		return "", err
+	}
+	// Discoveries of other packages may not report empty services as error
+	if len(endpoints) == 0 {
+		return "", fmt.Errorf("%w '%s'", discovery.ErrUnknownService, service)
+	}
+	return joinURL(endpoints[0].URL, path), nil
+}
+
+// ###########################################################################
+
+// endpoint is the endpoint this service registers as
+func (ms *MicroService) endpoint() discovery.Endpoint {
+	return discovery.Endpoint{
+		Service:  ms.GetName(),
+		Instance: ms.GetHostname(),
+		URL:      ms.GetAdvertisedURL(),
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// registerEndpoint registers the service once it accepts requests, if
+// register is set
+func (ms *MicroService) registerEndpoint() {
+	if !ms.GetRegister() || ms.discovery == nil {
+		return
+	}
+
+	registrar, ok := ms.discovery.(discovery.Registrar)
+	if !ok {
+		ms.GetLogger().Println("The discovery does not support registration, not registering.")
+		return
+	}
+
+	endpoint := ms.endpoint()
+	if err := registrar.Register(context.Background(), endpoint); err != nil {
+		ms.GetLogger().Fatal(fmt.Sprintf("Could not register '%s' as service '%s', error was '%s'!", endpoint.URL, endpoint.Service, err.Error()))
+		return
+	}
+	ms.GetLogger().Println(fmt.Sprintf("Registered '%s' as service '%s'.", endpoint.URL, endpoint.Service))
+}
+
+// ---------------------------------------------------------------------------
+
+// deregisterEndpoint removes the registration on shutdown, so no more
+// requests are sent while the service finishes the running ones
+func (ms *MicroService) deregisterEndpoint(ctx context.Context) {
+	if !ms.GetRegister() || ms.discovery == nil {
+		return
+	}
+
+	registrar, ok := ms.discovery.(discovery.Registrar)
+	if !ok {
+		return
+	}
+
+	endpoint := ms.endpoint()
+	if err := registrar.Deregister(ctx, endpoint); err != nil {
+		ms.GetLogger().Println(fmt.Sprintf("Could not deregister '%s' as service '%s', error was '%s'!", endpoint.URL, endpoint.Service, err.Error()))
+		return
+	}
+	ms.GetLogger().Println(fmt.Sprintf("Deregistered '%s' as service '%s'.", endpoint.URL, endpoint.Service))
+}
+
+// ---------------------------------------------------------------------------
+
+// closeBalancer stops probing ejected endpoints on shutdown
+func (ms *MicroService) closeBalancer(ctx context.Context) {
+	if ms.balancer != nil {
+		ms.balancer.Close()
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// joinURL appends path to a base URL
+func joinURL(base string, path string) string {
+	if strings.HasPrefix(path, "/") {
+		return fmt.Sprintf("%s%s", base, path)
+	}
+	return fmt.Sprintf("%s/%s", base, path)
+}
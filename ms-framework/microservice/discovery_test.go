@@ -0,0 +1,49 @@
+package microservice_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/discovery"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/microservice"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/microservice/microservicetest"
+)
+
+// emptyDiscovery knows every service, without any endpoint
+type emptyDiscovery struct{}
+
+func (emptyDiscovery) Resolve(ctx context.Context, service string) ([]discovery.Endpoint, error) {
+	return nil, nil
+}
+
+// ---------------------------------------------------------------------------
+
+func TestGetServiceURL(t *testing.T) {
+	s := microservicetest.New(t, &microservice.Configuration{}, nil)
+	ms := s.MicroService
+	ctx := context.Background()
+
+	if _, err := ms.GetServiceURL(ctx, "svc", "/status"); err == nil {
+		t.Error("resolved without discovery")
+	}
+
+	registry := discovery.NewRegistry()
+	registry.Register(ctx, discovery.Endpoint{Service: "svc", URL: "http://svc:8080/"})
+	ms.SetServiceDiscovery(registry)
+	defer ms.SetServiceDiscovery(nil)
+
+	for _, path := range []string{"/status", "status"} {
+		if u, err := ms.GetServiceURL(ctx, "svc", path); err != nil || u != "http://svc:8080/status" {
+			t.Errorf("%s: '%s', %v", path, u, err)
+		}
+	}
+	if _, err := ms.GetServiceURL(ctx, "other", "/status"); !errors.Is(err, discovery.ErrUnknownService) {
+		t.Errorf("unknown service: %v", err)
+	}
+
+	ms.SetServiceDiscovery(emptyDiscovery{})
+	if _, err := ms.GetServiceURL(ctx, "svc", "/status"); !errors.Is(err, discovery.ErrUnknownService) {
+		t.Errorf("no endpoints: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package microservice
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ###########################################################################
+// ###########################################################################
+// MicroService gRPC
+// ###########################################################################
+// ###########################################################################
+
+// healthWatchInterval is how often the health of watched services is checked
+const healthWatchInterval = 5 * time.Second
+
+// healthServer is the standard gRPC health service, answered from the
+// health checks of the service
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+	ms *MicroService
+}
+
+// ###########################################################################
+
+// grpcAuth checks the basic auth credentials in the metadata of a call
+// against the users of the passwordfile. Health checks need none, like
+// probes of orchestrators send none.
+func (ms *MicroService) grpcAuth(ctx context.Context, method string) error {
+	if strings.HasPrefix(method, "/grpc.health.v1.Health/") {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	r := http.Request{Header: http.Header{"Authorization": md.Get("authorization")}}
+
+	username, password, ok := r.BasicAuth()
+	if !ok || !ms.checkUser(username, password) {
+		return status.Error(codes.Unauthenticated, "Valid credentials are required.")
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+func (ms *MicroService) grpcUnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := ms.grpcAuth(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// ---------------------------------------------------------------------------
+
+func (ms *MicroService) grpcStreamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := ms.grpcAuth(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// ###########################################################################
+
+// Check answers for the whole service if service is empty or the name of a
+// registered gRPC service, otherwise for the health check of this name
+func (hs *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	servingStatus, found := hs.check(ctx, req.GetService())
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "Unknown service '%s'.", req.GetService())
+	}
+	return &healthpb.HealthCheckResponse{Status: servingStatus}, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// Watch sends the status at once and then whenever it changes
+func (hs *healthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ticker := time.NewTicker(healthWatchInterval)
+	defer ticker.Stop()
+
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	for {
+		servingStatus, found := hs.check(stream.Context(), req.GetService())
+		if !found {
+			servingStatus = healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+		}
+
+		if servingStatus != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: servingStatus}); err != nil {
+				return err
+			}
+			last = servingStatus
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func (hs *healthServer) check(ctx context.Context, service string) (healthpb.HealthCheckResponse_ServingStatus, bool) {
+	name := service
+	for _, registered := range hs.ms.GetGRPCServices() {
+		if service == registered {
+			name = ""
+		}
+	}
+
+	results := hs.ms.CheckHealth(ctx, name)
+	if len(name) > 0 && len(results) == 0 {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, false
+	}
+
+	for _, err := range results {
+		if err != nil {
+			return healthpb.HealthCheckResponse_NOT_SERVING, true
+		}
+	}
+	return healthpb.HealthCheckResponse_SERVING, true
+}
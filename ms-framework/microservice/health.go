@@ -0,0 +1,92 @@
+package microservice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher"
+)
+
+// ###########################################################################
+// ###########################################################################
+// MicroService Health
+// ###########################################################################
+// ###########################################################################
+
+// HealthCheck reports why a part of the service is not healthy, nil if it is
+type HealthCheck func(ctx context.Context) error
+
+// healthCheck is a registered HealthCheck
+type healthCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// HealthResponse is the reply of the health endpoint. Checks holds 'ok' or
+// the error of each check.
+type HealthResponse struct {
+	Response
+	Healthy bool              `json:"healthy"`
+	Checks  map[string]string `json:"checks,omitempty"`
+}
+
+// ###########################################################################
+
+// AddHealthCheck registers a check of the service. The service is healthy
+// if all checks pass. They are run on each request of the health endpoint
+// and the gRPC health service, which checks them by name as well.
+func (ms *MicroService) AddHealthCheck(name string, check HealthCheck) {
+	ms.healthMutex.Lock()
+	defer ms.healthMutex.Unlock()
+	ms.healthChecks = append(ms.healthChecks, healthCheck{name: name, check: check})
+}
+
+// ---------------------------------------------------------------------------
+
+// CheckHealth runs the checks named name, or all of them if name is empty.
+// It returns the results by check name, nil for the ones which passed.
+func (ms *MicroService) CheckHealth(ctx context.Context, name string) map[string]error {
+	ms.healthMutex.Lock()
+	checks := ms.healthChecks
+	ms.healthMutex.Unlock()
+
+	results := map[string]error{}
+	for _, check := range checks {
+		if len(name) == 0 || check.name == name {
+			results[check.name] = check.check(ctx)
+		}
+	}
+	return results
+}
+
+// ---------------------------------------------------------------------------
+
+// httpGetHealth replies 200 if all checks pass, 503 otherwise
+func (ms *MicroService) httpGetHealth(w http.ResponseWriter, r *http.Request) (status int, contentLen int, msg string) {
+	var response HealthResponse
+
+	response.Healthy = true
+	response.Checks = map[string]string{}
+	for name, err := range ms.CheckHealth(r.Context(), "") {
+		response.Checks[name] = "ok"
+		if err != nil {
+			response.Checks[name] = err.Error()
+			response.Healthy = false
+		}
+	}
+
+	status = http.StatusOK
+	msg = "Service is healthy."
+	if !response.Healthy {
+		status = http.StatusServiceUnavailable
+		msg = "Service is not healthy."
+	}
+
+	InitResponseFromMicroService(&response.Response, ms, status, fmt.Sprintf("%d - %s", status, http.StatusText(status)))
+	dispatcher.InitResponseFromRequest(&response.Response.Response, r)
+	ms.SetResponseHeaders("application/json; charset=utf-8", w, r)
+	w.WriteHeader(status)
+	contentLen = ms.Reply(w, response)
+	return status, contentLen, msg
+}
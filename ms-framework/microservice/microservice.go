@@ -3,10 +3,14 @@ package microservice
 import (
 	"flag"
 	"fmt"
+	"log"
 	"net/http"
-	"strings"
+	"sync"
 
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/balancer"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/discovery"
 	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 // ###########################################################################
@@ -21,7 +25,17 @@ type MicroService struct {
 	*DBConfiguration
 	*ServiceConfiguration
 	*FileConfiguration
+	*DiscoveryConfiguration
+	*BalancerConfiguration
 	UserEntries map[string]UserEntry
+
+	configuration *Configuration
+	reloadMutex   sync.Mutex
+	reloadFuncs   []ReloadFunc
+	healthMutex   sync.Mutex
+	healthChecks  []healthCheck
+	discovery     discovery.Discovery
+	balancer      *balancer.Balancer
 }
 
 // ---------------------------------------------------------------------------
@@ -39,6 +53,17 @@ type IMicroService interface {
 func Init(ms *MicroService,
 	configuration *Configuration,
 	defaultHandler *dispatcher.HandlerGroup) {
+	InitWithLogger(ms, configuration, defaultHandler, nil)
+}
+
+// ---------------------------------------------------------------------------
+
+// InitWithLogger initializes ms like Init, but logs to logger instead of the
+// configured logfile if it is not nil
+func InitWithLogger(ms *MicroService,
+	configuration *Configuration,
+	defaultHandler *dispatcher.HandlerGroup,
+	logger *log.Logger) {
 
 	defaultRequestHeaderFn := func(out *http.Request, in *http.Request) {
 		out.Header.Set("X-cid", ms.GetName())
@@ -51,10 +76,14 @@ func Init(ms *MicroService,
 		out.Header().Set("X-version", ms.GetVersion())
 	}
 
-	dispatcher.Init(&ms.Dispatcher, &configuration.Configuration, defaultHandler, nil, nil)
+	dispatcher.Init(&ms.Dispatcher, &configuration.Configuration, defaultHandler, nil, logger)
 	ms.GetLogger().SetPrefix(fmt.Sprintf("[%-12.12s] ", configuration.GetName()))
 	ms.DBConfiguration = &configuration.DBConfiguration
 	ms.ServiceConfiguration = &configuration.ServiceConfiguration
+	ms.FileConfiguration = &configuration.FileConfiguration
+	ms.DiscoveryConfiguration = &configuration.DiscoveryConfiguration
+	ms.BalancerConfiguration = &configuration.BalancerConfiguration
+	ms.configuration = configuration
 	ms.AddRequestHeaderFunction(defaultRequestHeaderFn)
 	ms.AddResponseHeaderFunction(defaultResponseHeaderFn)
 	// ms.HeaderConfiguration = &configuration.HeaderConfiguration
@@ -66,36 +95,37 @@ func Init(ms *MicroService,
 		ms.UserEntries = UserEntriesFromFile(configuration.Passwordfile)
 
 		checkUserAccessFn := func(w http.ResponseWriter, r *http.Request) bool {
-			var entry UserEntry
-			var exists bool
-
 			username, password, ok := r.BasicAuth()
 
-			if !ok {
-				goto error
+			if ok && ms.checkUser(username, password) {
+				return true
 			}
 
-			entry, exists = (ms.UserEntries)[username]
-
-			if !exists {
-				goto error
-			}
-
-			if !entry.CheckPassword(password) {
-				goto error
-			}
-
-			return true
-		error:
 			ms.SetResponseHeaders("application/json; charset=utf-8", w, r)
 			ms.PageNotAuthorized(w, r)
 			return false
 		}
 
-		ms.AddWrapper(checkUserAccessFn)
+		ms.AddAuthWrapper(checkUserAccessFn)
+		ms.AddGRPCInterceptor(ms.grpcUnaryAuth, ms.grpcStreamAuth)
 	}
 
-	ms.AddHandler("/status", &statusHandler)
+	ms.SetDebugConfiguration(ms.debugConfiguration)
+	ms.AddAdminHandler(dispatcher.AdminEndpointStatus, "/status", &statusHandler)
+	ms.AddAdminHandler(dispatcher.AdminEndpointHealth, "/health", &dispatcher.HandlerGroup{Get: ms.httpGetHealth})
+	ms.RegisterService(&healthpb.Health_ServiceDesc, &healthServer{ms: ms})
+
+	if len(configuration.Discovery) > 0 {
+		d, err := discovery.Open(configuration.Discovery)
+		if err != nil {
+			ms.GetLogger().Fatal(fmt.Sprintf("Could not open discovery '%s', error was '%s'!", configuration.Discovery, err.Error()))
+		}
+		ms.SetServiceDiscovery(d)
+	}
+
+	ms.OnStart(ms.registerEndpoint)
+	ms.OnShutdown(ms.deregisterEndpoint)
+	ms.OnShutdown(ms.closeBalancer)
 }
 
 // ---------------------------------------------------------------------------
@@ -115,6 +145,7 @@ func (ms *MicroService) httpGetStatus(w http.ResponseWriter, r *http.Request) (s
 	var response Response
 	status = http.StatusOK
 	InitResponseFromMicroService(&response, ms, status, fmt.Sprintf("%d - OK", status))
+	dispatcher.InitResponseFromRequest(&response.Response, r)
 	ms.SetResponseHeaders("application/json; charset=utf-8", w, r)
 	w.WriteHeader(status)
 	contentLen = ms.Reply(w, response)
@@ -123,13 +154,31 @@ func (ms *MicroService) httpGetStatus(w http.ResponseWriter, r *http.Request) (s
 
 // ---------------------------------------------------------------------------
 
-// GetEndpoint ...
+// debugConfiguration returns the redacted configuration for the debug
+// endpoints
+func (ms *MicroService) debugConfiguration() (configuration interface{}, err error) {
+	ms.ViewConfiguration(func() { configuration, err = ms.configuration.redactedValues() })
+	return configuration, err
+}
+
+// ---------------------------------------------------------------------------
+
+// checkUser reports if password is the one of the user in the passwordfile
+func (ms *MicroService) checkUser(username string, password string) bool {
+	var entry UserEntry
+	var exists bool
+
+	ms.ViewConfiguration(func() { entry, exists = (ms.UserEntries)[username] })
+
+	return exists && entry.CheckPassword(password)
+}
+
+// ---------------------------------------------------------------------------
+
+// GetEndpoint returns the URL of name at this service, as other services
+// reach it, see GetAdvertisedURL
 func (ms *MicroService) GetEndpoint(name string) string {
-	if strings.HasPrefix(name, "/") {
-		return fmt.Sprintf("%s%s", ms.GetBaseURL(), name)
-	} else {
-		return fmt.Sprintf("%s/%s", ms.GetBaseURL(), name)
-	}
+	return joinURL(ms.GetAdvertisedURL(), name)
 }
 
 // ---------------------------------------------------------------------------
@@ -137,5 +186,6 @@ func (ms *MicroService) GetEndpoint(name string) string {
 // Run ...
 func (ms *MicroService) Run() {
 	ms.GetLogger().Println(fmt.Sprintf("Starting MS '%s' at version '%s'.", ms.GetName(), ms.GetVersion()))
+	go ms.watchConfiguration()
 	ms.Dispatcher.Run()
 }
@@ -0,0 +1,76 @@
+package microservicetest
+
+import (
+	"log"
+	"testing"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/dispatcher/dispatchertest"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/microservice"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/secret"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ###########################################################################
+// ###########################################################################
+// MicroService test harness
+// ###########################################################################
+// ###########################################################################
+
+// A Server runs a MicroService inside a test like dispatchertest does for a
+// Dispatcher:
+//
+//	cfg := microservice.Configuration{}
+//	cfg.Name = "thermometer"
+//	s := microservicetest.New(t, &cfg, nil)
+//
+//	var response microservice.Response
+//	s.Get("/status").AssertStatus(http.StatusOK).Decode(&response)
+//
+// Registered configuration extensions get their defaults as well. The
+// configuration is not watched and can not be reloaded, discoveries given by
+// the configuration are opened but the service does not register itself.
+// Its balancer stops probing endpoints when the test ends.
+
+// Server serves a MicroService in process
+type Server struct {
+	*dispatchertest.Server
+	MicroService *microservice.MicroService
+}
+
+// ###########################################################################
+
+// Configure fills the fields of cfg and its extensions which are not set
+// from their defaults, see microservice.LoadConfigurationDefaults. The test
+// fails if cfg is invalid.
+func Configure(t testing.TB, cfg *microservice.Configuration) {
+	t.Helper()
+
+	if err := microservice.LoadConfigurationDefaults(cfg); err != nil {
+		t.Fatalf("configuration: %s", err.Error())
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// New initializes a MicroService from cfg, completed by Configure, with its
+// own metrics registry and log. The servers are closed when the test ends.
+func New(t testing.TB, cfg *microservice.Configuration, defaultHandler *dispatcher.HandlerGroup) *Server {
+	t.Helper()
+
+	Configure(t, cfg)
+
+	output := &dispatchertest.Log{}
+	logger := log.New(secret.NewWriter(output), "", log.Ldate|log.Ltime|log.LUTC|log.Lmsgprefix)
+
+	ms := &microservice.MicroService{}
+	ms.Registry = prometheus.NewRegistry()
+	microservice.InitWithLogger(ms, cfg, defaultHandler, logger)
+
+	s := &Server{Server: dispatchertest.Wrap(t, &ms.Dispatcher, output), MicroService: ms}
+
+	// Stops probing the endpoints of the discovery, Run would on shutdown
+	t.Cleanup(func() { ms.SetServiceDiscovery(nil) })
+
+	return s
+}
@@ -0,0 +1,110 @@
+package microservicetest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/microservice"
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/microservice/microservicetest"
+)
+
+// extension is a configuration registered by a service
+type extension struct {
+	Interval int `json:"interval" default:"1000" validate:"min=1"`
+}
+
+// ###########################################################################
+
+func TestServer(t *testing.T) {
+	var ext extension
+	cfg := microservice.Configuration{}
+	cfg.Name = "thermometer"
+	cfg.RegisterConfiguration("thermometer", &ext)
+	s := microservicetest.New(t, &cfg, nil)
+
+	if ext.Interval != 1000 {
+		t.Errorf("extension: interval %d != 1000", ext.Interval)
+	}
+	if cfg.GetPort() != microservice.DefaultPort {
+		t.Errorf("port: %d != %d", cfg.GetPort(), microservice.DefaultPort)
+	}
+
+	var response microservice.Response
+	s.Get("/status").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Content-Type", "application/json").
+		AssertHeader("X-cid", "thermometer").
+		Decode(&response)
+	if response.Name != "thermometer" || response.Code != http.StatusOK {
+		t.Errorf("status: %+v", response)
+	}
+
+	s.AssertMetric("ops_total", 1)
+	s.AssertLog("Status is good.")
+}
+
+// ---------------------------------------------------------------------------
+
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		healthy bool
+	}{
+		{"healthy", nil, http.StatusOK, true},
+		{"unhealthy", errors.New("database down"), http.StatusServiceUnavailable, false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := microservice.Configuration{}
+			cfg.Name = tt.name
+			s := microservicetest.New(t, &cfg, nil)
+			s.MicroService.AddHealthCheck("db", func(ctx context.Context) error { return tt.err })
+
+			var response microservice.HealthResponse
+			s.Get("/health").AssertStatus(tt.status).Decode(&response)
+			if response.Healthy != tt.healthy || len(response.Checks["db"]) == 0 {
+				t.Errorf("health: %+v", response)
+			}
+
+			// Each server has its own registry
+			s.AssertMetric("ops_total", 1)
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestInit(t *testing.T) {
+	cfg := microservice.Configuration{}
+	cfg.Proxy = []string{"/api/=http://upstream:8080/"}
+	cfg.Discovery = "memory://"
+	s := microservicetest.New(t, &cfg, nil)
+
+	// Init logs to the log of the test as well
+	s.AssertLog("Forwarding '/api/' to 'http://upstream:8080/'.")
+
+	if s.MicroService.GetServiceDiscovery() == nil {
+		t.Error("the discovery was not opened")
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestInvalidConfiguration(t *testing.T) {
+	var ext extension
+	cfg := microservice.Configuration{}
+	cfg.RegisterConfiguration("thermometer", &ext)
+	ext.Interval = -1
+
+	if err := microservice.LoadConfigurationDefaults(&cfg); err == nil {
+		t.Error("an invalid extension is accepted")
+	}
+}
@@ -31,30 +31,39 @@ func InitUserEntry(e *UserEntry, username string, password string) {
 	passwordhash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 
 	if err != nil {
-		log.Panic(fmt.Printf("Could not hash password, error was '%s'!", err.Error()))
+		log.Panicf("Could not hash password of user '%s', error was '%s'!", username, err.Error())
 	}
 
-	log.Printf("XXX [%s][%s][%s] XXX\n", username, password, string(passwordhash))
 	e.passwordhash = passwordhash
 }
 
 func UserEntryFromString(line string) *UserEntry {
+	entry, err := parseUserEntry(line)
+
+	if err != nil {
+		log.Panic(err.Error())
+	}
+
+	return entry
+}
+
+func parseUserEntry(line string) (*UserEntry, error) {
 
 	if RE_LINE_EMPTY.MatchString(line) {
-		return nil
+		return nil, nil
 	}
 
 	line = RE_LINE_REMOVE_COMMENT.ReplaceAllLiteralString(line, "")
 	split := RE_LINE_SPLIT.FindStringSubmatch(line)
 
 	if len(split) != 3 {
-		log.Panic(fmt.Printf("Could not split password line! [%s] %d", line, len(split)))
+		return nil, fmt.Errorf("Could not split password line, expected '<user> <password>'!")
 	}
 
 	var e UserEntry
 
 	InitUserEntry(&e, split[1], split[2])
-	return &e
+	return &e, nil
 }
 
 func (e *UserEntry) CheckPassword(password string) bool {
@@ -63,10 +72,20 @@ func (e *UserEntry) CheckPassword(password string) bool {
 }
 
 func UserEntriesFromFile(filename string) map[string]UserEntry {
+	userEntries, err := LoadUserEntries(filename)
+
+	if err != nil {
+		log.Panic(err.Error())
+	}
+
+	return userEntries
+}
+
+func LoadUserEntries(filename string) (map[string]UserEntry, error) {
 	file, err := os.Open(filename)
 
 	if err != nil {
-		log.Panic("Failed to open file '%s': %s", filename, err)
+		return nil, fmt.Errorf("Failed to open file '%s': %s", filename, err)
 	}
 
 	defer file.Close()
@@ -82,7 +101,11 @@ func UserEntriesFromFile(filename string) map[string]UserEntry {
 		if err != nil && err != io.EOF {
 			break
 		}
-		entry := UserEntryFromString(line)
+		entry, perr := parseUserEntry(line)
+
+		if perr != nil {
+			return nil, fmt.Errorf("Failed to read file '%s': %s", filename, perr)
+		}
 
 		if entry != nil {
 			userEntries[entry.username] = *entry
@@ -94,8 +117,8 @@ func UserEntriesFromFile(filename string) map[string]UserEntry {
 	}
 
 	if err != io.EOF {
-		log.Panic("Failed to read file '%s': %s", filename, err)
+		return nil, fmt.Errorf("Failed to read file '%s': %s", filename, err)
 	}
 
-	return userEntries
+	return userEntries, nil
 }
@@ -0,0 +1,222 @@
+package microservice
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/config"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Configuration reload
+// ###########################################################################
+// ###########################################################################
+
+// ReloadFunc is called after the configuration was reloaded. It gets all
+// changed values, including the ones which need a restart and were not
+// applied (Safe is false for them).
+type ReloadFunc func(changes []config.Change)
+
+// ignoredFlag stands in for flags the service defined itself while the
+// configuration is loaded again
+type ignoredFlag struct {
+	isBool bool
+}
+
+func (f ignoredFlag) String() string   { return "" }
+func (f ignoredFlag) Set(string) error { return nil }
+func (f ignoredFlag) IsBoolFlag() bool { return f.isBool }
+
+// ###########################################################################
+
+// OnReload registers fn to be called after each reload of the configuration
+func (ms *MicroService) OnReload(fn ReloadFunc) {
+	ms.reloadMutex.Lock()
+	defer ms.reloadMutex.Unlock()
+	ms.reloadFuncs = append(ms.reloadFuncs, fn)
+}
+
+// ---------------------------------------------------------------------------
+
+// Reload loads the configuration again from the same arguments, environment
+// and configuration file and compares it to the live one. Values tagged
+// 'reload:"safe"' are applied together, while no request is served. The
+// headers are rebuilt, the logfile is reopened and the password file is read
+// again. All other changes are only logged, they need a restart. The gRPC
+// server keeps the maxbodysize it was started with.
+//
+// Services reading their own reloadable values while serving requests should
+// do so inside ViewConfiguration. The functions registered with OnReload are
+// called once the reload is done, they may register further functions or
+// reload again.
+func (ms *MicroService) Reload() error {
+	changes, err := ms.reload()
+	if err != nil {
+		return err
+	}
+
+	ms.reloadMutex.Lock()
+	reloadFuncs := append([]ReloadFunc(nil), ms.reloadFuncs...)
+	ms.reloadMutex.Unlock()
+
+	for _, fn := range reloadFuncs {
+		fn(changes)
+	}
+
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+// reload loads the configuration again and applies it, see Reload
+func (ms *MicroService) reload() ([]config.Change, error) {
+	ms.reloadMutex.Lock()
+	defer ms.reloadMutex.Unlock()
+
+	live := ms.configuration
+	if live == nil || live.source == nil {
+		return nil, errors.New("configuration was not loaded by LoadConfigurationFromArgs")
+	}
+
+	loaded := live.source.preset
+	for _, extension := range live.extensions {
+		target := copyStruct(extension.preset.Interface())
+		loaded.extensions = append(loaded.extensions, configurationExtension{section: extension.section, target: target.Interface()})
+	}
+
+	flagset := flag.NewFlagSet("reload", flag.ContinueOnError)
+	flagset.SetOutput(ioutil.Discard)
+	for _, f := range live.source.foreign {
+		bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flagset.Var(ignoredFlag{isBool: ok && bf.IsBoolFlag()}, f.Name, f.Usage)
+	}
+
+	if err := loaded.load(flagset, live.source.args); err != nil {
+		return nil, err
+	}
+
+	// Generated names and fallbacks stay as they are
+	if len(loaded.Name) == 0 {
+		loaded.Name = live.Name
+	}
+	if len(loaded.Hostname) == 0 {
+		loaded.Hostname = live.Hostname
+	}
+	if loaded.Port == 0 {
+		loaded.Port = live.Port
+	}
+
+	changes := config.Diff("", live, &loaded)
+	for i, extension := range live.extensions {
+		changes = append(changes, config.Diff(extension.section, extension.target, loaded.extensions[i].target)...)
+	}
+
+	passwordfile := live.Passwordfile
+	for i := range changes {
+		if changes[i].Key != "passwordfile" {
+			continue
+		}
+		// Authentication is only set up at startup
+		if len(live.Passwordfile) == 0 || len(loaded.Passwordfile) == 0 {
+			changes[i].Safe = false
+			continue
+		}
+		passwordfile = loaded.Passwordfile
+	}
+
+	var userEntries map[string]UserEntry
+	if len(passwordfile) > 0 && len(live.Passwordfile) > 0 {
+		var err error
+		if userEntries, err = LoadUserEntries(passwordfile); err != nil {
+			return nil, err
+		}
+	}
+
+	ms.UpdateConfiguration(func() {
+		for i := range changes {
+			if changes[i].Safe {
+				changes[i].Apply()
+			}
+		}
+		ms.ApplyHeaderStrings()
+		if userEntries != nil {
+			ms.UserEntries = userEntries
+		}
+	})
+
+	if err := ms.ReopenLogfile(); err != nil {
+		ms.GetLogger().Println(fmt.Sprintf("Failed to reopen the logfile, error was '%s'!", err.Error()))
+	}
+
+	for _, change := range changes {
+		if change.Safe {
+			ms.GetLogger().Println(fmt.Sprintf("Configuration '%s' updated.", change.Key))
+		} else {
+			ms.GetLogger().Println(fmt.Sprintf("Configuration '%s' changed, restart to apply it.", change.Key))
+		}
+	}
+
+	if len(changes) == 0 {
+		ms.GetLogger().Println("Configuration reloaded, nothing changed.")
+	}
+
+	return changes, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// watchConfiguration reloads the configuration on SIGHUP and whenever the
+// configuration file is modified
+func (ms *MicroService) watchConfiguration() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	filename := ms.GetConfigurationFile()
+
+	if len(filename) > 0 && ms.GetConfigurationWatch() > 0 {
+		ticker := time.NewTicker(time.Duration(ms.GetConfigurationWatch()) * time.Millisecond)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	stamp := modTime(filename)
+
+	for {
+		select {
+		case <-hup:
+			ms.GetLogger().Println("Reloading configuration on SIGHUP.")
+		case <-tick:
+			current := modTime(filename)
+			if current.Equal(stamp) {
+				continue
+			}
+			stamp = current
+			ms.GetLogger().Println(fmt.Sprintf("Configuration file '%s' changed, reloading it.", filename))
+		}
+
+		if err := ms.Reload(); err != nil {
+			ms.GetLogger().Println(fmt.Sprintf("Failed to reload configuration, keeping the current one. Error was '%s'!", err.Error()))
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func modTime(filename string) time.Time {
+	if len(filename) == 0 {
+		return time.Time{}
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
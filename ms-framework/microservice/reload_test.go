@@ -0,0 +1,292 @@
+package microservice
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// reloadExtension is a configuration registered by a service
+type reloadExtension struct {
+	Interval int    `json:"interval" default:"1000" reload:"safe" validate:"min=1"`
+	Device   string `json:"device" default:"sensor"`
+}
+
+// reloadService is a MicroService loaded from a configuration file
+type reloadService struct {
+	*MicroService
+	cfg  *Configuration
+	ext  *reloadExtension
+	dir  string
+	file string
+}
+
+// newReloadService loads the configuration file with content from args
+func newReloadService(t *testing.T, content map[string]interface{}, args ...string) *reloadService {
+	t.Helper()
+
+	dir := t.TempDir()
+	s := &reloadService{cfg: &Configuration{}, ext: &reloadExtension{}, dir: dir, file: filepath.Join(dir, "config.json")}
+	s.write(t, content)
+
+	flagset := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagset.Bool("verbose", false, "flag of the service")
+
+	s.cfg.RegisterConfiguration("thermometer", s.ext)
+	if err := LoadConfigurationFromArgs(s.cfg, append([]string{"-config", s.file, "-verbose"}, args...), flagset); err != nil {
+		t.Fatal(err)
+	}
+
+	s.MicroService = &MicroService{}
+	s.Registry = prometheus.NewRegistry()
+	Init(s.MicroService, s.cfg, nil)
+	if err := s.ReopenLogfile(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// write replaces the configuration file, the log goes to a file of the
+// service unless content sets another
+func (s *reloadService) write(t *testing.T, content map[string]interface{}) {
+	t.Helper()
+	if _, exists := content["logfile"]; !exists {
+		content["logfile"] = filepath.Join(s.dir, "ms.log")
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(s.file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func changeKeys(changes []config.Change) map[string]bool {
+	keys := map[string]bool{}
+	for _, change := range changes {
+		keys[change.Key] = change.Safe
+	}
+	return keys
+}
+
+// ###########################################################################
+
+func TestReload(t *testing.T) {
+	s := newReloadService(t, map[string]interface{}{
+		"port":            8081,
+		"delayreply":      0,
+		"responseheaders": []string{"X-A: 1"},
+		"thermometer":     map[string]interface{}{"interval": 500},
+	})
+
+	var got [][]config.Change
+	s.OnReload(func(changes []config.Change) { got = append(got, changes) })
+
+	changes, err := s.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("unchanged file: %+v", changes)
+	}
+
+	logfile := filepath.Join(s.dir, "other.log")
+	s.write(t, map[string]interface{}{
+		"port":            9090,
+		"delayreply":      25,
+		"logfile":         logfile,
+		"responseheaders": []string{"X-A: 2", "X-B: 3"},
+		"thermometer":     map[string]interface{}{"interval": 2000, "device": "probe"},
+	})
+
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("reload functions were called %d times", len(got))
+	}
+
+	want := map[string]bool{
+		"port":                 false,
+		"delayreply":           true,
+		"logfile":              true,
+		"responseheaders":      true,
+		"thermometer.interval": true,
+		"thermometer.device":   false,
+	}
+	keys := changeKeys(got[0])
+	if len(keys) != len(want) {
+		t.Errorf("changes: %v, want %v", keys, want)
+	}
+	for key, safe := range want {
+		if isSafe, exists := keys[key]; !exists || isSafe != safe {
+			t.Errorf("change '%s': safe %v, exists %v", key, isSafe, exists)
+		}
+	}
+
+	// Safe changes are applied, the others kept
+	if s.cfg.Port != 8081 || s.cfg.DelayReply != 25 || s.ext.Interval != 2000 || s.ext.Device != "sensor" {
+		t.Errorf("configuration: port %d, delay %d, interval %d, device '%s'", s.cfg.Port, s.cfg.DelayReply, s.ext.Interval, s.ext.Device)
+	}
+	if headers := s.GetResponseHeaders(); len(headers) != 2 {
+		t.Errorf("response headers were not rebuilt: %d", len(headers))
+	}
+	if _, err := os.Stat(logfile); err != nil {
+		t.Errorf("logfile was not reopened: %s", err.Error())
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestReloadInvalid(t *testing.T) {
+	s := newReloadService(t, map[string]interface{}{"delayreply": 10})
+
+	s.write(t, map[string]interface{}{"delayreply": -1})
+	if err := s.Reload(); err == nil {
+		t.Error("invalid value was accepted")
+	}
+
+	s.write(t, map[string]interface{}{"delayreply": 20, "unknown": 1})
+	if err := s.Reload(); err == nil {
+		t.Error("unknown key was accepted")
+	}
+
+	if s.cfg.DelayReply != 10 {
+		t.Errorf("delay: %d != 10", s.cfg.DelayReply)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestReloadArguments(t *testing.T) {
+	s := newReloadService(t, map[string]interface{}{"delayreply": 10}, "-delayreply", "30")
+
+	s.write(t, map[string]interface{}{"delayreply": 20, "requesttimeout": 500})
+	changes, err := s.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The command line still overrides the file
+	if keys := changeKeys(changes); len(keys) != 1 || !keys["requesttimeout"] {
+		t.Errorf("changes: %v", keys)
+	}
+	if s.cfg.DelayReply != 30 || s.cfg.RequestTimeout != 500 {
+		t.Errorf("delay %d, timeout %d", s.cfg.DelayReply, s.cfg.RequestTimeout)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestReloadNotLoaded(t *testing.T) {
+	cfg := Configuration{}
+	if err := LoadConfigurationDefaults(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	ms := &MicroService{}
+	ms.Registry = prometheus.NewRegistry()
+	Init(ms, &cfg, nil)
+
+	if err := ms.Reload(); err == nil {
+		t.Error("configuration without source was reloaded")
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestReloadPasswordfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		live    string
+		loaded  string
+		safe    bool
+		changed bool
+		user    string
+	}{
+		{"replaced", "a", "b", true, true, "bob"},
+		{"reread", "a", "a", false, false, "bob"},
+		{"added", "", "b", false, true, ""},
+		{"removed", "a", "", false, true, "bob"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := map[string]string{"": ""}
+			for _, name := range []string{"a", "b"} {
+				files[name] = filepath.Join(dir, name)
+				if err := ioutil.WriteFile(files[name], []byte("alice secret\n"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s := newReloadService(t, map[string]interface{}{"passwordfile": files[tt.live]})
+
+			// Both files have bob now, who gets access once the password
+			// file in use is read again
+			for _, name := range []string{"a", "b"} {
+				if err := ioutil.WriteFile(files[name], []byte("bob secret\n"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s.write(t, map[string]interface{}{"passwordfile": files[tt.loaded]})
+			changes, err := s.reload()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			safe, changed := changeKeys(changes)["passwordfile"]
+			if changed != tt.changed || safe != tt.safe {
+				t.Errorf("change: changed %v, safe %v", changed, safe)
+			}
+
+			want := files[tt.live]
+			if tt.safe {
+				want = files[tt.loaded]
+			}
+			if s.cfg.Passwordfile != want {
+				t.Errorf("passwordfile: '%s' != '%s'", s.cfg.Passwordfile, want)
+			}
+
+			if len(tt.user) == 0 {
+				if s.UserEntries != nil {
+					t.Errorf("users: %v", s.UserEntries)
+				}
+				return
+			}
+			if _, exists := s.UserEntries[tt.user]; !exists || len(s.UserEntries) != 1 {
+				t.Errorf("users: %v, want %s", s.UserEntries, tt.user)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestReloadPasswordfileInvalid(t *testing.T) {
+	live := filepath.Join(t.TempDir(), "a")
+	if err := ioutil.WriteFile(live, []byte("alice secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := newReloadService(t, map[string]interface{}{"passwordfile": live})
+
+	s.write(t, map[string]interface{}{"passwordfile": filepath.Join(s.dir, "missing"), "delayreply": 5})
+	if err := s.Reload(); err == nil {
+		t.Fatal("missing password file was accepted")
+	}
+
+	if s.cfg.Passwordfile != live || s.cfg.DelayReply != 0 {
+		t.Errorf("configuration was changed: '%s', %d", s.cfg.Passwordfile, s.cfg.DelayReply)
+	}
+	if _, exists := s.UserEntries["alice"]; !exists {
+		t.Errorf("users: %v", s.UserEntries)
+	}
+}
@@ -0,0 +1,362 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Recording files
+// ###########################################################################
+// ###########################################################################
+
+// Writer writes entries to a recording. Entries may be written from several
+// goroutines. HAR recordings are only complete after Close.
+type Writer struct {
+	mutex  sync.Mutex
+	w      io.WriteCloser
+	format string
+	count  int
+}
+
+// ###########################################################################
+
+// NewWriter creates a writer of format to w
+func NewWriter(w io.WriteCloser, format string) (*Writer, error) {
+	rw := &Writer{w: w, format: format}
+
+	switch format {
+	case FormatJSONL:
+	case FormatHAR:
+		if _, err := io.WriteString(w, `{"log":{"version":"1.2","creator":{"name":"go-common","version":"1.0"},"entries":[`); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown recording format '%s'", format)
+	}
+
+	return rw, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// Create opens a recording file. JSON lines are appended to an existing
+// file, a HAR file is replaced.
+func Create(filename string, format string) (*Writer, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if format == FormatHAR {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(filename, flags, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := NewWriter(file, format)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// Write appends an entry
+func (rw *Writer) Write(e *Entry) error {
+	var data []byte
+	var err error
+
+	if rw.format == FormatHAR {
+		data, err = json.Marshal(toHAR(e))
+	} else {
+		data, err = json.Marshal(e)
+	}
+	if err != nil {
+		return err
+	}
+
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	if rw.w == nil {
+		return os.ErrClosed
+	}
+
+	var buffer bytes.Buffer
+	if rw.format == FormatHAR && rw.count > 0 {
+		buffer.WriteByte(',')
+	}
+	buffer.Write(data)
+	if rw.format == FormatJSONL {
+		buffer.WriteByte('\n')
+	}
+
+	if _, err := rw.w.Write(buffer.Bytes()); err != nil {
+		return err
+	}
+	rw.count++
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+// Close finishes the recording and closes the underlying writer
+func (rw *Writer) Close() error {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	if rw.w == nil {
+		return nil
+	}
+
+	var err error
+	if rw.format == FormatHAR {
+		_, err = io.WriteString(rw.w, "]}}\n")
+	}
+	if closeErr := rw.w.Close(); err == nil {
+		err = closeErr
+	}
+	rw.w = nil
+	return err
+}
+
+// ###########################################################################
+
+// Read reads the entries of a recording in either format
+func Read(r io.Reader) ([]Entry, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var file harFile
+	if json.Unmarshal(data, &file) == nil && file.Log.Entries != nil {
+		entries := make([]Entry, 0, len(file.Log.Entries))
+		for _, he := range file.Log.Entries {
+			entries = append(entries, fromHAR(he))
+		}
+		return entries, nil
+	}
+
+	var entries []Entry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// ---------------------------------------------------------------------------
+
+// ReadFile reads the entries of a recording file
+func ReadFile(filename string) ([]Entry, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// ###########################################################################
+// HAR 1.2, see http://www.softwareishard.com/blog/har-12-spec/
+
+type harFile struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+	Comment     string         `json:"comment,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+	Comment     string         `json:"comment,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// truncatedComment marks truncated bodies, which HAR has no field for
+const truncatedComment = "body truncated"
+
+// ---------------------------------------------------------------------------
+
+// toHAR converts an entry to HAR
+func toHAR(e *Entry) harEntry {
+	he := harEntry{
+		StartedDateTime: e.Started,
+		Time:            e.Duration,
+		Timings:         harTimings{Wait: e.Duration},
+	}
+
+	he.Request = harRequest{
+		Method:      e.Request.Method,
+		URL:         e.Request.URL,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(e.Request.Header),
+		QueryString: []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(e.Request.Bytes()),
+	}
+	if u, err := url.Parse(e.Request.URL); err == nil {
+		for key, values := range u.Query() {
+			for _, value := range values {
+				he.Request.QueryString = append(he.Request.QueryString, harNameValue{Name: key, Value: value})
+			}
+		}
+	}
+	if len(e.Request.Body.Body) > 0 {
+		he.Request.PostData = &harPostData{MimeType: e.Request.Header.Get("Content-Type"), Text: e.Request.Body.Body, Encoding: e.Request.BodyEncoding}
+	}
+	if e.Request.Truncated {
+		he.Request.Comment = truncatedComment
+	}
+
+	mimeType := e.Response.Header.Get("Content-Type")
+	he.Response = harResponse{
+		Status:      e.Response.Status,
+		StatusText:  http.StatusText(e.Response.Status),
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(e.Response.Header),
+		Content:     harContent{Size: len(e.Response.Bytes()), MimeType: mimeType, Text: e.Response.Body.Body, Encoding: e.Response.BodyEncoding},
+		HeadersSize: -1,
+		BodySize:    len(e.Response.Bytes()),
+	}
+	if e.Response.Truncated {
+		he.Response.Comment = truncatedComment
+	}
+
+	return he
+}
+
+// ---------------------------------------------------------------------------
+
+// fromHAR converts a HAR entry
+func fromHAR(he harEntry) Entry {
+	e := Entry{
+		Started:  he.StartedDateTime,
+		Duration: he.Time,
+		Request: Request{
+			Method: he.Request.Method,
+			URL:    he.Request.URL,
+			Header: httpHeader(he.Request.Headers),
+		},
+		Response: Response{
+			Status: he.Response.Status,
+			Header: httpHeader(he.Response.Headers),
+		},
+	}
+
+	if he.Request.PostData != nil {
+		e.Request.Body.Body = he.Request.PostData.Text
+		e.Request.BodyEncoding = he.Request.PostData.Encoding
+	}
+	e.Request.Truncated = he.Request.Comment == truncatedComment
+
+	e.Response.Body.Body = he.Response.Content.Text
+	e.Response.BodyEncoding = he.Response.Content.Encoding
+	e.Response.Truncated = he.Response.Comment == truncatedComment
+
+	if len(he.Response.Content.MimeType) > 0 && len(e.Response.Header.Get("Content-Type")) == 0 {
+		e.Response.Header.Set("Content-Type", he.Response.Content.MimeType)
+	}
+	return e
+}
+
+// ---------------------------------------------------------------------------
+
+// harHeaders lists header sorted by name
+func harHeaders(header http.Header) []harNameValue {
+	list := []harNameValue{}
+	for key, values := range header {
+		for _, value := range values {
+			list = append(list, harNameValue{Name: key, Value: value})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// ---------------------------------------------------------------------------
+
+// httpHeader converts a HAR header list
+func httpHeader(list []harNameValue) http.Header {
+	header := http.Header{}
+	for _, nv := range list {
+		header.Add(nv.Name, nv.Value)
+	}
+	return header
+}
@@ -0,0 +1,160 @@
+package recorder
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/secret"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Request recording
+// ###########################################################################
+// ###########################################################################
+
+// Recordings hold the requests served and their replies, one Entry each.
+// They are written as JSON lines, one entry per line, or as HAR files, which
+// browsers and HTTP tools import. Both are read by Read and sent again by a
+// Replayer, which reports how the replies differ from the recorded ones.
+
+// Formats of recordings
+const (
+	FormatJSONL = "jsonl"
+	FormatHAR   = "har"
+)
+
+// DefaultRedactHeaders are always redacted in recordings
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// DefaultRedactQuery are the query parameters always redacted in recordings
+var DefaultRedactQuery = []string{"access_token", "token", "api_key", "apikey", "key", "password", "secret"}
+
+// Entry is a recorded request and its reply
+type Entry struct {
+	Started  time.Time `json:"started"`
+	Duration float64   `json:"duration"`
+	Request  Request   `json:"request"`
+	Response Response  `json:"response"`
+}
+
+// Request is a recorded request. URL is absolute, the path and query are
+// sent on replay.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body
+}
+
+// Response is a recorded reply
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body
+}
+
+// Body is a recorded body. Bodies which are no valid UTF-8 are encoded with
+// base64. Truncated bodies were longer than recorded.
+type Body struct {
+	Body         string `json:"body,omitempty"`
+	BodyEncoding string `json:"bodyencoding,omitempty"`
+	Truncated    bool   `json:"truncated,omitempty"`
+}
+
+// ###########################################################################
+
+// SetBody records data, truncated tells if it was cut off
+func (b *Body) SetBody(data []byte, truncated bool) {
+	b.Truncated = truncated
+	b.BodyEncoding = ""
+	if utf8.Valid(data) {
+		b.Body = string(data)
+		return
+	}
+	b.Body = base64.StdEncoding.EncodeToString(data)
+	b.BodyEncoding = "base64"
+}
+
+// ---------------------------------------------------------------------------
+
+// Bytes returns the recorded body
+func (b *Body) Bytes() []byte {
+	if b.BodyEncoding == "base64" {
+		data, err := base64.StdEncoding.DecodeString(b.Body)
+		if err == nil {
+			return data
+		}
+	}
+	return []byte(b.Body)
+}
+
+// ---------------------------------------------------------------------------
+
+// Redact replaces the values of the headers and query parameters, and of
+// DefaultRedactHeaders and DefaultRedactQuery, by secret.Mask and scrubs
+// registered secrets from the URL, headers and bodies
+func (e *Entry) Redact(headers []string, query []string) {
+	names := append(append([]string(nil), DefaultRedactHeaders...), headers...)
+	params := append(append([]string(nil), DefaultRedactQuery...), query...)
+
+	e.Request.URL = secret.Scrub(redactQuery(e.Request.URL, params))
+
+	for _, header := range []http.Header{e.Request.Header, e.Response.Header} {
+		for key, values := range header {
+			for i := range values {
+				values[i] = secret.Scrub(values[i])
+			}
+			for _, name := range names {
+				if strings.EqualFold(key, name) {
+					for i := range values {
+						values[i] = secret.Mask
+					}
+				}
+			}
+		}
+	}
+
+	for _, body := range []*Body{&e.Request.Body, &e.Response.Body} {
+		if len(body.BodyEncoding) == 0 {
+			body.Body = secret.Scrub(body.Body)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// redactQuery replaces the values of the query parameters params in rawURL
+// by secret.Mask, keeping the order and encoding of all other parameters
+func redactQuery(rawURL string, params []string) string {
+	i := strings.Index(rawURL, "?")
+	if i < 0 {
+		return rawURL
+	}
+
+	query := rawURL[i+1:]
+	fragment := ""
+	if j := strings.Index(query, "#"); j >= 0 {
+		query, fragment = query[:j], query[j:]
+	}
+
+	pairs := strings.Split(query, "&")
+	for k, pair := range pairs {
+		name := strings.SplitN(pair, "=", 2)[0]
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		for _, param := range params {
+			if strings.EqualFold(name, param) {
+				pairs[k] = strings.SplitN(pair, "=", 2)[0] + "=" + secret.Mask
+				break
+			}
+		}
+	}
+
+	return rawURL[:i+1] + strings.Join(pairs, "&") + fragment
+}
@@ -0,0 +1,224 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/secret"
+)
+
+// testEntries are recorded entries with text, binary and truncated bodies
+func testEntries() []Entry {
+	started := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	text := Entry{Started: started, Duration: 1.5}
+	text.Request = Request{Method: http.MethodPost, URL: "http://svc:8080/items?q=1", Header: http.Header{"Content-Type": {"application/json"}}}
+	text.Request.SetBody([]byte(`{"name":"x"}`), false)
+	text.Response = Response{Status: http.StatusCreated, Header: http.Header{"Content-Type": {"application/json"}, "X-Version": {"1"}}}
+	text.Response.SetBody([]byte(`{"id":1}`), false)
+
+	binary := Entry{Started: started.Add(time.Second), Duration: 0.25}
+	binary.Request = Request{Method: http.MethodGet, URL: "http://svc:8080/image", Header: http.Header{"Accept": {"image/png"}}}
+	binary.Response = Response{Status: http.StatusOK, Header: http.Header{"Content-Type": {"image/png"}}}
+	binary.Response.SetBody([]byte{0x89, 'P', 'N', 'G', 0xff, 0x00}, true)
+
+	return []Entry{text, binary}
+}
+
+// nopCloser is a buffer for a Writer
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// ###########################################################################
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatJSONL, FormatHAR} {
+		t.Run(format, func(t *testing.T) {
+			var buffer bytes.Buffer
+			w, err := NewWriter(nopCloser{&buffer}, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries := testEntries()
+			for i := range entries {
+				if err := w.Write(&entries[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Write(&entries[0]); err == nil {
+				t.Error("a closed writer accepts entries")
+			}
+
+			read, err := Read(&buffer)
+			if err != nil {
+				t.Fatalf("%s\n%s", err.Error(), buffer.String())
+			}
+			if !reflect.DeepEqual(read, testEntries()) {
+				t.Errorf("read\n%+v, want\n%+v", read, testEntries())
+			}
+			if body := read[1].Response.Bytes(); !bytes.Equal(body, []byte{0x89, 'P', 'N', 'G', 0xff, 0x00}) {
+				t.Errorf("binary body: %v", body)
+			}
+		})
+	}
+
+	if _, err := NewWriter(nopCloser{&bytes.Buffer{}}, "xml"); err == nil {
+		t.Error("an unknown format is accepted")
+	}
+	if _, err := Read(strings.NewReader("{}\nnot json\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("invalid line: %v", err)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestRedactQuery(t *testing.T) {
+	params := []string{"token", "api_key"}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://svc/items", "http://svc/items"},
+		{"http://svc/items?q=1", "http://svc/items?q=1"},
+		{"http://svc/items?token=abc&q=1", "http://svc/items?token=*****&q=1"},
+		{"http://svc/items?q=a%20b&API_KEY=abc#top", "http://svc/items?q=a%20b&API_KEY=*****#top"},
+		{"http://svc/items?api%5Fkey=abc&token", "http://svc/items?api%5Fkey=*****&token=*****"},
+		{"http://svc/items?tokens=abc", "http://svc/items?tokens=abc"},
+	}
+
+	for _, tt := range tests {
+		if got := redactQuery(tt.url, params); got != tt.want {
+			t.Errorf("%s: %s != %s", tt.url, got, tt.want)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestRedact(t *testing.T) {
+	secret.Register("recorded-secret-value")
+
+	e := testEntries()[0]
+	e.Request.URL = "http://svc/items/recorded-secret-value?access_token=abc&session=s1"
+	e.Request.Header.Set("Authorization", "Bearer abc")
+	e.Request.Header.Set("X-Session", "s1")
+	e.Request.Header.Set("X-Forwarded", "for recorded-secret-value")
+	e.Response.Header.Set("Set-Cookie", "id=1")
+	e.Request.SetBody([]byte(`{"password":"recorded-secret-value"}`), false)
+
+	e.Redact([]string{"X-Session"}, []string{"session"})
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"url", e.Request.URL, "http://svc/items/*****?access_token=*****&session=*****"},
+		{"default header", e.Request.Header.Get("Authorization"), secret.Mask},
+		{"configured header", e.Request.Header.Get("X-Session"), secret.Mask},
+		{"scrubbed header", e.Request.Header.Get("X-Forwarded"), "for *****"},
+		{"response header", e.Response.Header.Get("Set-Cookie"), secret.Mask},
+		{"other header", e.Request.Header.Get("Content-Type"), "application/json"},
+		{"body", e.Request.Body.Body, `{"password":"*****"}`},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: '%s' != '%s'", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestCompareJSON(t *testing.T) {
+	ignore := []string{"requestid", "trace.host"}
+
+	tests := []struct {
+		name     string
+		recorded string
+		replayed string
+		want     []string
+	}{
+		{"equal", `{"a":1,"b":[1,2]}`, `{"b":[1,2],"a":1}`, nil},
+		{"value", `{"a":1}`, `{"a":2}`, []string{"a: 1 != 2"}},
+		{"missing", `{"a":1,"b":2}`, `{"a":1}`, []string{"b: missing"}},
+		{"unexpected", `{"a":1}`, `{"a":1,"c":"x"}`, []string{`c: unexpected "x"`}},
+		{"nested", `{"o":{"a":[1,{"b":true}]}}`, `{"o":{"a":[1,{"b":false}]}}`, []string{"o.a[1].b: true != false"}},
+		{"array length", `{"a":[1,2]}`, `{"a":[1]}`, []string{"a: [1,2] != [1]"}},
+		{"type", `{"a":{"b":1}}`, `{"a":"b"}`, []string{`a: {"b":1} != "b"`}},
+		{"ignored name", `{"o":{"requestid":"1"}}`, `{"o":{"requestid":"2"}}`, nil},
+		{"ignored path", `{"trace":{"host":"a"},"host":"a"}`, `{"trace":{"host":"b"},"host":"b"}`, []string{`host: "a" != "b"`}},
+		{"scalar body", `1`, `2`, []string{"body: 1 != 2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var recorded, replayed interface{}
+			if err := json.Unmarshal([]byte(tt.recorded), &recorded); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.replayed), &replayed); err != nil {
+				t.Fatal(err)
+			}
+			if diffs := compareJSON(nil, "", recorded, replayed, ignore); !reflect.DeepEqual(diffs, tt.want) {
+				t.Errorf("%q != %q", diffs, tt.want)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestReplay(t *testing.T) {
+	var received http.Header
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Version", r.URL.Query().Get("version"))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":1,"requestid":"%d","echo":%s}`, time.Now().UnixNano(), body)
+	})
+
+	e := testEntries()[0]
+	e.Request.URL = "http://svc:8080/items?version=1"
+	e.Request.Header.Set("Authorization", secret.Mask)
+	e.Response.SetBody([]byte(`{"id":1,"requestid":"0","echo":{"name":"x"}}`), false)
+
+	rp := &Replayer{Handler: handler, Header: http.Header{"Authorization": {"Bearer replay"}}}
+	if result := rp.ReplayEntry(context.Background(), e); !result.OK() {
+		t.Errorf("replay: %v %q", result.Err, result.Diffs)
+	}
+	if received.Get("Authorization") != "Bearer replay" {
+		t.Errorf("authorization: '%s'", received.Get("Authorization"))
+	}
+
+	e.Request.URL = "http://svc:8080/items?version=2"
+	e.Request.SetBody([]byte(`{"name":"y"}`), false)
+	result := rp.ReplayEntry(context.Background(), e)
+	want := []string{"header X-Version: '1' != '2'", `echo.name: "x" != "y"`}
+	if !reflect.DeepEqual(result.Diffs, want) {
+		t.Errorf("diffs: %q != %q", result.Diffs, want)
+	}
+
+	e.Request.Truncated = true
+	if result := rp.ReplayEntry(context.Background(), e); result.Err == nil {
+		t.Error("a truncated request is replayed")
+	}
+}
@@ -0,0 +1,316 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/com-gft-tsbo-source/go-common/ms-framework/secret"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Replay
+// ###########################################################################
+// ###########################################################################
+
+// DefaultIgnoreHeaders differ between replies to the same request
+var DefaultIgnoreHeaders = []string{"Date", "Content-Length", "X-Correlation-Id", "X-Request-Id", "X-Chost"}
+
+// DefaultIgnoreFields differ between replies to the same request, see
+// Replayer.IgnoreFields
+var DefaultIgnoreFields = []string{"correlationid", "requestid", "hostname", "host", "port"}
+
+// maxDiffs limits the differences reported per reply
+const maxDiffs = 20
+
+// Replayer sends recorded requests again, either to Handler, like a
+// Dispatcher in process, or to BaseURL, like a httptest.Server, and
+// compares the replies with the recorded ones.
+//
+// Headers are compared if they were recorded, except the ignored ones. JSON
+// bodies are compared field by field, except the ignored fields, which are
+// given as paths like 'trace.hostname' or as names matching at any depth.
+// Other bodies are compared as they are. Redacted headers are left out,
+// Header may provide them, redacted query parameters are sent masked.
+type Replayer struct {
+	Handler       http.Handler
+	BaseURL       string
+	Client        *http.Client
+	Header        http.Header
+	IgnoreHeaders []string
+	IgnoreFields  []string
+}
+
+// Result is the outcome of replaying an entry
+type Result struct {
+	Entry    Entry
+	Status   int
+	Header   http.Header
+	Body     []byte
+	Duration float64
+	Err      error
+	Diffs    []string
+}
+
+// ###########################################################################
+
+// OK reports if the reply matched the recorded one
+func (r *Result) OK() bool {
+	return r.Err == nil && len(r.Diffs) == 0
+}
+
+// ---------------------------------------------------------------------------
+
+// Replay sends all entries one after the other
+func (rp *Replayer) Replay(ctx context.Context, entries []Entry) []Result {
+	results := make([]Result, 0, len(entries))
+	for _, e := range entries {
+		results = append(results, rp.ReplayEntry(ctx, e))
+	}
+	return results
+}
+
+// ---------------------------------------------------------------------------
+
+// ReplayEntry sends the request of e and compares the reply
+func (rp *Replayer) ReplayEntry(ctx context.Context, e Entry) Result {
+	result := Result{Entry: e}
+
+	if e.Request.Truncated {
+		result.Err = errors.New("the request body was not recorded completely")
+		return result
+	}
+	if e.Response.Status == http.StatusSwitchingProtocols {
+		result.Err = errors.New("upgraded connections can not be replayed")
+		return result
+	}
+
+	r, err := rp.request(ctx, e)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	started := time.Now()
+	if rp.Handler != nil {
+		recorder := httptest.NewRecorder()
+		rp.Handler.ServeHTTP(recorder, r)
+		result.Status = recorder.Code
+		result.Header = recorder.Header()
+		result.Body = recorder.Body.Bytes()
+	} else {
+		client := rp.Client
+		if client == nil {
+			client = http.DefaultClient
+		}
+		response, err := client.Do(r)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		result.Status = response.StatusCode
+		result.Header = response.Header
+		result.Body, result.Err = ioutil.ReadAll(response.Body)
+		response.Body.Close()
+	}
+	result.Duration = float64(time.Since(started).Microseconds()) / 1000
+
+	if result.Err == nil {
+		result.Diffs = rp.compare(e, &result)
+	}
+	return result
+}
+
+// ###########################################################################
+
+// request builds the request of e aimed at the handler or the base URL
+func (rp *Replayer) request(ctx context.Context, e Entry) (*http.Request, error) {
+	recorded, err := url.Parse(e.Request.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	target := "http://replay" + recorded.RequestURI()
+	if rp.Handler == nil {
+		target = strings.TrimSuffix(rp.BaseURL, "/") + recorded.RequestURI()
+	}
+
+	r, err := http.NewRequestWithContext(ctx, e.Request.Method, target, bytes.NewReader(e.Request.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	if rp.Handler != nil {
+		r.RemoteAddr = "127.0.0.1:1"
+	}
+
+	for key, values := range e.Request.Header {
+		switch http.CanonicalHeaderKey(key) {
+		case "Content-Length", "Connection", "Transfer-Encoding", "Accept-Encoding", "Host":
+			continue
+		}
+		for _, value := range values {
+			// Redacted values are left out, Header may provide them
+			if value != secret.Mask {
+				r.Header.Add(key, value)
+			}
+		}
+	}
+	for key, values := range rp.Header {
+		r.Header[http.CanonicalHeaderKey(key)] = values
+	}
+
+	return r, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// compare lists the differences between the recorded and the new reply
+func (rp *Replayer) compare(e Entry, result *Result) []string {
+	var diffs []string
+
+	if e.Response.Status != result.Status {
+		diffs = append(diffs, fmt.Sprintf("status: %d != %d", e.Response.Status, result.Status))
+	}
+
+	ignoreHeaders := append(append([]string(nil), DefaultIgnoreHeaders...), rp.IgnoreHeaders...)
+	var keys []string
+	for key := range e.Response.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if contains(ignoreHeaders, key) {
+			continue
+		}
+		recorded := strings.Join(e.Response.Header.Values(key), ", ")
+		if strings.Contains(recorded, secret.Mask) {
+			continue
+		}
+		if replayed := strings.Join(result.Header.Values(key), ", "); recorded != replayed {
+			diffs = append(diffs, fmt.Sprintf("header %s: '%s' != '%s'", key, recorded, replayed))
+		}
+	}
+
+	recorded := e.Response.Bytes()
+	replayed := result.Body
+	if e.Response.Truncated && len(replayed) > len(recorded) {
+		replayed = replayed[:len(recorded)]
+	}
+
+	var recordedJSON, replayedJSON interface{}
+	if !e.Response.Truncated && json.Unmarshal(recorded, &recordedJSON) == nil && json.Unmarshal(replayed, &replayedJSON) == nil {
+		ignoreFields := append(append([]string(nil), DefaultIgnoreFields...), rp.IgnoreFields...)
+		diffs = compareJSON(diffs, "", recordedJSON, replayedJSON, ignoreFields)
+	} else if e.Response.Truncated && !bytes.Equal(recorded, replayed) {
+		diffs = append(diffs, fmt.Sprintf("body: the first %d bytes differ", len(recorded)))
+	} else if !bytes.Equal(recorded, replayed) {
+		diffs = append(diffs, fmt.Sprintf("body: %d bytes != %d bytes", len(recorded), len(replayed)))
+	}
+
+	if len(diffs) > maxDiffs {
+		diffs = append(diffs[:maxDiffs], fmt.Sprintf("... %d more", len(diffs)-maxDiffs))
+	}
+	return diffs
+}
+
+// ---------------------------------------------------------------------------
+
+// compareJSON appends the differences between two decoded JSON values
+func compareJSON(diffs []string, path string, recorded interface{}, replayed interface{}, ignore []string) []string {
+	if len(path) > 0 {
+		name := path[strings.LastIndex(path, ".")+1:]
+		if contains(ignore, path) || contains(ignore, name) {
+			return diffs
+		}
+	}
+
+	switch r := recorded.(type) {
+	case map[string]interface{}:
+		n, ok := replayed.(map[string]interface{})
+		if !ok {
+			break
+		}
+		var keys []string
+		for key := range r {
+			keys = append(keys, key)
+		}
+		for key := range n {
+			if _, found := r[key]; !found {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := key
+			if len(path) > 0 {
+				child = path + "." + key
+			}
+			rv, rfound := r[key]
+			nv, nfound := n[key]
+			switch {
+			case contains(ignore, child) || contains(ignore, key):
+			case !nfound:
+				diffs = append(diffs, fmt.Sprintf("%s: missing", child))
+			case !rfound:
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected %s", child, jsonString(nv)))
+			default:
+				diffs = compareJSON(diffs, child, rv, nv, ignore)
+			}
+		}
+		return diffs
+	case []interface{}:
+		n, ok := replayed.([]interface{})
+		if !ok || len(n) != len(r) {
+			break
+		}
+		for i := range r {
+			diffs = compareJSON(diffs, fmt.Sprintf("%s[%d]", path, i), r[i], n[i], ignore)
+		}
+		return diffs
+	}
+
+	if !reflect.DeepEqual(recorded, replayed) {
+		if len(path) == 0 {
+			path = "body"
+		}
+		diffs = append(diffs, fmt.Sprintf("%s: %s != %s", path, jsonString(recorded), jsonString(replayed)))
+	}
+	return diffs
+}
+
+// ---------------------------------------------------------------------------
+
+// jsonString formats a decoded JSON value for a difference
+func jsonString(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	if len(data) > 80 {
+		return string(data[:77]) + "..."
+	}
+	return string(data)
+}
+
+// ---------------------------------------------------------------------------
+
+// contains reports if list contains s, ignoring case
+func contains(list []string, s string) bool {
+	for _, entry := range list {
+		if strings.EqualFold(entry, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,253 @@
+package secret
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Secret references
+// ###########################################################################
+// ###########################################################################
+
+// Configuration values may reference their actual value instead of
+// containing it:
+//
+//	file:/run/secrets/db   content of the file, without trailing newlines
+//	env:DB_PASSWORD        value of the environment variable
+//	base64:cGFzcw==        base64 decoded value
+//
+// Resolved values are registered as secrets and are replaced by Mask in
+// everything passed through Scrub or written through a Writer. Secrets
+// shorter than 4 characters are not registered and thus never scrubbed, as
+// they would match all over the place; use longer passwords. Secrets shorter
+// than 8 characters are only scrubbed as whole words.
+
+// Mask replaces secrets in redacted output
+const Mask = "*****"
+
+// minLength is the length below which values are not scrubbed, as they would
+// match all over the place
+const minLength = 4
+
+// wordLength is the length below which values are only scrubbed as whole
+// words, so a password 'pass' does not mask 'password'
+const wordLength = 8
+
+var reURLPassword = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*://[^:/@]*:([^@]+)@`)
+
+var registry = struct {
+	sync.RWMutex
+	values []string
+}{}
+
+// ###########################################################################
+
+// IsReference reports if value is a secret reference
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, "file:") ||
+		strings.HasPrefix(value, "env:") ||
+		strings.HasPrefix(value, "base64:")
+}
+
+// ---------------------------------------------------------------------------
+
+// Resolve returns the value a reference points to and registers it as secret.
+// Values which are no reference are returned unchanged. Errors never contain
+// the secret itself.
+func Resolve(value string) (string, error) {
+	var resolved string
+
+	switch {
+
+	case strings.HasPrefix(value, "file:"):
+		filename := strings.TrimPrefix(value, "file:")
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file '%s'", filename)
+		}
+		resolved = strings.TrimRight(string(data), "\r\n")
+
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		ev, exists := os.LookupEnv(name)
+		if !exists {
+			return "", fmt.Errorf("secret environment variable '%s' is not set", name)
+		}
+		resolved = ev
+
+	case strings.HasPrefix(value, "base64:"):
+		data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, "base64:"))
+		if err != nil {
+			return "", fmt.Errorf("secret is not valid base64")
+		}
+		resolved = string(data)
+
+	default:
+		return value, nil
+	}
+
+	Register(resolved)
+	return resolved, nil
+}
+
+// ---------------------------------------------------------------------------
+
+// Register marks value as secret, so it is scrubbed from all output. If value
+// is an URL with a password, only the password is registered. Values shorter
+// than 4 characters are ignored.
+func Register(value string) {
+	if password := urlPassword(value); len(password) > 0 {
+		add(password)
+		return
+	}
+	add(value)
+}
+
+// ---------------------------------------------------------------------------
+
+// RegisterPassword marks the password of an URL like 'pg://user:pass@host/db'
+// as secret. Values without a password, like file names or host lists, are
+// not registered, so they stay readable in logs.
+func RegisterPassword(value string) {
+	if password := urlPassword(value); len(password) > 0 {
+		add(password)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+// Scrub replaces all registered secrets in text by Mask. Secrets shorter
+// than 8 characters are only replaced where they are no part of a longer
+// word.
+func Scrub(text string) string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, value := range registry.values {
+		if !strings.Contains(text, value) {
+			continue
+		}
+		if len(value) >= wordLength {
+			text = strings.ReplaceAll(text, value, Mask)
+			continue
+		}
+		text = replaceWord(text, value)
+	}
+	return text
+}
+
+// ---------------------------------------------------------------------------
+
+// Redact returns Mask for all non empty values, or value with only the
+// password masked if it is an URL like 'pg://user:pass@host:port/db'.
+func Redact(value string) string {
+	if len(value) == 0 {
+		return value
+	}
+	if password := urlPassword(value); len(password) > 0 {
+		return strings.Replace(value, ":"+password+"@", ":"+Mask+"@", 1)
+	}
+	return Mask
+}
+
+// ###########################################################################
+
+// Writer scrubs secrets from everything written to it. It is meant to be
+// used below loggers, which write one line per call.
+type Writer struct {
+	io.Writer
+}
+
+// NewWriter creates a Writer writing to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{Writer: w}
+}
+
+// Write scrubs p and writes it. It reports len(p) as written if the scrubbed
+// text was written completely.
+func (sw *Writer) Write(p []byte) (int, error) {
+	scrubbed := Scrub(string(p))
+	if scrubbed == string(p) {
+		return sw.Writer.Write(p)
+	}
+	if _, err := io.WriteString(sw.Writer, scrubbed); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ###########################################################################
+
+func add(value string) {
+	if len(value) < minLength {
+		return
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	for _, known := range registry.values {
+		if known == value {
+			return
+		}
+	}
+
+	// Longer values first, so secrets containing others are masked as a whole
+	registry.values = append(registry.values, value)
+	sort.Slice(registry.values, func(i, j int) bool { return len(registry.values[i]) > len(registry.values[j]) })
+}
+
+// ---------------------------------------------------------------------------
+
+// replaceWord replaces value in text by Mask where it is not surrounded by
+// letters or digits
+func replaceWord(text string, value string) string {
+	var b strings.Builder
+	rest := text
+
+	for {
+		i := strings.Index(rest, value)
+		if i < 0 {
+			b.WriteString(rest)
+			return b.String()
+		}
+		end := i + len(value)
+		before, _ := utf8.DecodeLastRuneInString(rest[:i])
+		after, _ := utf8.DecodeRuneInString(rest[end:])
+		b.WriteString(rest[:i])
+		if isWordRune(before) || isWordRune(after) {
+			b.WriteString(value)
+		} else {
+			b.WriteString(Mask)
+		}
+		rest = rest[end:]
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// ---------------------------------------------------------------------------
+
+// urlPassword returns the password of an URL like 'pg://user:pass@host/db'
+func urlPassword(value string) string {
+	m := reURLPassword.FindStringSubmatch(value)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
@@ -0,0 +1,312 @@
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ###########################################################################
+// ###########################################################################
+// Struct tag validation
+// ###########################################################################
+// ###########################################################################
+
+// The rules of a 'validate' tag are separated by commas:
+//
+//	required     the value must not be the zero value
+//	min=N        minimum number, minimum length of strings and slices
+//	max=N        maximum number, maximum length of strings and slices
+//	enum=a|b|c   the value must be one of the listed values
+//	regex=RE     strings must match RE; must be the last rule of the tag
+//
+// Rules other than 'required' are skipped for zero values, so optional
+// fields only need to be valid if they are set. Values which were given
+// explicitly, like a 0 from the command line, are checked with Explicit.
+
+// FieldError describes a single field which failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// FieldErrors is the list of all fields which failed validation
+type FieldErrors []FieldError
+
+func (e FieldError) Error() string { return fmt.Sprintf("%s: %s", e.Field, e.Message) }
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// IsRuleError returns whether the error is caused by a 'validate' tag which
+// can not be applied, like an unknown rule. These are programming errors
+// rather than invalid values.
+func (e FieldError) IsRuleError() bool {
+	return strings.HasPrefix(e.Message, invalidRule) || strings.HasPrefix(e.Message, unknownRule)
+}
+
+const (
+	invalidRule = "has invalid rule"
+	unknownRule = "has unknown rule"
+)
+
+var regexCache sync.Map
+
+// ###########################################################################
+
+// Struct validates all fields of the struct v points to. Embedded structs are
+// validated as if their fields were part of v, named struct fields are
+// validated recursively with the field name as prefix. It returns nil if all
+// fields are valid, FieldErrors otherwise.
+func Struct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: expected a struct, got %s", rv.Kind())
+	}
+
+	var errs FieldErrors
+	validateStruct(rv, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+// Value validates a single value against the rules of a 'validate' tag.
+func Value(name string, v reflect.Value, tag string) error {
+	var errs FieldErrors
+	validateValue(v, name, tag, false, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+// Explicit validates a value which was given explicitly against the rules
+// of a 'validate' tag. Unlike Value, all rules apply to zero values as well.
+func Explicit(name string, v reflect.Value, tag string) error {
+	var errs FieldErrors
+	validateValue(v, name, tag, true, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+
+// FieldName returns the name of a struct field as it is used in error
+// messages, which is its json name if it has one.
+func FieldName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if len(name) == 0 || name == "-" {
+		return f.Name
+	}
+	return name
+}
+
+// ###########################################################################
+
+func validateStruct(rv reflect.Value, prefix string, errs *FieldErrors) {
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		fv := rv.Field(i)
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if f.Anonymous && fv.Kind() == reflect.Struct {
+			validateStruct(fv, prefix, errs)
+			continue
+		}
+
+		name := prefix + FieldName(f)
+		validateValue(fv, name, f.Tag.Get("validate"), false, errs)
+
+		if fv.Kind() == reflect.Struct {
+			validateStruct(fv, name+".", errs)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func validateValue(v reflect.Value, name string, tag string, explicit bool, errs *FieldErrors) {
+	if len(tag) == 0 {
+		return
+	}
+
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			break
+		}
+		v = v.Elem()
+	}
+
+	isZero := v.IsZero()
+
+	for len(tag) > 0 {
+		var rule string
+
+		if strings.HasPrefix(tag, "regex=") {
+			rule, tag = tag, ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			rule, tag = tag[:i], tag[i+1:]
+		} else {
+			rule, tag = tag, ""
+		}
+
+		key, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			key, arg = rule[:i], rule[i+1:]
+		}
+
+		if key == "required" {
+			if isZero {
+				*errs = append(*errs, FieldError{name, key, "is required"})
+				return
+			}
+			continue
+		}
+
+		if isZero && !explicit {
+			continue
+		}
+
+		if msg := checkRule(v, key, arg); len(msg) > 0 {
+			*errs = append(*errs, FieldError{name, key, msg})
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func checkRule(v reflect.Value, key string, arg string) string {
+	switch key {
+
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Sprintf(invalidRule+" '%s=%s'", key, arg)
+		}
+		actual, unit := measure(v)
+		if key == "min" && actual < limit {
+			if len(unit) > 0 {
+				return fmt.Sprintf("must have at least %s %s", arg, unit)
+			}
+			return fmt.Sprintf("must be at least %s", arg)
+		}
+		if key == "max" && actual > limit {
+			if len(unit) > 0 {
+				return fmt.Sprintf("must have at most %s %s", arg, unit)
+			}
+			return fmt.Sprintf("must be at most %s", arg)
+		}
+
+	case "enum":
+		allowed := strings.Split(arg, "|")
+		for _, value := range values(v) {
+			if !contains(allowed, value) {
+				return fmt.Sprintf("must be one of [%s], got '%s'", strings.Join(allowed, ", "), value)
+			}
+		}
+
+	case "regex":
+		re, err := compile(arg)
+		if err != nil {
+			return fmt.Sprintf(invalidRule+" '%s=%s'", key, arg)
+		}
+		for _, value := range values(v) {
+			if !re.MatchString(value) {
+				return fmt.Sprintf("must match '%s', got '%s'", arg, value)
+			}
+		}
+
+	default:
+		return fmt.Sprintf(unknownRule+" '%s'", key)
+	}
+
+	return ""
+}
+
+// ---------------------------------------------------------------------------
+
+// measure returns the number to compare min/max against and the unit of
+// lengths, which is empty for numbers
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	case reflect.String:
+		return float64(len([]rune(v.String()))), "characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), "elements"
+	}
+	return 0, ""
+}
+
+// ---------------------------------------------------------------------------
+
+// values returns the string representations of a value or of all elements of
+// a slice
+func values(v reflect.Value) []string {
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		var result []string
+		for i := 0; i < v.Len(); i++ {
+			result = append(result, fmt.Sprint(v.Index(i).Interface()))
+		}
+		return result
+	}
+	return []string{fmt.Sprint(v.Interface())}
+}
+
+// ---------------------------------------------------------------------------
+
+func contains(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ---------------------------------------------------------------------------
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
@@ -0,0 +1,111 @@
+package validate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStruct(t *testing.T) {
+	type nested struct {
+		Level int `json:"level" validate:"min=1,max=3"`
+	}
+	type configuration struct {
+		Name   string   `json:"name" validate:"required,max=8"`
+		Port   int      `json:"port" validate:"min=1,max=65535"`
+		Mode   string   `json:"mode" validate:"enum=fast|slow"`
+		Tags   []string `json:"tags" validate:"max=2,regex=^[a-z]+$"`
+		Nested nested   `json:"nested"`
+	}
+
+	tests := []struct {
+		name  string
+		value configuration
+		err   string
+	}{
+		{"valid", configuration{Name: "svc", Port: 80, Mode: "slow", Tags: []string{"a"}, Nested: nested{Level: 2}}, ""},
+		{"zero values are skipped", configuration{Name: "svc"}, ""},
+		{"required", configuration{}, "name: is required"},
+		{"too long", configuration{Name: "service-name"}, "name: must have at most 8 characters"},
+		{"too large", configuration{Name: "svc", Port: 70000}, "port: must be at most 65535"},
+		{"enum", configuration{Name: "svc", Mode: "medium"}, "mode: must be one of [fast, slow], got 'medium'"},
+		{"too many elements", configuration{Name: "svc", Tags: []string{"a", "b", "c"}}, "tags: must have at most 2 elements"},
+		{"regex", configuration{Name: "svc", Tags: []string{"A1"}}, "tags: must match '^[a-z]+$', got 'A1'"},
+		{"nested", configuration{Name: "svc", Nested: nested{Level: 5}}, "nested.level: must be at most 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Struct(&tt.value)
+			if len(tt.err) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("error: '%v', want '%s'", err, tt.err)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestExplicit(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		tag   string
+		err   string
+	}{
+		{"zero below min", 0, "min=1", "must be at least 1"},
+		{"zero within range", 0, "min=0,max=10", ""},
+		{"empty required", "", "required", "is required"},
+		{"empty not in enum", "", "enum=a|b", "must be one of [a, b], got ''"},
+		{"set value", 5, "min=1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Explicit("field", reflect.ValueOf(tt.value), tt.tag)
+			if len(tt.err) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("error: '%v', want '%s'", err, tt.err)
+			}
+
+			// Value skips zero values
+			if err := Value("field", reflect.ValueOf(tt.value), tt.tag); err != nil && tt.tag != "required" {
+				t.Errorf("Value: %s", err.Error())
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func TestIsRuleError(t *testing.T) {
+	var value struct {
+		Mode  string `json:"mode" validate:"oneof=a b"`
+		Count int    `json:"count" validate:"min=x"`
+		Name  string `json:"name" validate:"required"`
+	}
+	value.Mode = "c"
+	value.Count = 1
+
+	err := Struct(&value)
+	errs, ok := err.(FieldErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("errors: '%v'", err)
+	}
+	for i, want := range []bool{true, true, false} {
+		if errs[i].IsRuleError() != want {
+			t.Errorf("%s: IsRuleError() != %v", errs[i].Error(), want)
+		}
+	}
+}